@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/gongzhen/codewhisper-go/internal/agent"
+)
+
+// askOutput is what ask prints with --json
+type askOutput struct {
+    Question      string               `json:"question"`
+    Answer        string               `json:"answer"`
+    Model         string               `json:"model"`
+    Endpoint      string               `json:"endpoint"`
+    Files         []string             `json:"files"`
+    SelectedFiles []agent.SelectedFile `json:"selected_files,omitempty"`
+    TrimmedFiles  []agent.TrimmedFile  `json:"trimmed_files,omitempty"`
+    Error         string               `json:"error,omitempty"`
+    Detail        string               `json:"detail,omitempty"`
+}
+
+// runAsk answers one question about the codebase, read from the arguments
+// or stdin, and returns the exit code
+func runAsk(args []string) int {
+    startTerminal()
+
+    var files listFlag
+    cfg, rest := parseFlags("ask", args, func(fs *flag.FlagSet, cfg *Config) {
+        fs.Var(&files, "files", "Files to include as gitignore-style globs relative to the target, repeated or comma-separated (default: pick relevant files)")
+        fs.BoolVar(&cfg.JSON, "json", false, "Print the answer and the files it used as a JSON object")
+    })
+    cfg.Files = files
+
+    question := strings.TrimSpace(strings.Join(rest, " "))
+    if question == "" {
+        if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+            data, err := io.ReadAll(os.Stdin)
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Failed to read the question: %v\n", err)
+                return 1
+            }
+            question = strings.TrimSpace(string(data))
+        }
+    }
+    if question == "" {
+        fmt.Fprintln(os.Stderr, `Usage: codewhisper ask [flags] <question>, or pipe the question to stdin`)
+        return 2
+    }
+
+    store, err := loadConfig(cfg)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        return 1
+    }
+
+    selected, err := resolveFiles(store.Get(), cfg.Files)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        return 1
+    }
+
+    a, err := agent.NewAgent(store)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        return 1
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    var req agent.ChatRequest
+    req.Input.Question = question
+    req.Input.Config.Files = selected
+
+    var out io.Writer = os.Stdout
+    if cfg.JSON {
+        out = nil
+    }
+    result, err := streamAnswer(ctx, a, req, out)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        return 1
+    }
+
+    if cfg.JSON {
+        info := a.ModelManager().GetCurrentModelInfo()
+        if selected == nil {
+            selected = []string{}
+        }
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        enc.Encode(askOutput{
+            Question:      question,
+            Answer:        result.Text,
+            Model:         info.ModelID,
+            Endpoint:      info.Endpoint,
+            Files:         selected,
+            SelectedFiles: result.Selected,
+            TrimmedFiles:  result.Trimmed,
+            Error:         result.Error,
+            Detail:        result.Detail,
+        })
+    } else {
+        if result.Text != "" && !strings.HasSuffix(result.Text, "\n") {
+            fmt.Println()
+        }
+        reportContext(os.Stderr, result)
+        if result.Error != "" {
+            fmt.Fprintf(os.Stderr, "Error: %s\n", result.Detail)
+        }
+    }
+
+    if result.Error != "" {
+        return 1
+    }
+    return 0
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gongzhen/codewhisper-go/internal/agent"
+	"github.com/gongzhen/codewhisper-go/internal/conversations"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+const chatHelp = `Commands:
+  /add <glob>...          Add the files matching gitignore-style globs
+  /drop [glob]...         Drop the matching files, or every file
+  /files                  List the selected files
+  /tokens                 Show how much of the context window is in use
+  /model [endpoint] [id]  Show the current model and those available, or switch
+  /save [title]           Save the conversation; later exchanges are saved too
+  /help                   Show this help
+  /quit                   Leave (or Ctrl-D)
+Without selected files, the files most relevant to each question are picked.
+`
+
+// chatSession is a conversation held in the terminal
+type chatSession struct {
+    agent   *agent.Agent
+    config  *config.Store
+    target  string
+    files   []string // selected, relative to target
+    history [][]string
+
+    // Set once the conversation is saved
+    store          *conversations.Store
+    conversationID string
+
+    // out shows answers and command output, errs errors and notes
+    out  io.Writer
+    errs io.Writer
+}
+
+// runChat holds a conversation about the codebase in the terminal, reading
+// one question or command per line, and returns the exit code
+func runChat(args []string) int {
+    startTerminal()
+
+    var files listFlag
+    cfg, _ := parseFlags("chat", args, func(fs *flag.FlagSet, cfg *Config) {
+        fs.Var(&files, "files", "Files to include as gitignore-style globs relative to the target, repeated or comma-separated (default: pick relevant files)")
+    })
+    cfg.Files = files
+
+    store, err := loadConfig(cfg)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        return 1
+    }
+
+    selected, err := resolveFiles(store.Get(), cfg.Files)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        return 1
+    }
+
+    a, err := agent.NewAgent(store)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        return 1
+    }
+
+    s := &chatSession{agent: a, config: store, target: cfg.Target, files: selected, out: os.Stdout, errs: os.Stderr}
+
+    info := a.ModelManager().GetCurrentModelInfo()
+    fmt.Printf("CodeWhisper %s: %s (%s) on %s\n", utils.CurrentVersion, info.ModelID, info.Endpoint, cfg.Target)
+    fmt.Println("Ask a question about the codebase, or type /help for commands. Ctrl-C stops an answer, Ctrl-D quits.")
+
+    if err := s.run(os.Stdin); err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        return 1
+    }
+    return 0
+}
+
+// run reads questions and commands from in, one per line, until it ends or
+// the user quits
+func (s *chatSession) run(in io.Reader) error {
+    scanner := bufio.NewScanner(in)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for {
+        fmt.Fprint(s.out, "\n> ")
+        if !scanner.Scan() {
+            fmt.Fprintln(s.out)
+            break
+        }
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" {
+            continue
+        }
+
+        if strings.HasPrefix(line, "/") {
+            if !s.command(line) {
+                break
+            }
+            continue
+        }
+        s.ask(line)
+    }
+    return scanner.Err()
+}
+
+// ask streams the answer to a question and adds the exchange to the
+// conversation
+func (s *chatSession) ask(question string) {
+    var req agent.ChatRequest
+    req.Input.Question = question
+    req.Input.ChatHistory = s.history
+    req.Input.Config.Files = s.files
+    req.Input.ConversationID = s.conversationID
+
+    // Ctrl-C stops the answer rather than the chat
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    result, err := streamAnswer(ctx, s.agent, req, s.out)
+    stop()
+    if err != nil {
+        fmt.Fprintf(s.errs, "Error: %v\n", err)
+        return
+    }
+    if result.Text != "" && !strings.HasSuffix(result.Text, "\n") {
+        fmt.Fprintln(s.out)
+    }
+    reportContext(s.errs, result)
+
+    if result.Error != "" {
+        fmt.Fprintf(s.errs, "Error: %s\n", result.Detail)
+        return
+    }
+    s.history = append(s.history, []string{question, result.Text})
+
+    if s.store != nil {
+        _, err := s.store.Append(s.conversationID,
+            conversations.Message{Role: conversations.RoleHuman, Content: question},
+            conversations.Message{Role: conversations.RoleAssistant, Content: result.Text},
+        )
+        if err != nil {
+            fmt.Fprintf(s.errs, "Failed to save the conversation: %v\n", err)
+        }
+    }
+}
+
+// command runs a slash command, returning false when the chat should end
+func (s *chatSession) command(line string) bool {
+    name, rest, _ := strings.Cut(line, " ")
+    args := strings.Fields(rest)
+
+    switch name {
+    case "/add":
+        s.add(args)
+    case "/drop":
+        s.drop(args)
+    case "/files":
+        s.listFiles()
+    case "/tokens":
+        s.tokens()
+    case "/model":
+        s.model(args)
+    case "/save":
+        s.save(strings.TrimSpace(rest))
+    case "/help":
+        fmt.Fprint(s.out, chatHelp)
+    case "/quit", "/exit":
+        return false
+    default:
+        fmt.Fprintf(s.out, "Unknown command %s, type /help for commands\n", name)
+    }
+    return true
+}
+
+func (s *chatSession) add(patterns []string) {
+    if len(patterns) == 0 {
+        fmt.Fprintln(s.out, "Usage: /add <glob>...")
+        return
+    }
+
+    matched, err := resolveFiles(s.config.Get(), patterns)
+    if err != nil {
+        fmt.Fprintf(s.out, "Error: %v\n", err)
+        return
+    }
+
+    have := make(map[string]bool, len(s.files))
+    for _, file := range s.files {
+        have[file] = true
+    }
+    added, tokens := 0, 0
+    for _, file := range matched {
+        if !have[file] {
+            s.files = append(s.files, file)
+            tokens += s.fileTokens(file)
+            added++
+        }
+    }
+    sort.Strings(s.files)
+    fmt.Fprintf(s.out, "Added %d files (%d tokens), %d selected\n", added, tokens, len(s.files))
+}
+
+// drop removes the selected files matching patterns, which may also name
+// files that no longer exist
+func (s *chatSession) drop(patterns []string) {
+    if len(patterns) == 0 {
+        fmt.Fprintf(s.out, "Dropped %d files\n", len(s.files))
+        s.files = nil
+        return
+    }
+
+    matched, err := utils.GlobFiles(s.target, patterns, s.config.Get().Exclude)
+    if err != nil {
+        fmt.Fprintf(s.out, "Error: %v\n", err)
+        return
+    }
+    remove := make(map[string]bool)
+    for _, file := range matched {
+        remove[file] = true
+    }
+    for _, pattern := range patterns {
+        remove[filepath.ToSlash(filepath.Clean(pattern))] = true
+    }
+
+    kept := s.files[:0]
+    for _, file := range s.files {
+        if !remove[file] {
+            kept = append(kept, file)
+        }
+    }
+    fmt.Fprintf(s.out, "Dropped %d files, %d selected\n", len(s.files)-len(kept), len(kept))
+    s.files = kept
+}
+
+func (s *chatSession) listFiles() {
+    if len(s.files) == 0 {
+        fmt.Fprintln(s.out, "No files selected; the most relevant files are picked for each question")
+        return
+    }
+
+    total := 0
+    for _, file := range s.files {
+        tokens := s.fileTokens(file)
+        total += tokens
+        fmt.Fprintf(s.out, "%8d  %s\n", tokens, file)
+    }
+    fmt.Fprintf(s.out, "%8d  total in %d files\n", total, len(s.files))
+}
+
+// tokens shows what the selected files and the conversation take of the
+// model's context window, as the web UI's counter does
+func (s *chatSession) tokens() {
+    files := 0
+    for _, file := range s.files {
+        files += s.fileTokens(file)
+    }
+    history := 0
+    for _, exchange := range s.history {
+        history += utils.CountTokens(strings.Join(exchange, "\n"))
+    }
+    system := utils.CountTokens(agent.SystemPrompt)
+
+    spec := s.agent.ModelManager().CurrentModelSpec(context.Background())
+    total := files + history + system
+    fmt.Fprintf(s.out, "Files:         %8d  (%d selected)\n", files, len(s.files))
+    fmt.Fprintf(s.out, "History:       %8d  (%d exchanges)\n", history, len(s.history))
+    fmt.Fprintf(s.out, "System prompt: %8d\n", system)
+    fmt.Fprintf(s.out, "Total:         %8d  of %d (%.1f%%)\n", total, spec.ContextWindow, 100*float64(total)/float64(max(spec.ContextWindow, 1)))
+    if total > spec.ContextWindow {
+        fmt.Fprintln(s.out, "Files that don't fit will be sent as outlines or excerpts, and older exchanges summarized")
+    }
+}
+
+// model shows the current model and those available, or switches to
+// another, on the current endpoint unless one is given
+func (s *chatSession) model(args []string) {
+    mm := s.agent.ModelManager()
+    info := mm.GetCurrentModelInfo()
+
+    switch len(args) {
+    case 0:
+        fmt.Fprintf(s.out, "Current model: %s (%s)\n", info.ModelID, info.Endpoint)
+        specs, err := mm.ListModels(context.Background())
+        if err != nil {
+            fmt.Fprintf(s.out, "Couldn't list models: %v\n", err)
+            return
+        }
+        for _, spec := range specs {
+            fmt.Fprintf(s.out, "  %-40s %8d tokens\n", spec.ID, spec.ContextWindow)
+        }
+        return
+    case 1:
+        args = []string{info.Endpoint, args[0]}
+    case 2:
+    default:
+        fmt.Fprintln(s.out, "Usage: /model [endpoint] [model]")
+        return
+    }
+
+    endpoint, modelID := args[0], args[1]
+    if err := mm.SwitchModel(endpoint, modelID); err != nil {
+        fmt.Fprintf(s.out, "Failed to switch to %s model %s: %v\n", endpoint, modelID, err)
+        return
+    }
+
+    fmt.Fprintf(s.out, "Switched to %s (%s)\n", modelID, endpoint)
+
+    // Remember the choice as the web UI does
+    err := s.config.Update(func(c *config.Config) {
+        c.Endpoint, c.Model = endpoint, modelID
+    })
+    if err != nil {
+        fmt.Fprintf(s.out, "Model choice won't be remembered: %v\n", err)
+    }
+}
+
+// save stores the conversation where the web UI lists it. Once saved,
+// every exchange is appended as it happens.
+func (s *chatSession) save(title string) {
+    if s.store == nil {
+        store, err := conversations.Open(s.config.Get().ConversationDir)
+        if err != nil {
+            fmt.Fprintf(s.out, "Error: %v\n", err)
+            return
+        }
+        s.store = store
+    }
+
+    var messages []conversations.Message
+    for _, exchange := range s.history {
+        messages = append(messages,
+            conversations.Message{Role: conversations.RoleHuman, Content: exchange[0]},
+            conversations.Message{Role: conversations.RoleAssistant, Content: exchange[1]},
+        )
+    }
+
+    c := &conversations.Conversation{ID: s.conversationID, Title: title, Messages: messages}
+    var err error
+    if c.ID == "" {
+        err = s.store.Create(c)
+    } else {
+        if title == "" {
+            if existing, err := s.store.Get(c.ID); err == nil {
+                c.Title = existing.Title
+            }
+        }
+        err = s.store.Save(c)
+    }
+    if err != nil {
+        fmt.Fprintf(s.out, "Failed to save the conversation: %v\n", err)
+        return
+    }
+
+    s.conversationID = c.ID
+    fmt.Fprintf(s.out, "Saved conversation %s (%q)\n", c.ID, c.Title)
+}
+
+func (s *chatSession) fileTokens(file string) int {
+    return utils.CountTokensInFile(filepath.Join(s.target, file))
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gongzhen/codewhisper-go/internal/agent"
+	"github.com/gongzhen/codewhisper-go/internal/conversations"
+	"github.com/gongzhen/codewhisper-go/internal/models"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+// stubProvider answers every question with the same text and records the
+// conversations it was sent
+type stubProvider struct {
+	mu    sync.Mutex
+	convs []models.Conversation
+}
+
+func (p *stubProvider) StreamChat(ctx context.Context, conv models.Conversation) (<-chan models.StreamChunk, error) {
+	p.mu.Lock()
+	p.convs = append(p.convs, conv)
+	p.mu.Unlock()
+
+	ch := make(chan models.StreamChunk, 2)
+	ch <- models.StreamChunk{Content: "Sum adds "}
+	ch <- models.StreamChunk{Content: "the terms."}
+	close(ch)
+	return ch, nil
+}
+
+func (p *stubProvider) ValidateAuth() error { return nil }
+
+func (p *stubProvider) GetModelInfo() models.ModelInfo {
+	return models.ModelInfo{ModelID: "stub-model", Endpoint: "openai"}
+}
+
+func (p *stubProvider) ListModels(ctx context.Context) ([]models.ModelSpec, error) {
+	return []models.ModelSpec{{ID: "stub-model", ContextWindow: 100000, MaxOutputTokens: 4096}}, nil
+}
+
+// openAIServer accepts gpt-4o-mini, answering streamed requests with
+// "From the API." and rejecting every other model
+func openAIServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/chat/completions" || req.Model != "gpt-4o-mini" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"message":"The model does not exist","type":"invalid_request_error"}}`)
+			return
+		}
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"id":"x","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"length"}]}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"id\":\"x\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"From the API.\"}}]}\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newChatSession starts a session on a small codebase, the model served
+// by provider and OpenAI requests going to apiBase
+func newChatSession(t *testing.T, provider models.Provider, apiBase string) *chatSession {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	for _, name := range []string{config.EnvUserCodebaseDir, config.EnvModel, config.EnvEndpoint, config.EnvConversationDir, config.EnvAdditionalExcludeDirs} {
+		t.Setenv(name, "")
+	}
+
+	target := t.TempDir()
+	files := map[string]string{
+		"main.go":      "package main\n\nfunc main() { println(Sum(1, 2)) }\n",
+		"calc/sum.go":  "package calc\n\n// Sum adds the terms\nfunc Sum(terms ...int) int { return 0 }\n",
+		"docs/help.md": "# Help\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(target, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := config.Load(target, func(c *config.Config) {
+		c.Providers.OpenAI.APIKey = "key"
+		c.Providers.OpenAI.APIBase = apiBase
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := agent.NewAgentWithProvider(store, "openai", provider)
+	return &chatSession{agent: a, config: store, target: target, out: new(bytes.Buffer), errs: new(bytes.Buffer)}
+}
+
+// chat runs the session over script and returns what it printed
+func chat(t *testing.T, s *chatSession, script ...string) string {
+	t.Helper()
+	s.out, s.errs = new(bytes.Buffer), new(bytes.Buffer)
+	if err := s.run(strings.NewReader(strings.Join(script, "\n") + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	return s.out.(*bytes.Buffer).String() + s.errs.(*bytes.Buffer).String()
+}
+
+func expectOutput(t *testing.T, output string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(output, w) {
+			t.Errorf("output doesn't contain %q:\n%s", w, output)
+		}
+	}
+}
+
+func TestChatFileSelection(t *testing.T) {
+	provider := &stubProvider{}
+	s := newChatSession(t, provider, "")
+
+	output := chat(t, s,
+		"/files",
+		"/add *.go",
+		"/add *.go missing.rs",
+		"/add missing.rs",
+		"/drop main.go",
+		"/files",
+		"What does Sum do?",
+	)
+	expectOutput(t, output,
+		"No files selected",
+		"Added 2 files (",
+		"Added 0 files (0 tokens), 2 selected",
+		"Error: no files match missing.rs",
+		"Dropped 1 files, 1 selected",
+		"  calc/sum.go\n",
+		"total in 1 files",
+		"Sum adds the terms.",
+	)
+	if strings.Join(s.files, ",") != "calc/sum.go" || len(s.history) != 1 || s.history[0][1] != "Sum adds the terms." {
+		t.Errorf("files %v, history %v", s.files, s.history)
+	}
+
+	// Only the selected file was sent
+	sent := provider.convs[0].Messages[0]
+	var text strings.Builder
+	for _, part := range sent.Parts {
+		text.WriteString(part.Render())
+	}
+	if !strings.Contains(text.String(), "func Sum(terms ...int) int") || strings.Contains(text.String(), "func main()") {
+		t.Errorf("codebase sent:\n%s", text.String())
+	}
+
+	output = chat(t, s, "/drop", "/files")
+	expectOutput(t, output, "Dropped 1 files\n", "No files selected")
+}
+
+func TestChatModel(t *testing.T) {
+	srv := openAIServer(t)
+	s := newChatSession(t, &stubProvider{}, srv.URL)
+
+	output := chat(t, s, "/model", "/model nope", "/model openai gpt-4o-mini", "/model a b c", "/add calc/*.go", "Which model?")
+	expectOutput(t, output,
+		"Current model: stub-model (openai)",
+		"  stub-model ",
+		"Failed to switch to openai model nope",
+		"Switched to gpt-4o-mini (openai)",
+		"Usage: /model [endpoint] [model]",
+		"From the API.",
+	)
+
+	// The choice is remembered for the next start
+	reloaded, err := config.Load(s.target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := reloaded.Get(); cfg.Endpoint != "openai" || cfg.Model != "gpt-4o-mini" {
+		t.Errorf("saved endpoint %q, model %q", cfg.Endpoint, cfg.Model)
+	}
+}
+
+func TestChatSave(t *testing.T) {
+	s := newChatSession(t, &stubProvider{}, "")
+
+	output := chat(t, s, "/add *.go", "First question", "/save Sums", "Second question", "/save", "/bogus", "/quit", "Never asked")
+	expectOutput(t, output, `Saved conversation `, `("Sums")`, "Unknown command /bogus")
+	if strings.Count(output, "Saved conversation "+s.conversationID) != 2 {
+		t.Errorf("saved under different IDs:\n%s", output)
+	}
+	if len(s.history) != 2 {
+		t.Errorf("%d exchanges, want 2 asked before /quit", len(s.history))
+	}
+
+	store, err := conversations.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := store.Get(s.conversationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, m := range c.Messages {
+		contents = append(contents, fmt.Sprintf("%s: %s", m.Role, m.Content))
+	}
+	want := "human: First question|assistant: Sum adds the terms.|human: Second question|assistant: Sum adds the terms."
+	if c.Title != "Sums" || strings.Join(contents, "|") != want {
+		t.Errorf("saved %q with\n%s", c.Title, strings.Join(contents, "\n"))
+	}
+}
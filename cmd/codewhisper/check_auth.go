@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/models"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+// runCheckAuth validates the credentials of the selected endpoint and every
+// other configured one, printing what each resolved to, and returns the
+// exit code: non-zero when any check fails
+func runCheckAuth(cfg *Config) int {
+    store, err := loadConfig(cfg)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        return 1
+    }
+    settings := store.Get()
+
+    endpoints := []string{settings.Endpoint}
+    for _, endpoint := range models.ConfiguredEndpoints(settings) {
+        if !slices.Contains(endpoints, endpoint) {
+            endpoints = append(endpoints, endpoint)
+        }
+    }
+
+    if envFile != "" {
+        fmt.Printf("Loaded %s\n", envFile)
+    } else {
+        fmt.Println("No .env file found")
+    }
+    for _, file := range store.Files() {
+        fmt.Printf("Loaded %s\n", file)
+    }
+
+    failed := 0
+    for _, endpoint := range endpoints {
+        model := ""
+        heading := endpoint
+        if endpoint == settings.Endpoint {
+            model = settings.Model
+            heading += " (selected)"
+        }
+
+        check := models.CheckAuth(settings, endpoint, model)
+        fmt.Printf("\n%s\n", heading)
+        fmt.Printf("  Credentials: %s\n", credentialSource(store, check))
+        if check.BaseURL != "" {
+            fmt.Printf("  Base URL:    %s\n", check.BaseURL)
+        }
+        if check.ModelID != "" {
+            fmt.Printf("  Model:       %s\n", check.ModelID)
+        }
+        if check.Latency > 0 {
+            fmt.Printf("  Latency:     %s\n", check.Latency.Round(time.Millisecond))
+        }
+        if check.Err != nil {
+            fmt.Printf("  Status:      FAILED: %v\n", check.Err)
+            failed++
+        } else {
+            fmt.Printf("  Status:      OK\n")
+        }
+    }
+
+    if failed > 0 {
+        fmt.Fprintf(os.Stderr, "\n%d of %d endpoints failed the authentication check\n", failed, len(endpoints))
+        return 1
+    }
+    fmt.Printf("\nAll %d endpoints authenticated\n", len(endpoints))
+    return 0
+}
+
+// credentialSource says where an endpoint's credentials were found
+func credentialSource(store *config.Store, check models.AuthCheck) string {
+    if check.Credential != "" {
+        return check.Credential
+    }
+    if store.Get().Provider(check.Endpoint).APIKey == "" {
+        return "not found"
+    }
+
+    key := "providers." + check.Endpoint + ".api_key"
+    source := store.Source(key)
+    name, fromEnv := strings.CutPrefix(source, "$")
+    switch {
+    case fromEnv && envFileKeys[name]:
+        return fmt.Sprintf("%s from %s", name, envFile)
+    case fromEnv:
+        return fmt.Sprintf("%s from the environment", name)
+    default:
+        return fmt.Sprintf("%s in %s", key, source)
+    }
+}
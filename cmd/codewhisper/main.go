@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/gongzhen/codewhisper-go/internal/server"
+	"github.com/gongzhen/codewhisper-go/internal/tokenizer"
 	"github.com/gongzhen/codewhisper-go/internal/utils"
 	"github.com/gongzhen/codewhisper-go/pkg/config"
 	"github.com/joho/godotenv"
@@ -23,7 +24,7 @@ const (
     defaultPort = 6969
 )
 
-// Config holds the application configuration
+// Config holds the command-line flags
 type Config struct {
     Port          int
     Exclude       []string
@@ -34,12 +35,24 @@ type Config struct {
     CheckAuth     bool
     Target        string
     Endpoint      string
+    Files         []string
+    JSON          bool
+    // set lists the flags given on the command line, which override the
+    // config files and environment
+    set           map[string]bool
 }
 
+// envFile is the .env file loaded at startup, and envFileKeys the variables
+// it set; those already in the environment are left alone
+var (
+    envFile     string
+    envFileKeys = make(map[string]bool)
+)
+
 // loadEnvFile loads environment variables from .env file
 func loadEnvFile() error {
     // Try to load from current directory first
-    if err := godotenv.Load(); err == nil {
+    if err := loadEnvFrom(".env"); err == nil {
         utils.Log.Info("Loaded .env from current directory")
         return nil
     }
@@ -48,7 +61,7 @@ func loadEnvFile() error {
     homeDir, err := os.UserHomeDir()
     if err == nil {
         codewhisperEnvPath := filepath.Join(homeDir, ".codewhisper", ".env")
-        if err := godotenv.Load(codewhisperEnvPath); err == nil {
+        if err := loadEnvFrom(codewhisperEnvPath); err == nil {
             utils.Log.Info("Loaded .env from ~/.codewhisper/.env")
             return nil
         }
@@ -59,7 +72,7 @@ func loadEnvFile() error {
     if err == nil {
         execDir := filepath.Dir(execPath)
         execEnvPath := filepath.Join(execDir, ".env")
-        if err := godotenv.Load(execEnvPath); err == nil {
+        if err := loadEnvFrom(execEnvPath); err == nil {
             utils.Log.Info("Loaded .env from executable directory")
             return nil
         }
@@ -68,35 +81,103 @@ func loadEnvFile() error {
     return fmt.Errorf("no .env file found")
 }
 
+// loadEnvFrom loads a .env file, as godotenv.Load does, remembering which
+// variables came from it
+func loadEnvFrom(path string) error {
+    values, err := godotenv.Read(path)
+    if err != nil {
+        return err
+    }
+    
+    for key, value := range values {
+        if _, exists := os.LookupEnv(key); !exists {
+            os.Setenv(key, value)
+            envFileKeys[key] = true
+        }
+    }
+    
+    envFile = path
+    if absPath, err := filepath.Abs(path); err == nil {
+        envFile = absPath
+    }
+    return nil
+}
+
+const usage = `Usage:
+  codewhisper [serve] [flags]           Start the web UI
+  codewhisper ask [flags] <question>    Answer one question and exit
+  codewhisper chat [flags]              Chat about the codebase in the terminal
+
+Run "codewhisper <command> -h" for the flags of a command.
+`
+
 func main() {
-    // Load .env file
-    if err := loadEnvFile(); err != nil {
-        utils.Log.Warning("No .env file loaded: %v", err)
+    // Without a command, flags are the server's as they always were
+    command, args := "serve", os.Args[1:]
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        command, args = args[0], args[1:]
     }
-        
-	cfg := parseFlags()
+
+    switch command {
+    case "serve":
+        runServe(args)
+    case "ask":
+        os.Exit(runAsk(args))
+    case "chat":
+        os.Exit(runChat(args))
+    case "help":
+        fmt.Print(usage)
+    default:
+        fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+        os.Exit(2)
+    }
+}
+
+func runServe(args []string) {
+	cfg, _ := parseFlags("serve", args, func(fs *flag.FlagSet, cfg *Config) {
+        fs.IntVar(&cfg.Port, "port", defaultPort, "Port number to run CodeWhisper frontend on")
+        fs.BoolVar(&cfg.Version, "version", false, "Print version information")
+        fs.BoolVar(&cfg.CheckAuth, "check-auth", false, "Check authentication setup without starting server")
+    })
 
     if cfg.Version {
         fmt.Printf("CodeWhisper version %s\n", utils.CurrentVersion)
         return
 	}  
     
+    if cfg.CheckAuth {
+        startTerminal()
+        os.Exit(runCheckAuth(cfg))
+    }
+    
+    // Load .env file
+    if err := loadEnvFile(); err != nil {
+        utils.Log.Warning("No .env file loaded: %v", err)
+    }
+    
     // Check for updates (but don't block)
     go checkVersionAsync()
 
-    // Setup environment variables based on flags
-    setupEnvironment(cfg)	
+    store, err := loadConfig(cfg)
+    if err != nil {
+        utils.Log.Error("%v", err)
+        os.Exit(1)
+    }
+    settings := store.Get()
 
     // Now use our custom logger instead of log package    
     utils.Log.Info("Starting CodeWhisper on port %d...", cfg.Port)
-    utils.Log.Info("Target directory: %s", cfg.Target)
-    utils.Log.Info("Model endpoint: %s", cfg.Endpoint)
-    if cfg.Model != "" {
-        utils.Log.Info("Model: %s", cfg.Model)
+    utils.Log.Info("Target directory: %s", settings.Target)
+    utils.Log.Info("Model endpoint: %s", settings.Endpoint)
+    if settings.Model != "" {
+        utils.Log.Info("Model: %s", settings.Model)
+    }
+    for _, file := range store.Files() {
+        utils.Log.Info("Config file: %s", file)
     }
 
     // Create and start server
-    srv := server.NewServer(cfg.Port)
+    srv := server.NewServer(cfg.Port, store)
 
     go func ()  {
         sigChan := make(chan os.Signal, 1)
@@ -136,45 +217,81 @@ func checkVersionAsync() {
     }
 }
 
-func setupEnvironment(cfg *Config) {
-    // Set environment variables from config
-    config.SetEnv(config.EnvUserCodebaseDir, cfg.Target)
-    
-    // Convert exclude slice to comma-separated string
-    if len(cfg.Exclude) > 0 {
-        config.SetEnv(config.EnvAdditionalExcludeDirs, strings.Join(cfg.Exclude, ","))
+// loadConfig layers the config files and environment under the flags given
+// on the command line, and points cfg.Target at the codebase
+func loadConfig(cfg *Config) (*config.Store, error) {
+    target := ""
+    if cfg.set["target"] {
+        target = cfg.Target
     }
-    
-    if cfg.Profile != "" {
-        config.SetEnv(config.EnvAWSProfile, cfg.Profile)
+
+    store, err := config.Load(target, func(c *config.Config) {
+        if cfg.set["endpoint"] && cfg.Endpoint != c.Endpoint {
+            // A model configured for another endpoint doesn't carry over
+            c.Endpoint, c.Model = cfg.Endpoint, ""
+        }
+        if cfg.set["model"] {
+            c.Model = cfg.Model
+        }
+        if cfg.set["profile"] {
+            c.AWSProfile = cfg.Profile
+        }
+        if cfg.set["exclude"] {
+            c.Exclude = cfg.Exclude
+        }
+        if cfg.set["max-depth"] {
+            c.MaxDepth = cfg.MaxDepth
+        }
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to load the configuration: %w", err)
     }
-    
-    if cfg.Model != "" {
-        config.SetEnv(config.EnvModel, cfg.Model)
+    for _, warning := range store.Warnings() {
+        utils.Log.Warning("%s", warning)
     }
-    
-    config.SetEnv(config.EnvEndpoint, cfg.Endpoint)
-    config.SetEnv(config.EnvMaxDepth, fmt.Sprintf("%d", cfg.MaxDepth))
+
+    settings := store.Get()
+    tokenizer.Configure(settings.TokenizerDir, settings.Tokenizer)
+    cfg.Target = settings.Target
+    return store, nil
 }
 
-func parseFlags() *Config {
-	config := &Config{}
+// parseFlags parses the flags every command takes, plus those extra
+// defines, and returns the remaining arguments. Flags may come after
+// arguments.
+func parseFlags(command string, args []string, extra func(fs *flag.FlagSet, cfg *Config)) (*Config, []string) {
+    defaults := config.Defaults()
+	config := &Config{set: make(map[string]bool)}
+    fs := flag.NewFlagSet(command, flag.ExitOnError)
 
 	// Define command-line flags (equivalent to Python's argparse)
-	flag.IntVar(&config.Port, "port", defaultPort, "Port number to run CodeWhisper frontend on")
-    flag.StringVar(&config.Target, "target", ".", "Target directory to analyze")
-    flag.StringVar(&config.Profile, "profile", "", "AWS profile to use")
-    flag.StringVar(&config.Model, "model", "", "Model to use from selected endpoint")
-    flag.StringVar(&config.Endpoint, "endpoint", "openai", "Model endpoint to use (bedrock, google, openai, deepseek)")
-    flag.IntVar(&config.MaxDepth, "max-depth", 15, "Maximum depth for folder structure traversal")
-    flag.BoolVar(&config.Version, "version", false, "Print version information")
-    flag.BoolVar(&config.CheckAuth, "check-auth", false, "Check authentication setup without starting server")
+    fs.StringVar(&config.Target, "target", defaults.Target, "Target directory to analyze")
+    fs.StringVar(&config.Profile, "profile", "", "AWS profile to use")
+    fs.StringVar(&config.Model, "model", "", "Model to use from selected endpoint")
+    fs.StringVar(&config.Endpoint, "endpoint", defaults.Endpoint, "Model endpoint to use (bedrock, anthropic, google, openai, deepseek, ollama)")
+    fs.IntVar(&config.MaxDepth, "max-depth", defaults.MaxDepth, "Maximum depth for folder structure traversal")
+    if extra != nil {
+        extra(fs, config)
+    }
     	
 	// Custom flag for exclude (we'll handle the comma-separated list)
 	var excludeStr string
-    flag.StringVar(&excludeStr, "exclude", "", "Comma-separated list of files/directories to exclude")
+    fs.StringVar(&excludeStr, "exclude", "", "Comma-separated list of files/directories to exclude")
     
-    flag.Parse()
+    var rest []string
+    for {
+        fs.Parse(args)
+        parsed := args[:len(args)-fs.NArg()]
+        if fs.NArg() == 0 || (len(parsed) > 0 && parsed[len(parsed)-1] == "--") {
+            rest = append(rest, fs.Args()...)
+            break
+        }
+        rest = append(rest, fs.Arg(0))
+        args = fs.Args()[1:]
+    }
+    fs.Visit(func(f *flag.Flag) {
+        config.set[f.Name] = true
+    })
 	
     // Process exclude list	
 	if excludeStr != "" {
@@ -185,7 +302,19 @@ func parseFlags() *Config {
 		config.Target = absPath
 	}
 
-	return config
+	return config, rest
+}
+
+// listFlag collects a flag given several times or as a comma-separated list
+type listFlag []string
+
+func (l *listFlag) String() string {
+    return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+    *l = append(*l, parseExcludeList(value)...)
+    return nil
 }
 
 func parseExcludeList(excludeStr string) []string {
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		rest  []string
+		check func(t *testing.T, cfg *Config, files []string)
+		set   []string
+	}{
+		{
+			name: "no arguments",
+			check: func(t *testing.T, cfg *Config, files []string) {
+				if cfg.Model != "" || cfg.Exclude != nil || files != nil {
+					t.Errorf("parsed %+v, files %v", cfg, files)
+				}
+			},
+		},
+		{
+			name: "flags between arguments",
+			args: []string{"-model", "gpt-4o", "how", "--endpoint=openai", "does", "-json", "it", "-max-depth", "3", "work"},
+			rest: []string{"how", "does", "it", "work"},
+			set:  []string{"endpoint", "json", "max-depth", "model"},
+			check: func(t *testing.T, cfg *Config, files []string) {
+				if cfg.Model != "gpt-4o" || cfg.Endpoint != "openai" || !cfg.JSON || cfg.MaxDepth != 3 {
+					t.Errorf("parsed %+v", cfg)
+				}
+			},
+		},
+		{
+			name: "terminator first",
+			args: []string{"--", "-model", "x"},
+			rest: []string{"-model", "x"},
+			check: func(t *testing.T, cfg *Config, files []string) {
+				if cfg.Model != "" {
+					t.Errorf("Model = %q after --", cfg.Model)
+				}
+			},
+		},
+		{
+			name: "terminator after arguments",
+			args: []string{"-json", "what", "--", "-json", "--", "means"},
+			rest: []string{"what", "-json", "--", "means"},
+			set:  []string{"json"},
+		},
+		{
+			name: "repeated list flag",
+			args: []string{"-files", "a.go,b/", "explain", "-files", "c.go", "-exclude", "vendor, *.pb.go"},
+			rest: []string{"explain"},
+			set:  []string{"exclude", "files"},
+			check: func(t *testing.T, cfg *Config, files []string) {
+				if !reflect.DeepEqual(files, []string{"a.go", "b/", "c.go"}) || !reflect.DeepEqual(cfg.Exclude, []string{"vendor", "*.pb.go"}) {
+					t.Errorf("files %q, Exclude %q", files, cfg.Exclude)
+				}
+			},
+		},
+		{
+			name: "relative target",
+			args: []string{"q", "-target", "sub/dir"},
+			rest: []string{"q"},
+			set:  []string{"target"},
+			check: func(t *testing.T, cfg *Config, files []string) {
+				if want := filepath.Join(wd, "sub", "dir"); cfg.Target != want {
+					t.Errorf("Target = %s, want %s", cfg.Target, want)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files listFlag
+			cfg, rest := parseFlags("ask", tt.args, func(fs *flag.FlagSet, cfg *Config) {
+				fs.Var(&files, "files", "")
+				fs.BoolVar(&cfg.JSON, "json", false, "")
+			})
+
+			if !reflect.DeepEqual(rest, tt.rest) {
+				t.Errorf("rest = %q, want %q", rest, tt.rest)
+			}
+			set := make(map[string]bool)
+			for _, name := range tt.set {
+				set[name] = true
+			}
+			if !reflect.DeepEqual(cfg.set, set) {
+				t.Errorf("set = %v, want %v", cfg.set, set)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg, files)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gongzhen/codewhisper-go/internal/agent"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+// maxListedFiles is how many selected files are named before the rest are
+// counted
+const maxListedFiles = 8
+
+// answer is the outcome of one question asked from the terminal
+type answer struct {
+    Text     string
+    Selected []agent.SelectedFile
+    Trimmed  []agent.TrimmedFile
+    Error    string
+    Detail   string
+}
+
+// startTerminal prepares a terminal command. Stdout is kept for answers, so
+// logs go to stderr, and only warnings are shown unless a log level is
+// configured.
+func startTerminal() {
+    utils.Log.SetOutput(os.Stderr)
+    if os.Getenv(config.EnvLogLevel) == "" {
+        utils.Log.SetLevel("WARNING")
+    }
+
+    if err := loadEnvFile(); err != nil {
+        utils.Log.Debug("No .env file loaded: %v", err)
+    }
+}
+
+// resolveFiles expands --files globs into the files they match under the
+// target. Files the ignore rules and configured excludes hide are never
+// matched.
+func resolveFiles(settings config.Config, patterns []string) ([]string, error) {
+    if len(patterns) == 0 {
+        return nil, nil
+    }
+
+    files, err := utils.GlobFiles(settings.Target, patterns, settings.Exclude)
+    if err != nil {
+        return nil, err
+    }
+    if len(files) == 0 {
+        return nil, fmt.Errorf("no files match %s", strings.Join(patterns, ", "))
+    }
+    return files, nil
+}
+
+// streamAnswer asks the agent a question, writing the answer to out as it
+// arrives unless out is nil
+func streamAnswer(ctx context.Context, a *agent.Agent, req agent.ChatRequest, out io.Writer) (*answer, error) {
+    events, err := a.StreamChat(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+
+    result := &answer{}
+    var text strings.Builder
+    for event := range events {
+        switch {
+        case event.Error != "":
+            result.Error, result.Detail = event.Error, event.Detail
+        case len(event.SelectedFiles) > 0:
+            result.Selected = append(result.Selected, event.SelectedFiles...)
+        case len(event.TrimmedFiles) > 0:
+            result.Trimmed = append(result.Trimmed, event.TrimmedFiles...)
+        case event.Content != "":
+            text.WriteString(event.Content)
+            if out != nil {
+                fmt.Fprint(out, event.Content)
+            }
+        }
+    }
+    result.Text = text.String()
+
+    if result.Error == "" && ctx.Err() != nil {
+        result.Error, result.Detail = "canceled", "The answer was interrupted"
+    }
+    return result, nil
+}
+
+// reportContext tells the user which files retrieval picked and which
+// didn't fit in full
+func reportContext(w io.Writer, result *answer) {
+    if n := len(result.Selected); n > 0 {
+        var names []string
+        for _, file := range result.Selected[:min(n, maxListedFiles)] {
+            names = append(names, file.Path)
+        }
+        if n > maxListedFiles {
+            names = append(names, fmt.Sprintf("and %d more", n-maxListedFiles))
+        }
+        fmt.Fprintf(w, "Selected %d relevant files: %s\n", n, strings.Join(names, ", "))
+    }
+
+    for _, file := range result.Trimmed {
+        fmt.Fprintf(w, "Trimmed %s (%d tokens): %s\n", file.Path, file.Tokens, file.Action)
+    }
+}
@@ -4,10 +4,7 @@ go 1.24.4
 
 require (
 	github.com/gorilla/mux v1.8.1
+	github.com/joho/godotenv v1.5.1
 	github.com/rs/cors v1.11.1
-)
-
-require (
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/sashabaranov/go-openai v1.40.5 // indirect
+	github.com/sashabaranov/go-openai v1.40.5
 )
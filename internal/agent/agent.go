@@ -3,28 +3,48 @@ package agent
 import (
 	"context"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
+	"github.com/gongzhen/codewhisper-go/internal/index"
 	"github.com/gongzhen/codewhisper-go/internal/models"
 	"github.com/gongzhen/codewhisper-go/internal/utils"
 	"github.com/gongzhen/codewhisper-go/pkg/config"
 )
 
 type Agent struct {
+    config       *config.Store
     modelManager *models.ModelManager
     fileReader   *FileReader
+    retriever    *Retriever
+    history      *HistoryManager
 }
 
-func NewAgent() (*Agent, error) {
-    modelManager, err := models.NewModelManager()
+func NewAgent(cfg *config.Store) (*Agent, error) {
+    modelManager, err := models.NewModelManager(cfg)
     if err != nil {
         return nil, fmt.Errorf("failed to initialize model manager: %w", err)
     }
     
+    return newAgent(cfg, modelManager), nil
+}
+
+// NewAgentWithProvider creates an agent around an already validated provider
+// instead of the configured one
+func NewAgentWithProvider(cfg *config.Store, endpoint string, provider models.Provider) *Agent {
+    return newAgent(cfg, models.NewModelManagerWith(cfg, endpoint, provider))
+}
+
+func newAgent(cfg *config.Store, modelManager *models.ModelManager) *Agent {
     return &Agent{
+        config:       cfg,
         modelManager: modelManager,
         fileReader:   NewFileReader(),
-    }, nil
+        retriever:    NewRetriever(),
+        history:      NewHistoryManager(),
+    }
 }
 
 type ChatRequest struct {
@@ -42,6 +62,13 @@ type StreamEvent struct {
     Content string `json:"content,omitempty"`
     Error   string `json:"error,omitempty"`
     Detail  string `json:"detail,omitempty"`
+    // SelectedFiles lists the files retrieval added to the context
+    SelectedFiles []SelectedFile `json:"selected_files,omitempty"`
+    // TrimmedFiles lists the selected files that didn't fit in full
+    TrimmedFiles []TrimmedFile `json:"trimmed_files,omitempty"`
+    // SummarizedExchanges is how many older exchanges were replaced by a
+    // summary to fit the context
+    SummarizedExchanges int `json:"summarized_exchanges,omitempty"`
 }
 
 func (a *Agent) StreamChat(ctx context.Context, req ChatRequest) (<-chan StreamEvent, error) {
@@ -64,8 +91,18 @@ func (a *Agent) StreamChat(ctx context.Context, req ChatRequest) (<-chan StreamE
         utils.Log.Info("Stream chat request - Question: %s", req.Input.Question)
         utils.Log.Info("Files to analyze: %d", len(req.Input.Config.Files))
 
-        // Step 1: Build context from selected files
-        codebaseContext, err := a.buildCodebaseContext(req.Input.Config.Files)
+        // Step 1: Fit the chat history, summarizing older exchanges when
+        // there are too many
+        historyBudget := int(float64(a.contextTokenLimit(ctx)) * maxHistoryShare)
+        summary, history := a.history.Fit(ctx, a.modelManager, req.Input.ConversationID, req.Input.ChatHistory, historyBudget)
+        if folded := len(req.Input.ChatHistory) - len(history); folded > 0 {
+            eventChan <- StreamEvent{SummarizedExchanges: folded}
+        }
+
+        // Step 2: Build context from selected files, picking relevant ones
+        // when none or whole directories are selected
+        budget := a.contextBudget(ctx, req.Input.Question, summary, history)
+        codebaseFiles, selected, trimmed, err := a.buildCodebaseContext(ctx, req, budget)
         if err != nil {
             eventChan <- StreamEvent{
                 Error:  "file_error",
@@ -73,25 +110,26 @@ func (a *Agent) StreamChat(ctx context.Context, req ChatRequest) (<-chan StreamE
             }
             return
         }
+        if len(selected) > 0 {
+            eventChan <- StreamEvent{SelectedFiles: selected}
+        }
+        if len(trimmed) > 0 {
+            eventChan <- StreamEvent{TrimmedFiles: trimmed}
+        }
 
-        tokenCount := utils.CountTokens(codebaseContext)
-        utils.Log.Info("Codebase context: %d tokens, %d chars", tokenCount, len(codebaseContext))
-
-        if tokenCount > 180000 {
-            eventChan <- StreamEvent{
-                Error:  "token_limit_exceeded",
-                Detail: "Selected files are too large. Please select fewer files.",
-            }
-            return
+        tokenCount := 0
+        for _, file := range codebaseFiles {
+            tokenCount += fileTokens(file.Path, file.Content)
         }
+        utils.Log.Info("Codebase context: %d tokens, %d files, %d trimmed", tokenCount, len(codebaseFiles), len(trimmed))
 
-        // Step 2: Format prompt
-        fullPrompt := a.formatPrompt(codebaseContext, req.Input.Question, req.Input.ChatHistory)
-        utils.Log.Info("Prompt size: %d chars", len(fullPrompt))
+        // Step 3: Build conversation
+        conversation := a.buildConversation(codebaseFiles, req.Input.Question, summary, history)
+        utils.Log.Info("Conversation has %d messages", len(conversation.Messages))
 
-        // Step 3: Call model
-        utils.Log.Info("Calling OpenAI model...")
-        modelStream, err := a.modelManager.StreamChat(ctx, fullPrompt)
+        // Step 4: Call model
+        utils.Log.Info("Calling model...")
+        modelStream, err := a.modelManager.StreamChat(ctx, conversation)
         if err != nil {
             utils.Log.Error("Model stream error: %v", err)
             eventChan <- StreamEvent{
@@ -101,7 +139,7 @@ func (a *Agent) StreamChat(ctx context.Context, req ChatRequest) (<-chan StreamE
             return
         }
 
-        // Step 4: Forward chunks
+        // Step 5: Forward chunks
         utils.Log.Info("Starting to forward model response chunks...")
         chunkCount := 0
         for chunk := range modelStream {
@@ -141,71 +179,162 @@ func (a *Agent) StreamChat(ctx context.Context, req ChatRequest) (<-chan StreamE
     return eventChan, nil
 }
 
-func (a *Agent) buildCodebaseContext(files []string) (string, error) {
-    userCodebaseDir := config.GetEnv(config.EnvUserCodebaseDir, ".")
+// buildCodebaseContext packs the selected files into budget tokens, in the
+// order they were selected. Files that don't fit in full are included as
+// outlines or excerpts and reported as trimmed. Selected directories, or
+// the whole codebase when nothing is selected, are searched for the files
+// most relevant to the question to fill what remains.
+func (a *Agent) buildCodebaseContext(ctx context.Context, req ChatRequest, budget int) ([]models.FileAttachment, []SelectedFile, []TrimmedFile, error) {
+    cfg := a.config.Get()
+    userCodebaseDir := cfg.Target
+    packer := newContextPacker(userCodebaseDir, cfg.Exclude, budget)
     
-    var builder strings.Builder
-    fileCount := 0
+    var dirs []string
+    explicit := make(map[string]bool)
     
-    for _, filePath := range files {
+    for _, filePath := range req.Input.Config.Files {
+        if info, err := os.Stat(filepath.Join(userCodebaseDir, filePath)); err == nil && info.IsDir() {
+            dirs = append(dirs, filePath)
+            continue
+        }
+        
         content, err := a.fileReader.ReadFile(userCodebaseDir, filePath)
         if err != nil {
             utils.Log.Warning("Skipping file %s: %v", filePath, err)
             continue
         }
         
-        // Add file header and content
-        builder.WriteString(fmt.Sprintf("File: %s\n", filePath))
-        builder.WriteString(content)
-        builder.WriteString("\n\n")
-        fileCount++
+        explicit[filepath.ToSlash(filepath.Clean(filePath))] = true
+        packer.add(filePath, content)
     }
+    packer.trim()
+    
+    utils.Log.Info("Successfully read %d files", len(explicit))
     
-    utils.Log.Info("Successfully read %d files", fileCount)
+    var selected []SelectedFile
+    if len(req.Input.Config.Files) == 0 || len(dirs) > 0 {
+        var picked []models.FileAttachment
+        var overflow []SelectedFile
+        selected, picked, overflow = a.retriever.Select(userCodebaseDir, index.Options{Dir: cfg.IndexDir, Exclude: cfg.Exclude}, dirs, req.Input.Question, packer.budget, explicit)
+        for i, file := range picked {
+            packer.include(file, selected[i].Tokens)
+        }
+        utils.Log.Info("Retrieval picked %d files for the question", len(picked))
+        
+        // Go files that didn't fit in full still show their package's shape
+        outlined := packer.outlinePackages(overflow)
+        selected = append(selected, outlined...)
+        
+        // Relevant files in selected directories were asked for, so say
+        // which didn't make it
+        if len(dirs) > 0 {
+            for _, file := range overflow {
+                trimmed := TrimmedFile{Path: file.Path, Tokens: file.Tokens, Action: TrimDropped}
+                for _, pkg := range outlined {
+                    if pkg.Path == path.Dir(file.Path) {
+                        trimmed.Action = TrimOutline
+                    }
+                }
+                packer.trimmed = append(packer.trimmed, trimmed)
+            }
+        }
+    }
     
-    if fileCount == 0 {
-        return "", fmt.Errorf("no valid files to analyze")
+    if len(packer.files) == 0 {
+        if len(packer.trimmed) > 0 {
+            return nil, nil, nil, fmt.Errorf("the selected files don't fit in the model's context window")
+        }
+        return nil, nil, nil, fmt.Errorf("no valid files to analyze")
     }
     
-    return builder.String(), nil
+    return packer.files, selected, packer.trimmed, nil
 }
 
-func (a *Agent) formatPrompt(codebase, question string, chatHistory [][]string) string {
-    var prompt strings.Builder
-    
-    // System prompt
-    prompt.WriteString(SystemPrompt)
-    prompt.WriteString("\n\n")
+// contextBudget returns how many tokens of codebase fit next to the system
+// prompt, question and chat history
+func (a *Agent) contextBudget(ctx context.Context, question, summary string, history [][]string) int {
+    budget := a.contextTokenLimit(ctx) - utils.CountTokens(SystemPrompt) - utils.CountTokens(question) - utils.CountTokens(summary)
+    for _, exchange := range history {
+        budget -= exchangeTokens(exchange)
+    }
+    return budget
+}
+
+// buildConversation assembles the system prompt, codebase, history and
+// question. A summary of older exchanges follows the codebase.
+func (a *Agent) buildConversation(files []models.FileAttachment, question, summary string, chatHistory [][]string) models.Conversation {
+    conv := models.Conversation{
+        System:   SystemPrompt,
+        Settings: a.modelManager.GenerationSettings(),
+    }
     
-    // Add codebase
-    prompt.WriteString("Current codebase:\n")
-    prompt.WriteString(codebase)
-    prompt.WriteString("\n")
+    // The codebase opens the conversation so every turn can refer to it
+    codebase := models.Message{
+        Role:  models.RoleUser,
+        Parts: []models.ContentPart{models.TextPart("Current codebase:")},
+    }
+    for _, file := range files {
+        codebase.Parts = append(codebase.Parts, models.FilePart(file.Path, file.Content))
+    }
+    if summary != "" {
+        codebase.Parts = append(codebase.Parts, models.TextPart("Summary of our earlier conversation:\n"+summary))
+    }
+    conv.Messages = append(conv.Messages, codebase)
     
     // Add chat history if any
-    if len(chatHistory) > 0 {
-        prompt.WriteString("\nConversation history:\n")
-        for _, exchange := range chatHistory {
-            if len(exchange) >= 2 {
-                prompt.WriteString(fmt.Sprintf("Human: %s\n", exchange[0]))
-                prompt.WriteString(fmt.Sprintf("Assistant: %s\n\n", exchange[1]))
-            }
+    for _, exchange := range chatHistory {
+        if len(exchange) >= 2 {
+            conv.Messages = append(conv.Messages,
+                models.Message{Role: models.RoleUser, Parts: []models.ContentPart{models.TextPart(exchange[0])}},
+                models.Message{Role: models.RoleAssistant, Parts: []models.ContentPart{models.TextPart(exchange[1])}},
+            )
         }
     }
     
     // Add current question
-    prompt.WriteString(fmt.Sprintf("Human: %s\n", question))
-    prompt.WriteString("Assistant: ")
+    conv.Messages = append(conv.Messages, models.Message{
+        Role:  models.RoleUser,
+        Parts: []models.ContentPart{models.TextPart(question)},
+    })
     
-    return prompt.String()
+    return conv
+}
+
+// contextTokenLimit returns how many tokens of codebase fit in the current
+// model's context window once room is left for the response. The response
+// never takes more than half the window, so models whose output limit equals
+// their context window still get room for the codebase.
+func (a *Agent) contextTokenLimit(ctx context.Context) int {
+    spec := a.modelManager.CurrentModelSpec(ctx)
+    
+    reserve := a.modelManager.GenerationSettings().MaxOutputTokens
+    if reserve > spec.MaxOutputTokens {
+        reserve = spec.MaxOutputTokens
+    }
+    if reserve > spec.ContextWindow/2 {
+        reserve = spec.ContextWindow / 2
+    }
+    
+    return spec.ContextWindow - reserve
+}
+
+// ModelManager returns the agent's model manager
+func (a *Agent) ModelManager() *models.ModelManager {
+    return a.modelManager
 }
 
 // GetCurrentModelInfo returns current model information
-func (a *Agent) GetCurrentModelInfo() map[string]interface{} {
+func (a *Agent) GetCurrentModelInfo(ctx context.Context) map[string]interface{} {
+    spec := a.modelManager.CurrentModelSpec(ctx)
+    modelID := a.config.Get().Model
+    if modelID == "" {
+        modelID = spec.ID
+    }
     return map[string]interface{}{
-        "model_id":       config.GetEnv(config.EnvModel, "sonnet3.5-v2"),
-        "endpoint":       config.GetEnv(config.EnvEndpoint, "bedrock"),
-        "max_tokens":     200000,
-        "context_window": 200000,
+        "model_id":          modelID,
+        "endpoint":          spec.Endpoint,
+        "max_tokens":        spec.ContextWindow,
+        "context_window":    spec.ContextWindow,
+        "max_output_tokens": spec.MaxOutputTokens,
     }
-}
\ No newline at end of file
+}
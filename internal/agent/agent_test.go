@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/gongzhen/codewhisper-go/internal/models"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+// stubProvider serves one model whose replies come from reply. It records
+// each conversation sent and counts the streams still sending.
+type stubProvider struct {
+	spec  models.ModelSpec
+	reply func(conv models.Conversation) []models.StreamChunk
+
+	mu      sync.Mutex
+	convs   []models.Conversation
+	streams sync.WaitGroup
+}
+
+func (p *stubProvider) StreamChat(ctx context.Context, conv models.Conversation) (<-chan models.StreamChunk, error) {
+	p.mu.Lock()
+	p.convs = append(p.convs, conv)
+	p.mu.Unlock()
+
+	var chunks []models.StreamChunk
+	if p.reply != nil {
+		chunks = p.reply(conv)
+	}
+	ch := make(chan models.StreamChunk)
+	p.streams.Add(1)
+	go func() {
+		defer p.streams.Done()
+		defer close(ch)
+		for _, chunk := range chunks {
+			select {
+			case ch <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// calls returns the conversations sent so far
+func (p *stubProvider) calls() []models.Conversation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]models.Conversation(nil), p.convs...)
+}
+
+func (p *stubProvider) ValidateAuth() error { return nil }
+
+func (p *stubProvider) GetModelInfo() models.ModelInfo {
+	return models.ModelInfo{ModelID: p.spec.ID, Endpoint: "openai"}
+}
+
+func (p *stubProvider) ListModels(ctx context.Context) ([]models.ModelSpec, error) {
+	return []models.ModelSpec{p.spec}, nil
+}
+
+// newTestAgent returns an agent for a codebase in a temporary directory
+// whose model is served by provider
+func newTestAgent(t *testing.T, provider *stubProvider, flags func(c *config.Config)) *Agent {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(config.EnvUserCodebaseDir, "")
+
+	store, err := config.Load(t.TempDir(), flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newAgent(store, models.NewModelManagerWith(store, "openai", provider))
+}
+
+func TestContextTokenLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		window    int
+		maxOutput int
+		setting   int
+		want      int
+	}{
+		{name: "configured output", window: 128000, maxOutput: 16384, setting: 4096, want: 123904},
+		{name: "model's output limit", window: 200000, maxOutput: 8192, setting: 32000, want: 191808},
+		{name: "output as large as the window", window: 8192, maxOutput: 8192, setting: 8192, want: 4096},
+		{name: "half the window", window: 32768, maxOutput: 32768, setting: 20000, want: 16384},
+		{name: "no output configured", window: 16000, maxOutput: 4096, setting: 0, want: 16000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &stubProvider{spec: models.ModelSpec{ID: "test-model", ContextWindow: tt.window, MaxOutputTokens: tt.maxOutput}}
+			a := newTestAgent(t, provider, func(c *config.Config) { c.Generation.MaxOutputTokens = tt.setting })
+
+			if got := a.contextTokenLimit(context.Background()); got != tt.want {
+				t.Errorf("contextTokenLimit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/models"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+const (
+    // maxHistoryShare is the part of the context window chat history may take
+    maxHistoryShare = 0.25
+    // summaryShare is the part of the history budget kept for the summary
+    summaryShare = 0.25
+    // maxSummaryTokens caps the summary however large the budget
+    maxSummaryTokens = 1500
+    // maxCachedSummaries bounds how many conversations are remembered
+    maxCachedSummaries = 200
+    // summaryReasoningTokens is added to the output limit of models that
+    // reason before answering, since OpenAI's reasoning models and Gemini
+    // 2.5 count their reasoning against it whether thinking is asked for
+    // or not
+    summaryReasoningTokens = 8192
+)
+
+const summaryPrompt = `You keep a running summary of a conversation between a developer and an AI assistant about the developer's codebase. Update the summary with the new exchanges you are given. Keep the questions asked, the answers and conclusions, decisions and code changes agreed on, and the names of files, functions and other identifiers discussed. Leave out pleasantries and detail that later exchanges made obsolete. Reply with the updated summary only, in at most %d words.`
+
+// historySummary is the rolling summary of the oldest exchanges of a
+// conversation
+type historySummary struct {
+    exchanges int    // how many leading exchanges it covers
+    digest    string // of those exchanges, to notice edited history
+    text      string
+    used      time.Time
+}
+
+// HistoryManager keeps chat history within its budget. Recent exchanges
+// stay verbatim while older ones are folded into a summary written by the
+// model, which is cached per conversation and extended as it grows.
+type HistoryManager struct {
+    mu        sync.Mutex
+    summaries map[string]*historySummary
+}
+
+func NewHistoryManager() *HistoryManager {
+    return &HistoryManager{summaries: make(map[string]*historySummary)}
+}
+
+// Fit returns a summary of the older exchanges, empty when none had to be
+// folded, and the recent exchanges to send verbatim, together fitting in
+// budget tokens. Summaries are cached under conversationID when it is set.
+func (h *HistoryManager) Fit(ctx context.Context, mm *models.ModelManager, conversationID string, history [][]string, budget int) (string, [][]string) {
+    tokens := make([]int, len(history))
+    total := 0
+    for i, exchange := range history {
+        tokens[i] = exchangeTokens(exchange)
+        total += tokens[i]
+    }
+    if total <= budget {
+        return "", history
+    }
+
+    summaryBudget := min(int(float64(budget)*summaryShare), maxSummaryTokens)
+    verbatim := budget - summaryBudget
+
+    // The fewest exchanges that must be folded for the rest to fit
+    required, kept := 0, total
+    for required < len(history) && kept > verbatim {
+        kept -= tokens[required]
+        required++
+    }
+
+    cached := h.cached(conversationID, history)
+    if cached != nil && cached.exchanges >= required {
+        return cached.text, history[cached.exchanges:]
+    }
+
+    // Fold down to half the verbatim budget so the next few questions can
+    // reuse this summary
+    split := required
+    for split < len(history) && kept > verbatim/2 {
+        kept -= tokens[split]
+        split++
+    }
+
+    previous, from := "", 0
+    if cached != nil {
+        previous, from = cached.text, cached.exchanges
+    }
+    utils.Log.Info("Summarizing %d older chat exchanges to fit the context", split-from)
+
+    summary, err := h.summarize(ctx, mm, previous, history[from:split], summaryBudget, budget)
+    if err != nil {
+        utils.Log.Warning("Failed to summarize chat history, leaving out %d older exchanges: %v", split, err)
+        return fmt.Sprintf("(%d earlier exchanges of this conversation were left out.)", split), history[split:]
+    }
+
+    h.store(conversationID, &historySummary{
+        exchanges: split,
+        digest:    historyDigest(history[:split]),
+        text:      summary,
+    })
+    return summary, history[split:]
+}
+
+// cached returns the summary of a conversation if the exchanges it covers
+// are unchanged
+func (h *HistoryManager) cached(conversationID string, history [][]string) *historySummary {
+    if conversationID == "" {
+        return nil
+    }
+
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    summary, ok := h.summaries[conversationID]
+    if !ok || summary.exchanges > len(history) || summary.digest != historyDigest(history[:summary.exchanges]) {
+        return nil
+    }
+    summary.used = time.Now()
+    return summary
+}
+
+func (h *HistoryManager) store(conversationID string, summary *historySummary) {
+    if conversationID == "" {
+        return
+    }
+
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    summary.used = time.Now()
+    h.summaries[conversationID] = summary
+
+    if len(h.summaries) > maxCachedSummaries {
+        oldest := ""
+        for id, s := range h.summaries {
+            if oldest == "" || s.used.Before(h.summaries[oldest].used) {
+                oldest = id
+            }
+        }
+        delete(h.summaries, oldest)
+    }
+}
+
+// summarize folds exchanges into the previous summary, a batch at a time so
+// no request to the model exceeds batchTokens
+func (h *HistoryManager) summarize(ctx context.Context, mm *models.ModelManager, previous string, exchanges [][]string, maxTokens, batchTokens int) (string, error) {
+    summary := previous
+    for len(exchanges) > 0 {
+        var batch strings.Builder
+        n, size := 0, 0
+        for n < len(exchanges) {
+            t := exchangeTokens(exchanges[n])
+            if n > 0 && size+t > batchTokens {
+                break
+            }
+            batch.WriteString(formatExchange(exchanges[n]))
+            size += t
+            n++
+        }
+        exchanges = exchanges[n:]
+
+        var err error
+        summary, err = h.update(ctx, mm, summary, batch.String(), maxTokens)
+        if err != nil {
+            return "", err
+        }
+    }
+    return summary, nil
+}
+
+// update asks the model for the summary extended with new exchanges
+func (h *HistoryManager) update(ctx context.Context, mm *models.ModelManager, summary, exchanges string, maxTokens int) (string, error) {
+    settings := mm.GenerationSettings()
+    settings.MaxOutputTokens = maxTokens
+    settings.ThinkingMode = false
+    if spec := mm.CurrentModelSpec(ctx); spec.SupportsThinking {
+        settings.MaxOutputTokens += summaryReasoningTokens
+        if spec.MaxOutputTokens > maxTokens && settings.MaxOutputTokens > spec.MaxOutputTokens {
+            settings.MaxOutputTokens = spec.MaxOutputTokens
+        }
+    }
+
+    var prompt strings.Builder
+    if summary != "" {
+        prompt.WriteString("Summary so far:\n" + summary + "\n\n")
+    }
+    prompt.WriteString("New exchanges:\n\n" + exchanges)
+
+    // Cancelling stops the request if the stream fails part way
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    
+    stream, err := mm.StreamChat(ctx, models.Conversation{
+        // About three words to five tokens
+        System:   fmt.Sprintf(summaryPrompt, maxTokens*3/5),
+        Settings: settings,
+        Messages: []models.Message{{Role: models.RoleUser, Parts: []models.ContentPart{models.TextPart(prompt.String())}}},
+    })
+    if err != nil {
+        return "", err
+    }
+
+    var out strings.Builder
+    for chunk := range stream {
+        if chunk.Error != nil {
+            // Let the provider finish sending once it sees the cancellation
+            cancel()
+            go func() {
+                for range stream {
+                }
+            }()
+            return "", chunk.Error
+        }
+        out.WriteString(chunk.Content)
+    }
+    if strings.TrimSpace(out.String()) == "" {
+        return "", errors.New("the model returned an empty summary")
+    }
+    return strings.TrimSpace(out.String()), nil
+}
+
+func formatExchange(exchange []string) string {
+    var b strings.Builder
+    if len(exchange) > 0 {
+        b.WriteString("User: " + exchange[0] + "\n\n")
+    }
+    if len(exchange) > 1 {
+        b.WriteString("Assistant: " + exchange[1] + "\n\n")
+    }
+    return b.String()
+}
+
+// exchangeTokens returns the tokens an exchange takes in the conversation
+func exchangeTokens(exchange []string) int {
+    return utils.CountTokens(strings.Join(exchange, "\n"))
+}
+
+// historyDigest identifies a run of exchanges
+func historyDigest(exchanges [][]string) string {
+    h := sha256.New()
+    for _, exchange := range exchanges {
+        for _, text := range exchange {
+            h.Write([]byte(text))
+            h.Write([]byte{0})
+        }
+        h.Write([]byte{1})
+    }
+    return hex.EncodeToString(h.Sum(nil))
+}
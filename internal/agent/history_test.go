@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/models"
+)
+
+// testHistory returns n exchanges of about 100 tokens each
+func testHistory(n int) [][]string {
+	history := make([][]string, n)
+	for i := range history {
+		history[i] = []string{
+			fmt.Sprintf("Question %d: how does the walker %s", i, strings.Repeat("skip ignored files ", 10)),
+			fmt.Sprintf("Answer %d: it asks the matcher %s", i, strings.Repeat("before reading a directory ", 10)),
+		}
+	}
+	return history
+}
+
+func historyTokens(history [][]string) int {
+	total := 0
+	for _, exchange := range history {
+		total += exchangeTokens(exchange)
+	}
+	return total
+}
+
+// summarizer replies to each request with a numbered summary
+func summarizer() *stubProvider {
+	p := &stubProvider{spec: models.ModelSpec{ID: "test-model", ContextWindow: 100000, MaxOutputTokens: 4096}}
+	p.reply = func(conv models.Conversation) []models.StreamChunk {
+		return []models.StreamChunk{{Content: "  summary "}, {Content: fmt.Sprint(len(p.calls()))}, {Content: "\n"}}
+	}
+	return p
+}
+
+// prompt returns the text of the n-th request for a summary
+func prompt(p *stubProvider, n int) string {
+	conv := p.calls()[n]
+	var text strings.Builder
+	for _, part := range conv.Messages[0].Parts {
+		text.WriteString(part.Render())
+	}
+	return text.String()
+}
+
+func TestFit(t *testing.T) {
+	p := summarizer()
+	mm := newTestAgent(t, p, nil).modelManager
+	h := NewHistoryManager()
+	ctx := context.Background()
+	history := testHistory(10)
+	budget := historyTokens(history) / 2
+
+	// Nothing is summarized while the history fits
+	if summary, kept := h.Fit(ctx, mm, "c1", history, historyTokens(history)); summary != "" || len(kept) != 10 || len(p.calls()) != 0 {
+		t.Fatalf("Fit within budget = %q, %d exchanges, %d requests", summary, len(kept), len(p.calls()))
+	}
+
+	// More is folded than one request may hold, so it takes a batch at a
+	// time
+	summary, kept := h.Fit(ctx, mm, "c1", history, budget)
+	requests := len(p.calls())
+	if requests < 2 || summary != fmt.Sprint("summary ", requests) {
+		t.Fatalf("Fit = %q after %d requests", summary, requests)
+	}
+	folded := len(history) - len(kept)
+	if historyTokens(kept) > budget-min(budget/4, maxSummaryTokens) {
+		t.Errorf("kept %d tokens of history in a budget of %d", historyTokens(kept), budget)
+	}
+	if text := prompt(p, 0); !strings.Contains(text, "Question 0:") || strings.Contains(text, "Summary so far") {
+		t.Errorf("first request:\n%s", text)
+	}
+	if text := prompt(p, requests-1); !strings.Contains(text, "Summary so far:\nsummary ") ||
+		!strings.Contains(text, fmt.Sprintf("Question %d:", folded-1)) || strings.Contains(text, fmt.Sprintf("Question %d:", folded)) {
+		t.Errorf("last request doesn't end with the last folded exchange:\n%s", text)
+	}
+
+	// The next question reuses the summary
+	history = testHistory(11)
+	again, kept := h.Fit(ctx, mm, "c1", history, budget)
+	if again != summary || len(kept) != len(history)-folded || len(p.calls()) != requests {
+		t.Errorf("Fit after one more exchange = %q, %d exchanges, %d requests", again, len(kept), len(p.calls()))
+	}
+
+	// A longer conversation extends it from where it left off
+	history = testHistory(20)
+	h.Fit(ctx, mm, "c1", history, budget)
+	if len(p.calls()) == requests {
+		t.Fatal("Fit of a longer conversation didn't extend the summary")
+	}
+	if text := prompt(p, requests); !strings.Contains(text, "Summary so far:\n"+summary) || strings.Contains(text, "Question 0:") {
+		t.Errorf("extending request:\n%s", text)
+	}
+	requests = len(p.calls())
+
+	// Editing a summarized exchange starts over
+	history[0] = []string{"Question 0: something else", "Answer 0: another answer"}
+	h.Fit(ctx, mm, "c1", history, budget)
+	if text := prompt(p, requests); strings.Contains(text, "Summary so far") || !strings.Contains(text, "something else") {
+		t.Errorf("request after an edit:\n%s", text)
+	}
+	requests = len(p.calls())
+
+	// Without a conversation ID nothing is cached
+	h.Fit(ctx, mm, "", history, budget)
+	once := len(p.calls()) - requests
+	h.Fit(ctx, mm, "", history, budget)
+	if once == 0 || len(p.calls()) != requests+2*once {
+		t.Errorf("%d requests for two uncached fits, want %d", len(p.calls())-requests, 2*once)
+	}
+}
+
+func TestFitFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply []models.StreamChunk
+	}{
+		{"error part way", []models.StreamChunk{{Content: "partial"}, {Error: errors.New("overloaded")}, {Content: "more"}, {Content: "and more"}}},
+		{"empty summary", []models.StreamChunk{{Content: " \n"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := summarizer()
+			p.reply = func(models.Conversation) []models.StreamChunk { return tt.reply }
+			mm := newTestAgent(t, p, nil).modelManager
+			h := NewHistoryManager()
+			history := testHistory(10)
+			budget := historyTokens(history) / 2
+
+			summary, kept := h.Fit(context.Background(), mm, "c1", history, budget)
+			folded := len(history) - len(kept)
+			if want := fmt.Sprintf("(%d earlier exchanges of this conversation were left out.)", folded); summary != want || folded == 0 {
+				t.Errorf("Fit = %q, want %q", summary, want)
+			}
+
+			// The stream is released rather than left blocked
+			done := make(chan struct{})
+			go func() {
+				p.streams.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the failed stream is still sending")
+			}
+
+			// and the failure isn't cached
+			h.Fit(context.Background(), mm, "c1", history, budget)
+			if len(p.calls()) != 2 {
+				t.Errorf("%d requests, want a retry", len(p.calls()))
+			}
+		})
+	}
+}
+
+func TestSummaryOutputLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  models.ModelSpec
+		extra int
+	}{
+		{"plain model", models.ModelSpec{MaxOutputTokens: 16384}, 0},
+		{"reasoning model", models.ModelSpec{MaxOutputTokens: 100000, SupportsThinking: true}, summaryReasoningTokens},
+		{"reasoning model with a small limit", models.ModelSpec{MaxOutputTokens: 4000, SupportsThinking: true}, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := summarizer()
+			p.spec.MaxOutputTokens, p.spec.SupportsThinking = tt.spec.MaxOutputTokens, tt.spec.SupportsThinking
+			mm := newTestAgent(t, p, nil).modelManager
+
+			if _, err := NewHistoryManager().update(context.Background(), mm, "", "User: hi\n\n", 1000); err != nil {
+				t.Fatal(err)
+			}
+			settings := p.calls()[0].GenerationSettings()
+			want := 1000 + tt.extra
+			if tt.extra < 0 {
+				want = tt.spec.MaxOutputTokens
+			}
+			if settings.MaxOutputTokens != want || settings.ThinkingMode {
+				t.Errorf("MaxOutputTokens = %d, ThinkingMode = %v, want %d without thinking", settings.MaxOutputTokens, settings.ThinkingMode, want)
+			}
+		})
+	}
+}
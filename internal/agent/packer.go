@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gongzhen/codewhisper-go/internal/models"
+	"github.com/gongzhen/codewhisper-go/internal/repomap"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+// How a file that didn't fit in full was included
+const (
+    TrimOutline = "outline" // Go declarations without bodies
+    TrimExcerpt = "excerpt" // the first lines
+    TrimDropped = "dropped" // not at all
+)
+
+// minExcerptTokens is the smallest excerpt worth sending
+const minExcerptTokens = 200
+
+// TrimmedFile is a selected file that didn't fit in the context in full
+type TrimmedFile struct {
+    Path       string `json:"path"`
+    Tokens     int    `json:"tokens"`      // of the whole file
+    KeptTokens int    `json:"kept_tokens"` // of what was sent instead
+    Action     string `json:"action"`
+}
+
+// pendingFile is a file waiting to be trimmed
+type pendingFile struct {
+    path    string
+    content string
+    tokens  int
+}
+
+// contextPacker fills a token budget with files in priority order. Files
+// that don't fit in full are set aside and later included as an outline or
+// an excerpt, sharing what is left of the budget.
+type contextPacker struct {
+    baseDir string
+    exclude []string // configured exclude patterns
+    budget  int
+    files   []models.FileAttachment
+    trimmed []TrimmedFile
+    pending []pendingFile
+}
+
+func newContextPacker(baseDir string, exclude []string, budget int) *contextPacker {
+    return &contextPacker{baseDir: baseDir, exclude: exclude, budget: budget}
+}
+
+// add includes a file in full if it fits, or sets it aside for trim
+func (p *contextPacker) add(path, content string) {
+    tokens := fileTokens(path, content)
+    if tokens <= p.budget {
+        p.include(models.FileAttachment{Path: path, Content: content}, tokens)
+        return
+    }
+    p.pending = append(p.pending, pendingFile{path: path, content: content, tokens: tokens})
+}
+
+// include adds an attachment already known to fit
+func (p *contextPacker) include(file models.FileAttachment, tokens int) {
+    p.budget -= tokens
+    p.files = append(p.files, file)
+}
+
+// trim includes the files set aside in reduced form, in the order they
+// were added, each getting an equal share of the remaining budget
+func (p *contextPacker) trim() {
+    for i, file := range p.pending {
+        share := p.budget / (len(p.pending) - i)
+        reduced, tokens, action := p.reduce(file, share)
+        if action != TrimDropped {
+            p.include(reduced, tokens)
+        }
+        p.trimmed = append(p.trimmed, TrimmedFile{Path: file.path, Tokens: file.tokens, KeptTokens: tokens, Action: action})
+        utils.Log.Info("Trimmed %s to fit the context: %s (%d of %d tokens)", file.path, action, tokens, file.tokens)
+    }
+    p.pending = nil
+}
+
+// reduce shrinks a file to at most share tokens: Go files to their
+// outline, anything to an excerpt
+func (p *contextPacker) reduce(file pendingFile, share int) (models.FileAttachment, int, string) {
+    if strings.HasSuffix(file.path, ".go") {
+        if pkgs, err := repomap.Outline(p.baseDir, file.path, p.exclude); err == nil && len(pkgs) == 1 {
+            outline := models.FileAttachment{Path: file.path + " (outline)", Content: pkgs[0].Outline}
+            if tokens := fileTokens(outline.Path, outline.Content); tokens <= share {
+                return outline, tokens, TrimOutline
+            }
+        }
+    }
+
+    if share >= minExcerptTokens {
+        lines := strings.SplitAfter(file.content, "\n")
+        // Start from the proportional guess and back off
+        for n := len(lines) * share / file.tokens; n > 0; n = n * 9 / 10 {
+            content := strings.Join(lines[:n], "") + fmt.Sprintf("\n... [truncated: showing %d of %d lines]\n", n, len(lines))
+            if tokens := fileTokens(file.path, content); tokens <= share {
+                return models.FileAttachment{Path: file.path, Content: content}, tokens, TrimExcerpt
+            }
+        }
+    }
+
+    return models.FileAttachment{}, 0, TrimDropped
+}
+
+// outlinePackages includes outlines of the Go packages holding the
+// overflow files, most relevant first, as long as they fit. Files already
+// included are left out of the outlines.
+func (p *contextPacker) outlinePackages(overflow []SelectedFile) []SelectedFile {
+    exclude := make(map[string]bool, len(p.files))
+    for _, file := range p.files {
+        exclude[filepath.ToSlash(filepath.Clean(file.Path))] = true
+    }
+    for _, file := range p.trimmed {
+        if file.Action == TrimOutline {
+            exclude[filepath.ToSlash(filepath.Clean(file.Path))] = true
+        }
+    }
+    
+    var outlined []SelectedFile
+    seen := make(map[string]bool)
+    for _, file := range overflow {
+        dir := path.Dir(file.Path)
+        if !strings.HasSuffix(file.Path, ".go") || seen[dir] {
+            continue
+        }
+        seen[dir] = true
+        
+        for _, pkg := range repomap.Build(p.baseDir, []string{dir}, exclude) {
+            name := pkg.Dir + " (Go package outline)"
+            tokens := fileTokens(name, pkg.Outline)
+            if tokens > p.budget {
+                continue
+            }
+            p.include(models.FileAttachment{Path: name, Content: pkg.Outline}, tokens)
+            outlined = append(outlined, SelectedFile{Path: pkg.Dir, Tokens: tokens, Outline: true})
+        }
+    }
+    
+    if len(outlined) > 0 {
+        utils.Log.Info("Added outlines of %d Go packages that didn't fit in full", len(outlined))
+    }
+    return outlined
+}
+
+// fileTokens returns the tokens a file takes in the conversation
+func fileTokens(path, content string) int {
+    return utils.CountTokens(models.FilePart(path, content).Render())
+}
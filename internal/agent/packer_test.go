@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// packerFixture returns a codebase with a large Go file, a large text file
+// and a small file
+func packerFixture(t *testing.T) (string, map[string]string) {
+	t.Helper()
+	var body, notes strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&body, "\tcount += step * %d // accumulate the next term\n", i)
+		fmt.Fprintf(&notes, "Line %d of the design notes, about the walker and its options.\n", i)
+	}
+	files := map[string]string{
+		"calc/sum.go":   "package calc\n\n// Sum adds the terms\nfunc Sum(step int) int {\n\tcount := 0\n" + body.String() + "\treturn count\n}\n",
+		"calc/small.go": "package calc\n\n// Zero is nothing\nconst Zero = 0\n",
+		"calc/mul.go":   "package calc\n\n// Mul multiplies\nfunc Mul(a, b int) int { return a * b }\n",
+		"notes.txt":     notes.String(),
+		"small.txt":     "short\n",
+	}
+	dir := t.TempDir()
+	writeTree(t, dir, files)
+	return dir, files
+}
+
+func TestContextPacker(t *testing.T) {
+	dir, files := packerFixture(t)
+	sum := fileTokens("calc/sum.go", files["calc/sum.go"])
+	notes := fileTokens("notes.txt", files["notes.txt"])
+	small := fileTokens("small.txt", files["small.txt"])
+
+	tests := []struct {
+		name   string
+		add    []string
+		budget int
+		// want is each included path and, for trimmed files, the action
+		want    []string
+		trimmed []string
+	}{
+		{
+			name:   "everything fits",
+			add:    []string{"small.txt", "notes.txt"},
+			budget: small + notes,
+			want:   []string{"small.txt", "notes.txt"},
+		},
+		{
+			name:    "Go file as an outline",
+			add:     []string{"calc/sum.go"},
+			budget:  sum / 2,
+			want:    []string{"calc/sum.go (outline)"},
+			trimmed: []string{"calc/sum.go outline"},
+		},
+		{
+			name:    "other file as an excerpt",
+			add:     []string{"notes.txt"},
+			budget:  notes / 2,
+			want:    []string{"notes.txt"},
+			trimmed: []string{"notes.txt excerpt"},
+		},
+		{
+			name:    "too little room for an excerpt",
+			add:     []string{"small.txt", "notes.txt"},
+			budget:  small + minExcerptTokens - 1,
+			want:    []string{"small.txt"},
+			trimmed: []string{"notes.txt dropped"},
+		},
+		{
+			// The outline leaves most of its share to the excerpt
+			name:    "shared budget",
+			add:     []string{"calc/sum.go", "notes.txt", "small.txt"},
+			budget:  small + notes/2,
+			want:    []string{"small.txt", "calc/sum.go (outline)", "notes.txt"},
+			trimmed: []string{"calc/sum.go outline", "notes.txt excerpt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newContextPacker(dir, nil, tt.budget)
+			for _, name := range tt.add {
+				p.add(name, files[name])
+			}
+			p.trim()
+
+			var got []string
+			used := 0
+			for _, file := range p.files {
+				got = append(got, file.Path)
+				used += fileTokens(file.Path, file.Content)
+			}
+			var trimmed []string
+			for _, file := range p.trimmed {
+				trimmed = append(trimmed, file.Path+" "+file.Action)
+				if file.Tokens != fileTokens(file.Path, files[file.Path]) {
+					t.Errorf("%s: Tokens = %d", file.Path, file.Tokens)
+				}
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+			if strings.Join(trimmed, ",") != strings.Join(tt.trimmed, ",") {
+				t.Errorf("trimmed = %v, want %v", trimmed, tt.trimmed)
+			}
+			if used > tt.budget || p.budget != tt.budget-used {
+				t.Errorf("used %d tokens of %d, %d left", used, tt.budget, p.budget)
+			}
+		})
+	}
+}
+
+func TestContextPackerExcerpt(t *testing.T) {
+	dir, files := packerFixture(t)
+	p := newContextPacker(dir, nil, 500)
+	p.add("notes.txt", files["notes.txt"])
+	p.trim()
+
+	if len(p.files) != 1 || len(p.trimmed) != 1 {
+		t.Fatalf("files %v, trimmed %v", p.files, p.trimmed)
+	}
+	excerpt := p.files[0].Content
+	if !strings.HasPrefix(files["notes.txt"], excerpt[:strings.Index(excerpt, "\n... [truncated")]) {
+		t.Error("excerpt doesn't start the file")
+	}
+	if !strings.HasSuffix(excerpt, " lines]\n") || p.trimmed[0].KeptTokens > 500 || p.trimmed[0].KeptTokens < 400 {
+		t.Errorf("excerpt of %d tokens:\n%s", p.trimmed[0].KeptTokens, excerpt)
+	}
+}
+
+func TestOutlinePackages(t *testing.T) {
+	dir, files := packerFixture(t)
+	small := fileTokens("calc/small.go", files["calc/small.go"])
+
+	// Files already included are left out of the package outline
+	p := newContextPacker(dir, nil, small+200)
+	p.add("calc/small.go", files["calc/small.go"])
+	outlined := p.outlinePackages([]SelectedFile{{Path: "calc/sum.go"}, {Path: "calc/mul.go"}, {Path: "notes.txt"}})
+
+	if len(outlined) != 1 || outlined[0].Path != "calc" || !outlined[0].Outline {
+		t.Fatalf("outlined %+v, want the calc package once", outlined)
+	}
+	outline := p.files[1]
+	if outline.Path != "calc (Go package outline)" || !strings.Contains(outline.Content, "func Sum(step int) int\n") {
+		t.Errorf("outline %s =\n%s", outline.Path, outline.Content)
+	}
+	if strings.Contains(outline.Content, "Zero") {
+		t.Errorf("outline repeats an included file:\n%s", outline.Content)
+	}
+
+	// An outline that doesn't fit is skipped
+	p = newContextPacker(dir, nil, 10)
+	if outlined := p.outlinePackages([]SelectedFile{{Path: "calc/sum.go"}}); len(outlined) != 0 || len(p.files) != 0 {
+		t.Errorf("outlined %+v in 10 tokens", outlined)
+	}
+}
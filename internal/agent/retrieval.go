@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/index"
+	"github.com/gongzhen/codewhisper-go/internal/models"
+	"github.com/gongzhen/codewhisper-go/internal/tokenizer"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+const (
+    // minRelativeScore drops files scoring below this fraction of the best,
+    // which only share common words with the question
+    minRelativeScore = 0.1
+    // maxRetrievalFileSize matches the largest file FileReader accepts
+    maxRetrievalFileSize = 1024 * 1024
+    // minRetrievalTokens is about the smallest file worth attaching; once
+    // less budget remains, no more files are read
+    minRetrievalTokens = 64
+    // maxOverflow bounds the relevant files reported as not fitting
+    maxOverflow = 10
+)
+
+// SelectedFile is a file picked for a question
+type SelectedFile struct {
+    Path    string  `json:"path"`
+    Score   float64 `json:"score"`
+    Tokens  int     `json:"tokens"`
+    // Outline is set when Path is a Go package included as an outline
+    Outline bool    `json:"outline,omitempty"`
+}
+
+// tokenCount is the cached token count of one file
+type tokenCount struct {
+    modTime time.Time
+    size    int64
+    tokens  int // tokens of the rendered file part
+}
+
+// Retriever picks the codebase files most relevant to a question using the
+// code index. Token counts of picked files are cached and only recounted
+// when their size or modification time changes.
+type Retriever struct {
+    mu        sync.Mutex
+    tokens    map[string]tokenCount // keyed by absolute path
+    tokenizer string
+}
+
+func NewRetriever() *Retriever {
+    return &Retriever{tokens: make(map[string]tokenCount)}
+}
+
+// Select ranks the files under dirs, or the whole codebase when dirs is
+// empty, and returns the best ones that fit in budget tokens, best first,
+// along with the best few relevant files that didn't fit. Files in exclude
+// are never picked. opts locates the codebase's index.
+func (r *Retriever) Select(baseDir string, opts index.Options, dirs []string, question string, budget int, exclude map[string]bool) ([]SelectedFile, []models.FileAttachment, []SelectedFile) {
+    query := queryTerms(question)
+    if len(query) == 0 || budget <= 0 {
+        return nil, nil, nil
+    }
+
+    // Token counts depend on the model's tokenizer
+    r.mu.Lock()
+    if name := tokenizer.Default().Name(); name != r.tokenizer {
+        r.tokens = make(map[string]tokenCount)
+        r.tokenizer = name
+    }
+    r.mu.Unlock()
+
+    ix := index.For(baseDir, opts)
+    if err := ix.Refresh(); err != nil {
+        utils.Log.Warning("Code index may be stale: %v", err)
+    }
+    ranked := ix.Rank(query, questionIdentifiers(question), func(rel string) bool {
+        return !exclude[rel] && underAny(rel, dirs)
+    })
+    if len(ranked) == 0 {
+        return nil, nil, nil
+    }
+
+    var selected []SelectedFile
+    var attachments []models.FileAttachment
+    var overflow []SelectedFile
+    cutoff := ranked[0].Score * minRelativeScore
+    for _, file := range ranked {
+        if file.Score < cutoff || budget < minRetrievalTokens {
+            break
+        }
+
+        path := filepath.Join(baseDir, filepath.FromSlash(file.Path))
+        content, tokens, ok := r.read(path, file.Path)
+        if !ok {
+            continue
+        }
+        picked := SelectedFile{Path: file.Path, Score: math.Round(file.Score*100) / 100, Tokens: tokens}
+        if tokens > budget {
+            // A smaller file further down may still fit
+            if len(overflow) < maxOverflow {
+                overflow = append(overflow, picked)
+            }
+            continue
+        }
+
+        budget -= tokens
+        selected = append(selected, picked)
+        attachments = append(attachments, models.FileAttachment{Path: file.Path, Content: content})
+    }
+
+    return selected, attachments, overflow
+}
+
+// read returns a file's content and the tokens it takes in the context,
+// counting them only if the file changed since it was last counted
+func (r *Retriever) read(path, rel string) (string, int, bool) {
+    info, err := os.Stat(path)
+    if err != nil || info.Size() > maxRetrievalFileSize {
+        return "", 0, false
+    }
+    raw, err := os.ReadFile(path)
+    if err != nil {
+        return "", 0, false
+    }
+    content := string(raw)
+
+    r.mu.Lock()
+    count, ok := r.tokens[path]
+    r.mu.Unlock()
+    if ok && count.size == info.Size() && count.modTime.Equal(info.ModTime()) {
+        return content, count.tokens, true
+    }
+
+    count = tokenCount{
+        modTime: info.ModTime(),
+        size:    info.Size(),
+        tokens:  utils.CountTokens(models.FilePart(rel, content).Render()),
+    }
+    r.mu.Lock()
+    r.tokens[path] = count
+    r.mu.Unlock()
+    return content, count.tokens, true
+}
+
+// underAny reports whether rel is inside one of dirs, or dirs is empty
+func underAny(rel string, dirs []string) bool {
+    if len(dirs) == 0 {
+        return true
+    }
+    for _, dir := range dirs {
+        dir = strings.Trim(filepath.ToSlash(filepath.Clean(dir)), "/")
+        if dir == "." || dir == "" || strings.HasPrefix(rel, dir+"/") {
+            return true
+        }
+    }
+    return false
+}
+
+// stopWords are question words that say nothing about which file to read
+var stopWords = map[string]bool{
+    "a": true, "about": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+    "be": true, "by": true, "can": true, "code": true, "could": true, "do": true, "does": true,
+    "explain": true, "file": true, "files": true, "for": true, "from": true, "how": true,
+    "i": true, "in": true, "is": true, "it": true, "me": true, "my": true, "of": true,
+    "on": true, "or": true, "please": true, "should": true, "show": true, "so": true,
+    "that": true, "the": true, "this": true, "to": true, "use": true, "used": true,
+    "we": true, "what": true, "when": true, "where": true, "which": true, "why": true,
+    "with": true, "work": true, "works": true, "would": true, "you": true,
+}
+
+// queryTerms returns the distinct terms of a question
+func queryTerms(question string) []string {
+    seen := make(map[string]bool)
+    var terms []string
+    for _, term := range index.Terms(question) {
+        if !stopWords[term] && !seen[term] {
+            seen[term] = true
+            terms = append(terms, term)
+        }
+    }
+    return terms
+}
+
+// questionIdentifiers returns the lowercased words of a question that look
+// like code names: mixed case, underscores, or followed by ()
+func questionIdentifiers(question string) []string {
+    seen := make(map[string]bool)
+    var idents []string
+    for _, word := range index.Identifiers(question) {
+        lower := strings.ToLower(word)
+        if len(word) < 3 || stopWords[lower] || seen[lower] {
+            continue
+        }
+        if strings.ContainsRune(word, '_') || len(index.SplitIdentifier(word)) > 1 || strings.Contains(question, word+"(") {
+            seen[lower] = true
+            idents = append(idents, lower)
+        }
+    }
+    return idents
+}
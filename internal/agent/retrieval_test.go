@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gongzhen/codewhisper-go/internal/index"
+)
+
+// writeTree creates the files under dir, keyed by slash-separated path,
+// with HOME pointing at an empty directory so no user ignore file applies
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func selectedPaths(files []SelectedFile) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	return paths
+}
+
+func TestSelectRanking(t *testing.T) {
+	dir := t.TempDir()
+	filler := strings.Repeat("the walker reads each directory in turn\n", 3)
+	writeTree(t, dir, map[string]string{
+		"watcher/debounce.go":  "package watcher\n\n// debounce batches events until the tree is quiet\nfunc debounce() {}\n",
+		"watcher/watcher.go":   "package watcher\n\n" + filler + "// see debounce\n",
+		"server/handler.go":    "package server\n\n// the handler calls debounce on each quiet batch\n",
+		"server/unrelated.go":  "package server\n\nfunc serve() {}\n",
+		"vendor/lib/events.go": "package lib\n\n// debounce debounce quiet batch\n",
+		"docs/guide.md":        "Nothing relevant here.\n",
+	})
+	opts := index.Options{Dir: t.TempDir(), Exclude: []string{"vendor"}}
+
+	tests := []struct {
+		name    string
+		dirs    []string
+		exclude map[string]bool
+		want    []string
+	}{
+		{
+			// Files matching more terms, and shorter files, rank first
+			name: "whole codebase",
+			want: []string{"watcher/debounce.go", "server/handler.go", "watcher/watcher.go"},
+		},
+		{
+			// Within the directory "debounce" is common, so the file that
+			// only shares it falls below the relevance cutoff
+			name: "selected directory",
+			dirs: []string{"watcher/"},
+			want: []string{"watcher/debounce.go"},
+		},
+		{name: "already attached", exclude: map[string]bool{"server/handler.go": true}, want: []string{"watcher/debounce.go", "watcher/watcher.go"}},
+		{name: "configured excludes only", dirs: []string{"vendor"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, attachments, overflow := NewRetriever().Select(dir, opts, tt.dirs, "how are quiet debounce batches handled", 10000, tt.exclude)
+			got := selectedPaths(selected)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("selected %v, want %v", got, tt.want)
+			}
+			if len(attachments) != len(selected) || len(overflow) != 0 {
+				t.Errorf("%d attachments and overflow %v for %d files", len(attachments), overflow, len(selected))
+			}
+			for i, a := range attachments {
+				content, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(a.Path)))
+				if a.Path != selected[i].Path || a.Content != string(content) || selected[i].Tokens != fileTokens(a.Path, a.Content) {
+					t.Errorf("attachment %s doesn't match %+v", a.Path, selected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSelectBudget(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a/small.go": "package a\n\n// parser parser parser\n",
+		"a/large.go": "package a\n\n// parser\n" + strings.Repeat("var x = 1 // filler that makes the file large\n", 40),
+	}
+	for i := 0; i < 2*maxOverflow; i++ {
+		files[fmt.Sprintf("b/large%02d.go", i)] = files["a/large.go"]
+	}
+	writeTree(t, dir, files)
+	opts := index.Options{Dir: t.TempDir()}
+	small := fileTokens("a/small.go", files["a/small.go"])
+	large := fileTokens("a/large.go", files["a/large.go"])
+
+	// A file too large for the budget is skipped for a smaller one, and
+	// only the best few are reported
+	selected, _, overflow := NewRetriever().Select(dir, opts, nil, "parser", small+large/2, nil)
+	if got := selectedPaths(selected); len(got) != 1 || got[0] != "a/small.go" {
+		t.Errorf("selected %v, want a/small.go", got)
+	}
+	if len(overflow) != maxOverflow || overflow[0].Tokens != large {
+		t.Errorf("overflow = %v, want %d files of %d tokens", overflow, maxOverflow, large)
+	}
+
+	// Once what is left can't hold a file, nothing more is read
+	selected, _, overflow = NewRetriever().Select(dir, opts, nil, "parser", small+minRetrievalTokens-1, nil)
+	if len(selected) != 1 || len(overflow) != 0 {
+		t.Errorf("selected %v with overflow %v, want only a/small.go", selectedPaths(selected), selectedPaths(overflow))
+	}
+
+	if selected, _, _ := NewRetriever().Select(dir, opts, nil, "parser", 0, nil); selected != nil {
+		t.Errorf("selected %v with no budget", selectedPaths(selected))
+	}
+	if selected, _, _ := NewRetriever().Select(dir, opts, nil, "how does it work", 1000, nil); selected != nil {
+		t.Errorf("selected %v for a question of stop words", selectedPaths(selected))
+	}
+}
@@ -0,0 +1,340 @@
+// Package conversations stores chat conversations on disk so they can be
+// shared between browsers, machines and the command line. Each
+// conversation is a JSON file under ~/.codewhisper/conversations, or the
+// configured conversation directory.
+package conversations
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message roles, named as the frontend names them
+const (
+	RoleHuman     = "human"
+	RoleAssistant = "assistant"
+)
+
+// maxTitleLength is how much of the first question becomes the title
+const maxTitleLength = 60
+
+var (
+	// ErrNotFound is returned for a conversation that doesn't exist
+	ErrNotFound = errors.New("conversation not found")
+	// ErrExists is returned when creating a conversation whose ID is taken
+	ErrExists = errors.New("conversation already exists")
+	// ErrConflict is returned when saving over a version other than the one
+	// the client read
+	ErrConflict = errors.New("conversation was changed since it was read")
+	// ErrInvalidID is returned when writing under an ID that isn't a safe
+	// file name
+	ErrInvalidID = errors.New("invalid conversation ID")
+)
+
+// validID keeps IDs usable as file names
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// Message is one turn of a conversation
+type Message struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	Timestamp int64  `json:"timestamp,omitempty"` // Unix milliseconds
+}
+
+// Conversation is a stored conversation. Version is incremented on every
+// write.
+type Conversation struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Messages  []Message `json:"messages"`
+	CreatedAt int64     `json:"created_at"` // Unix milliseconds
+	UpdatedAt int64     `json:"updated_at"`
+	Version   int       `json:"version"`
+}
+
+// Summary describes a conversation without its messages
+type Summary struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	MessageCount int    `json:"message_count"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// History returns the conversation as question and answer pairs, the form
+// chat requests carry. A trailing question without an answer is left out.
+func (c *Conversation) History() [][]string {
+	var history [][]string
+	var question *string
+	for i := range c.Messages {
+		msg := &c.Messages[i]
+		switch {
+		case msg.Role == RoleHuman:
+			question = &msg.Content
+		case msg.Role == RoleAssistant && question != nil:
+			history = append(history, []string{*question, msg.Content})
+			question = nil
+		}
+	}
+	return history
+}
+
+// Store keeps conversations in a directory, one file each. It is safe for
+// concurrent use.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open returns the store in dir, or in ~/.codewhisper/conversations when dir
+// is empty, creating the directory if needed
+func Open(dir string) (*Store, error) {
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		dir = filepath.Join(home, ".codewhisper", "conversations")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create conversation directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// List returns every conversation, most recently updated first
+func (s *Store) List() ([]Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []Summary{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !validID.MatchString(id) {
+			continue
+		}
+		c, err := s.read(id)
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, Summary{
+			ID:           c.ID,
+			Title:        c.Title,
+			MessageCount: len(c.Messages),
+			CreatedAt:    c.CreatedAt,
+			UpdatedAt:    c.UpdatedAt,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt > summaries[j].UpdatedAt
+	})
+	return summaries, nil
+}
+
+// Get returns a conversation
+func (s *Store) Get(id string) (*Conversation, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read(id)
+}
+
+// Create stores a new conversation, giving it an ID unless it has one and
+// a title from its first question unless it has one
+func (s *Store) Create(c *Conversation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c.ID == "" {
+		c.ID = newID()
+	} else if !validID.MatchString(c.ID) {
+		return fmt.Errorf("%w %q", ErrInvalidID, c.ID)
+	}
+	if _, err := os.Stat(s.path(c.ID)); err == nil {
+		return ErrExists
+	}
+
+	now := time.Now().UnixMilli()
+	c.CreatedAt, c.UpdatedAt, c.Version = now, now, 1
+	if c.Messages == nil {
+		c.Messages = []Message{}
+	}
+	if c.Title == "" {
+		c.Title = title(c.Messages)
+	}
+	return s.write(c)
+}
+
+// Save replaces a conversation's title and messages, creating it if it
+// doesn't exist. A non-zero c.Version is the version the caller read: when
+// the stored conversation has moved on, or is gone, Save returns
+// ErrConflict and writes nothing. A zero c.Version overwrites whatever is
+// stored.
+func (s *Store) Save(c *Conversation) error {
+	if !validID.MatchString(c.ID) {
+		return fmt.Errorf("%w %q", ErrInvalidID, c.ID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.read(c.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	stored := 0
+	if existing != nil {
+		stored = existing.Version
+	}
+	if c.Version != 0 && c.Version != stored {
+		return ErrConflict
+	}
+
+	now := time.Now().UnixMilli()
+	c.CreatedAt, c.UpdatedAt, c.Version = now, now, stored+1
+	if existing != nil {
+		c.CreatedAt = existing.CreatedAt
+	}
+	if c.Messages == nil {
+		c.Messages = []Message{}
+	}
+	if c.Title == "" {
+		c.Title = title(c.Messages)
+	}
+	return s.write(c)
+}
+
+// Append adds messages to a conversation, creating it if it doesn't exist
+func (s *Store) Append(id string, messages ...Message) (*Conversation, error) {
+	if !validID.MatchString(id) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidID, id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	c, err := s.read(id)
+	if errors.Is(err, ErrNotFound) {
+		c = &Conversation{ID: id, CreatedAt: now}
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range messages {
+		if msg.Timestamp == 0 {
+			msg.Timestamp = now
+		}
+		c.Messages = append(c.Messages, msg)
+	}
+	if c.Title == "" {
+		c.Title = title(c.Messages)
+	}
+	c.UpdatedAt = now
+	c.Version++
+	return c, s.write(c)
+}
+
+// Delete removes a conversation
+func (s *Store) Delete(id string) error {
+	if !validID.MatchString(id) {
+		return ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// read loads a conversation. The caller holds mu.
+func (s *Store) read(id string) (*Conversation, error) {
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var c Conversation
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to read conversation %s: %w", id, err)
+	}
+	c.ID = id
+	return &c, nil
+}
+
+// write stores a conversation atomically. The caller holds mu.
+func (s *Store) write(c *Conversation) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, c.ID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(c.ID))
+}
+
+// title names a conversation after its first question, if it has one
+func title(messages []Message) string {
+	for _, msg := range messages {
+		if msg.Role != RoleHuman {
+			continue
+		}
+		text := strings.Join(strings.Fields(msg.Content), " ")
+		if runes := []rune(text); len(runes) > maxTitleLength {
+			text = strings.TrimSpace(string(runes[:maxTitleLength])) + "…"
+		}
+		return text
+	}
+	return ""
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,229 @@
+package conversations
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "conversations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestCreate(t *testing.T) {
+	store := openTestStore(t)
+
+	c := &Conversation{Messages: []Message{
+		{Role: RoleHuman, Content: "  How does   the walker\nskip ignored files?"},
+		{Role: RoleAssistant, Content: "It asks the matcher."},
+	}}
+	if err := store.Create(c); err != nil {
+		t.Fatal(err)
+	}
+	if !validID.MatchString(c.ID) || c.Version != 1 || c.CreatedAt == 0 {
+		t.Errorf("created %+v", c)
+	}
+	if c.Title != "How does the walker skip ignored files?" {
+		t.Errorf("Title = %q", c.Title)
+	}
+
+	got, err := store.Get(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != c.Title || len(got.Messages) != 2 || got.Version != 1 {
+		t.Errorf("Get = %+v", got)
+	}
+
+	if err := store.Create(&Conversation{ID: c.ID}); !errors.Is(err, ErrExists) {
+		t.Errorf("Create over an existing ID = %v, want ErrExists", err)
+	}
+
+	long := &Conversation{ID: "long", Messages: []Message{{Role: RoleHuman, Content: strings.Repeat("é", 100)}}}
+	if err := store.Create(long); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("é", maxTitleLength) + "…"; long.Title != want {
+		t.Errorf("Title = %q, want %q", long.Title, want)
+	}
+	if long.Messages == nil {
+		t.Error("Messages is nil")
+	}
+}
+
+func TestSave(t *testing.T) {
+	store := openTestStore(t)
+
+	c := &Conversation{ID: "abc", Messages: []Message{{Role: RoleHuman, Content: "first"}}}
+	if err := store.Save(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 1 || c.Title != "first" {
+		t.Errorf("saved %+v", c)
+	}
+	created := c.CreatedAt
+
+	// Saving the version that was read succeeds and moves it on
+	c = &Conversation{ID: "abc", Title: "Renamed", Version: 1}
+	if err := store.Save(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 2 || c.CreatedAt != created || c.Messages == nil {
+		t.Errorf("saved %+v", c)
+	}
+
+	// A stale version is rejected and leaves the stored copy alone
+	stale := &Conversation{ID: "abc", Title: "Stale", Version: 1}
+	if err := store.Save(stale); !errors.Is(err, ErrConflict) {
+		t.Errorf("Save of a stale version = %v, want ErrConflict", err)
+	}
+	if got, _ := store.Get("abc"); got.Title != "Renamed" || got.Version != 2 {
+		t.Errorf("after the conflict Get = %+v", got)
+	}
+
+	// So is a version of a conversation that is gone
+	if err := store.Save(&Conversation{ID: "gone", Version: 3}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Save of a deleted conversation = %v, want ErrConflict", err)
+	}
+	if _, err := store.Get("gone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after the conflict = %v, want ErrNotFound", err)
+	}
+
+	// No version overwrites whatever is stored
+	c = &Conversation{ID: "abc", Title: "Forced"}
+	if err := store.Save(c); err != nil || c.Version != 3 {
+		t.Errorf("unconditional Save = %v, version %d", err, c.Version)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	store := openTestStore(t)
+
+	c, err := store.Append("new", Message{Role: RoleHuman, Content: "question"}, Message{Role: RoleAssistant, Content: "answer", Timestamp: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 1 || c.Title != "question" || c.CreatedAt == 0 {
+		t.Errorf("appended %+v", c)
+	}
+	if c.Messages[0].Timestamp == 0 || c.Messages[1].Timestamp != 5 {
+		t.Errorf("timestamps = %d, %d", c.Messages[0].Timestamp, c.Messages[1].Timestamp)
+	}
+
+	c, err = store.Append("new", Message{Role: RoleHuman, Content: "follow-up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 2 || len(c.Messages) != 3 || c.Title != "question" {
+		t.Errorf("appended %+v", c)
+	}
+
+	history := c.History()
+	if len(history) != 1 || history[0][0] != "question" || history[0][1] != "answer" {
+		t.Errorf("History = %v", history)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	store := openTestStore(t)
+
+	if err := store.Create(&Conversation{ID: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete("abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	store := openTestStore(t)
+
+	for _, id := range []string{"a", "b"} {
+		if err := store.Create(&Conversation{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Append("a", Message{Role: RoleHuman, Content: "later"}); err != nil {
+		t.Fatal(err)
+	}
+	// Files that aren't conversations are skipped
+	os.WriteFile(filepath.Join(store.dir, "notes.txt"), []byte("x"), 0600)
+	os.WriteFile(filepath.Join(store.dir, "broken.json"), []byte("{"), 0600)
+
+	summaries, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("List = %+v", summaries)
+	}
+	if summaries[0].UpdatedAt < summaries[1].UpdatedAt || (summaries[0].UpdatedAt == summaries[1].UpdatedAt && summaries[0].ID != "a") {
+		t.Errorf("List order = %+v", summaries)
+	}
+}
+
+func TestInvalidIDs(t *testing.T) {
+	root := t.TempDir()
+	store, err := Open(filepath.Join(root, "conversations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.json"), []byte(`{"title":"secret"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{
+		"../secret",
+		"..",
+		".",
+		"a/b",
+		`a\b`,
+		"/etc/passwd",
+		"%2e%2e%2fsecret",
+		"abc.json",
+		"a b",
+		"a\x00b",
+		strings.Repeat("a", 129),
+	}
+	for _, id := range ids {
+		if _, err := store.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want ErrNotFound", id, err)
+		}
+		if err := store.Delete(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete(%q) = %v, want ErrNotFound", id, err)
+		}
+		if err := store.Create(&Conversation{ID: id}); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Create(%q) = %v, want ErrInvalidID", id, err)
+		}
+		if err := store.Save(&Conversation{ID: id}); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Save(%q) = %v, want ErrInvalidID", id, err)
+		}
+		if _, err := store.Append(id, Message{Role: RoleHuman, Content: "x"}); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Append(%q) = %v, want ErrInvalidID", id, err)
+		}
+	}
+
+	if err := store.Save(&Conversation{ID: ""}); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Save without an ID = %v, want ErrInvalidID", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "secret.json")); err != nil {
+		t.Errorf("file outside the store was touched: %v", err)
+	}
+	entries, _ := os.ReadDir(store.dir)
+	if len(entries) != 0 {
+		t.Errorf("store holds %d files after invalid writes", len(entries))
+	}
+}
@@ -0,0 +1,274 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxFuzz is the maximum number of leading/trailing context lines that may be
+// ignored when locating a hunk, same as patch(1)'s default fuzz factor
+const MaxFuzz = 2
+
+// Hunk statuses reported to the frontend
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// HunkResult describes what happened to a single hunk
+type HunkResult struct {
+	File      string `json:"file,omitempty"`
+	Index     int    `json:"index"`
+	Status    string `json:"status"`
+	StartLine int    `json:"start_line"`
+	Offset    int    `json:"offset"`
+	Fuzz      int    `json:"fuzz"`
+	Reason    string `json:"reason,omitempty"`
+
+	// IgnoredWhitespace is set when the hunk only matched after normalizing whitespace
+	IgnoredWhitespace bool `json:"ignored_whitespace,omitempty"`
+	// Closest is the region of the original file that best resembles a failed hunk
+	Closest *Region `json:"closest,omitempty"`
+}
+
+// match is a location where a hunk's old block was found
+type match struct {
+	pos        int // index in the file of the first matched line
+	trimTop    int // leading context lines dropped by fuzz
+	trimBottom int // trailing context lines dropped by fuzz
+	ignoreWS   bool
+}
+
+// fileLines is a file split into lines along with its line ending style
+type fileLines struct {
+	lines           []string
+	crlf            bool
+	trailingNewline bool
+}
+
+func splitLines(content string) fileLines {
+	fl := fileLines{
+		crlf:            strings.Contains(content, "\r\n"),
+		trailingNewline: content == "" || strings.HasSuffix(content, "\n"),
+	}
+	if content == "" {
+		return fl
+	}
+
+	content = strings.TrimSuffix(content, "\n")
+	for _, line := range strings.Split(content, "\n") {
+		fl.lines = append(fl.lines, strings.TrimSuffix(line, "\r"))
+	}
+	return fl
+}
+
+func (fl fileLines) String() string {
+	if len(fl.lines) == 0 {
+		return ""
+	}
+	sep := "\n"
+	if fl.crlf {
+		sep = "\r\n"
+	}
+	out := strings.Join(fl.lines, sep)
+	if fl.trailingNewline {
+		out += sep
+	}
+	return out
+}
+
+// ApplyHunks applies hunks in order to content. Hunks that cannot be located
+// are skipped and reported as failed; the rest are still applied.
+func ApplyHunks(content string, hunks []*Hunk) (string, []HunkResult) {
+	fl := splitLines(content)
+	original := fl.lines
+	results := make([]HunkResult, 0, len(hunks))
+
+	delta := 0  // line count change from the hunks applied so far
+	minPos := 0 // hunks may not overlap a previously applied hunk
+
+	for i, h := range hunks {
+		result := HunkResult{Index: i, StartLine: h.OldStart}
+		expected := expectedPosition(h) + delta
+
+		m, ok := locate(fl.lines, h, expected, minPos)
+		if !ok {
+			result.Status = StatusFailed
+			result.Reason = failureReason(fl.lines, h, expected, minPos)
+			result.Closest = closestRegion(original, h.OldBlock(), expectedPosition(h))
+			results = append(results, result)
+			continue
+		}
+
+		body := h.Lines[m.trimTop : len(h.Lines)-m.trimBottom]
+		replacement, consumed := buildReplacement(fl.lines[m.pos:], body)
+
+		if h.NoNewlineAtEnd && m.pos+consumed == len(fl.lines) && m.trimBottom == 0 {
+			fl.trailingNewline = false
+		}
+
+		updated := make([]string, 0, len(fl.lines)-consumed+len(replacement))
+		updated = append(updated, fl.lines[:m.pos]...)
+		updated = append(updated, replacement...)
+		updated = append(updated, fl.lines[m.pos+consumed:]...)
+		fl.lines = updated
+
+		result.Status = StatusSuccess
+		result.StartLine = m.pos - m.trimTop + 1 - delta
+		result.Offset = m.pos - m.trimTop - expected
+		result.Fuzz = max(m.trimTop, m.trimBottom)
+		if m.ignoreWS {
+			result.IgnoredWhitespace = true
+			result.Reason = "applied ignoring whitespace differences"
+		}
+		results = append(results, result)
+
+		delta += len(replacement) - consumed
+		minPos = m.pos + len(replacement)
+	}
+
+	return fl.String(), results
+}
+
+// expectedPosition returns the 0-based line index the hunk header points at
+func expectedPosition(h *Hunk) int {
+	if len(h.OldBlock()) == 0 {
+		// A pure insertion's old start is the line after which to insert
+		return h.OldStart
+	}
+	return max(h.OldStart-1, 0)
+}
+
+// locate finds where a hunk applies, trying an exact match first and then
+// progressively looser ones
+func locate(lines []string, h *Hunk, expected, minPos int) (match, bool) {
+	lead, trail := contextEdges(h)
+
+	for fuzz := 0; fuzz <= MaxFuzz; fuzz++ {
+		m := match{trimTop: min(fuzz, lead), trimBottom: min(fuzz, trail)}
+		if fuzz > 0 && m.trimTop < fuzz && m.trimBottom < fuzz {
+			// Nothing left to drop at this fuzz level
+			continue
+		}
+
+		old := oldLines(h.Lines[m.trimTop : len(h.Lines)-m.trimBottom])
+		if len(old) == 0 {
+			if len(h.OldBlock()) > 0 {
+				// Dropping context must not leave nothing to anchor on
+				continue
+			}
+			m.pos = min(max(expected, minPos), len(lines))
+			return m, true
+		}
+
+		for _, ignoreWS := range []bool{false, true} {
+			m.ignoreWS = ignoreWS
+			if pos, ok := search(lines, old, expected+m.trimTop, minPos, ignoreWS); ok {
+				m.pos = pos
+				return m, true
+			}
+		}
+	}
+
+	return match{}, false
+}
+
+// contextEdges counts the context lines before the first and after the last change
+func contextEdges(h *Hunk) (int, int) {
+	lead := 0
+	for lead < len(h.Lines) && h.Lines[lead].Kind == LineContext {
+		lead++
+	}
+	if lead == len(h.Lines) {
+		return lead, 0
+	}
+	trail := 0
+	for trail < len(h.Lines) && h.Lines[len(h.Lines)-1-trail].Kind == LineContext {
+		trail++
+	}
+	return lead, trail
+}
+
+// search looks for block in lines, starting at expected and moving outwards
+func search(lines, block []string, expected, minPos int, ignoreWS bool) (int, bool) {
+	last := len(lines) - len(block)
+	if last < minPos {
+		return 0, false
+	}
+	expected = min(max(expected, minPos), last)
+
+	for dist := 0; ; dist++ {
+		before, after := expected-dist, expected+dist
+		if before < minPos && after > last {
+			return 0, false
+		}
+		if before >= minPos && blockMatches(lines, block, before, ignoreWS) {
+			return before, true
+		}
+		if dist > 0 && after <= last && blockMatches(lines, block, after, ignoreWS) {
+			return after, true
+		}
+	}
+}
+
+func blockMatches(lines, block []string, pos int, ignoreWS bool) bool {
+	for i, want := range block {
+		if !linesEqual(lines[pos+i], want, ignoreWS) {
+			return false
+		}
+	}
+	return true
+}
+
+func linesEqual(a, b string, ignoreWS bool) bool {
+	if a == b {
+		return true
+	}
+	if !ignoreWS {
+		return false
+	}
+	return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+}
+
+// oldLines returns the text of context and removed lines
+func oldLines(body []Line) []string {
+	old := make([]string, 0, len(body))
+	for _, l := range body {
+		if l.Kind != LineAdded {
+			old = append(old, l.Text)
+		}
+	}
+	return old
+}
+
+// buildReplacement walks the hunk body against the matched file lines and
+// returns the new lines plus how many file lines they replace. Context lines
+// keep the file's text so whitespace-insensitive matches don't rewrite them.
+func buildReplacement(fileLines []string, body []Line) ([]string, int) {
+	var out []string
+	consumed := 0
+	for _, l := range body {
+		switch l.Kind {
+		case LineContext:
+			out = append(out, fileLines[consumed])
+			consumed++
+		case LineRemoved:
+			consumed++
+		case LineAdded:
+			out = append(out, l.Text)
+		}
+	}
+	return out, consumed
+}
+
+// failureReason explains why a hunk could not be located
+func failureReason(lines []string, h *Hunk, expected, minPos int) string {
+	old := h.OldBlock()
+	if len(old) > len(lines) {
+		return fmt.Sprintf("hunk expects %d lines but file has only %d", len(old), len(lines))
+	}
+	if _, ok := search(lines, old, expected, 0, true); ok && minPos > 0 {
+		return "hunk overlaps a previously applied hunk"
+	}
+	return "could not find matching context in file"
+}
@@ -0,0 +1,262 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mustParse parses a diff that a test expects to be valid
+func mustParse(t *testing.T, text string) []*FilePatch {
+	t.Helper()
+	patches, err := Parse(text)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return patches
+}
+
+func TestApplyHunks(t *testing.T) {
+	const file = "a\nb\nc\nd\ne\n"
+
+	tests := []struct {
+		name    string
+		content string
+		diff    string
+		want    string
+		status  string
+		offset  int
+		fuzz    int
+		ws      bool
+	}{
+		{
+			name:    "exact",
+			content: file,
+			diff:    "@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n",
+			want:    "a\nb\nC\nd\ne\n",
+			status:  StatusSuccess,
+		},
+		{
+			name:    "offset",
+			content: "x\ny\n" + file,
+			diff:    "@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n",
+			want:    "x\ny\na\nb\nC\nd\ne\n",
+			status:  StatusSuccess,
+			offset:  2,
+		},
+		{
+			name:    "fuzz drops mismatched context",
+			content: file,
+			diff:    "@@ -2,3 +2,3 @@\n B changed\n-c\n+C\n d\n",
+			want:    "a\nb\nC\nd\ne\n",
+			status:  StatusSuccess,
+			fuzz:    1,
+		},
+		{
+			name:    "whitespace differences",
+			content: "func f() {\n\treturn  1\n}\n",
+			diff:    "@@ -1,3 +1,3 @@\n func f() {\n-    return 1\n+\treturn 2\n }\n",
+			want:    "func f() {\n\treturn 2\n}\n",
+			status:  StatusSuccess,
+			ws:      true,
+		},
+		{
+			name:    "pure insertion",
+			content: file,
+			diff:    "@@ -5,0 +6,1 @@\n+f\n",
+			want:    file + "f\n",
+			status:  StatusSuccess,
+		},
+		{
+			name:    "rejected",
+			content: file,
+			diff:    "@@ -2,3 +2,3 @@\n p\n-q\n+Q\n r\n",
+			want:    file,
+			status:  StatusFailed,
+		},
+		{
+			name:    "no newline at end",
+			content: file,
+			diff:    "@@ -5 +5 @@\n-e\n+E\n\\ No newline at end of file\n",
+			want:    "a\nb\nc\nd\nE",
+			status:  StatusSuccess,
+		},
+		{
+			name:    "keeps CRLF",
+			content: "a\r\nb\r\n",
+			diff:    "@@ -1,2 +1,2 @@\n a\n-b\n+B\n",
+			want:    "a\r\nB\r\n",
+			status:  StatusSuccess,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches := mustParse(t, tt.diff)
+			got, results := ApplyHunks(tt.content, patches[0].Hunks)
+			if got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			r := results[0]
+			if r.Status != tt.status {
+				t.Fatalf("status = %s (%s), want %s", r.Status, r.Reason, tt.status)
+			}
+			if r.Status == StatusFailed {
+				if r.Reason == "" || r.Closest == nil {
+					t.Errorf("failed hunk has reason %q and closest %v", r.Reason, r.Closest)
+				}
+				return
+			}
+			if r.Offset != tt.offset || r.Fuzz != tt.fuzz || r.IgnoredWhitespace != tt.ws {
+				t.Errorf("offset, fuzz, whitespace = %d, %d, %v, want %d, %d, %v",
+					r.Offset, r.Fuzz, r.IgnoredWhitespace, tt.offset, tt.fuzz, tt.ws)
+			}
+		})
+	}
+}
+
+func TestApplyHunksPartial(t *testing.T) {
+	diff := "@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -3,2 +3,2 @@\n-missing\n+M\n d\n@@ -4,2 +4,2 @@\n d\n-e\n+E\n"
+	got, results := ApplyHunks("a\nb\nc\nd\ne\n", mustParse(t, diff)[0].Hunks)
+
+	if want := "A\nb\nc\nd\nE\n"; got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+	statuses := make([]string, len(results))
+	for i, r := range results {
+		statuses[i] = r.Status
+	}
+	if want := "success failed success"; strings.Join(statuses, " ") != want {
+		t.Errorf("statuses = %v, want %s", statuses, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		diff   string
+		status string
+		error  string
+		want   map[string]string // "" means the file must not exist
+	}{
+		{
+			name:   "modify",
+			files:  map[string]string{"a.txt": "one\ntwo\n"},
+			diff:   "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+2\n",
+			status: ResultSuccess,
+			want:   map[string]string{"a.txt": "one\n2\n"},
+		},
+		{
+			name:   "create",
+			diff:   "--- /dev/null\n+++ b/dir/new.txt\n@@ -0,0 +1,2 @@\n+hello\n+world\n",
+			status: ResultSuccess,
+			want:   map[string]string{"dir/new.txt": "hello\nworld\n"},
+		},
+		{
+			name:   "create over existing file",
+			files:  map[string]string{"new.txt": "already here\n"},
+			diff:   "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+hello\n",
+			status: ResultFailed,
+			error:  "file already exists",
+			want:   map[string]string{"new.txt": "already here\n"},
+		},
+		{
+			name:   "delete",
+			files:  map[string]string{"old.txt": "hello\nworld\n"},
+			diff:   "diff --git a/old.txt b/old.txt\ndeleted file mode 100644\n--- a/old.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-hello\n-world\n",
+			status: ResultSuccess,
+			want:   map[string]string{"old.txt": ""},
+		},
+		{
+			name:   "delete with uncovered content",
+			files:  map[string]string{"old.txt": "hello\nworld\nmore\n"},
+			diff:   "--- a/old.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-hello\n-world\n",
+			status: ResultFailed,
+			error:  "not covered by the diff",
+			want:   map[string]string{"old.txt": "hello\nworld\nmore\n"},
+		},
+		{
+			name:   "rename",
+			files:  map[string]string{"from.txt": "x\n"},
+			diff:   "diff --git a/from.txt b/to.txt\nrename from from.txt\nrename to to.txt\n--- a/from.txt\n+++ b/to.txt\n@@ -1 +1 @@\n-x\n+y\n",
+			status: ResultSuccess,
+			want:   map[string]string{"from.txt": "", "to.txt": "y\n"},
+		},
+		{
+			name:   "missing file",
+			diff:   "--- a/nope.txt\n+++ b/nope.txt\n@@ -1 +1 @@\n-x\n+y\n",
+			status: ResultFailed,
+			error:  "file not found",
+		},
+		{
+			name:   "path escaping the root",
+			diff:   "--- a/../escape.txt\n+++ b/../escape.txt\n@@ -0,0 +1 @@\n+x\n",
+			status: ResultFailed,
+			error:  "outside base directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "root")
+			for name, content := range tt.files {
+				writeTestFile(t, filepath.Join(dir, name), content)
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := Apply(dir, mustParse(t, tt.diff), Options{})
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if result.Status != tt.status {
+				t.Errorf("status = %s, want %s (%+v)", result.Status, tt.status, result.Files)
+			}
+			if got := result.Files[0].Error; !strings.Contains(got, tt.error) || (tt.error == "") != (got == "") {
+				t.Errorf("error = %q, want it to mention %q", got, tt.error)
+			}
+
+			for name, want := range tt.want {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				switch {
+				case want == "" && !os.IsNotExist(err):
+					t.Errorf("%s should not exist", name)
+				case want != "" && string(data) != want:
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape.txt")); err == nil {
+				t.Error("a file was written outside the root")
+			}
+		})
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "one\n")
+
+	result, err := Apply(dir, mustParse(t, "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-one\n+1\n"), Options{DryRun: true})
+	if err != nil || result.Status != ResultSuccess {
+		t.Fatalf("Apply = %+v, %v", result, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "one\n" {
+		t.Errorf("dry run changed the file to %q", data)
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
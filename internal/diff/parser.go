@@ -0,0 +1,321 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Line kinds inside a hunk
+const (
+	LineContext = ' '
+	LineAdded   = '+'
+	LineRemoved = '-'
+)
+
+// Line is a single line of a hunk body
+type Line struct {
+	Kind byte
+	Text string
+}
+
+// Hunk is one "@@ -a,b +c,d @@" section of a unified diff
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Section  string
+	Lines    []Line
+
+	// NoNewlineAtEnd is set when the new side ends with "\ No newline at end of file"
+	NoNewlineAtEnd bool
+}
+
+// FilePatch holds all hunks that target a single file
+type FilePatch struct {
+	OldPath  string
+	NewPath  string
+	IsNew    bool
+	IsDelete bool
+	IsRename bool
+	Hunks    []*Hunk
+}
+
+// Path returns the path the patch should be applied to
+func (fp *FilePatch) Path() string {
+	if fp.IsDelete || fp.NewPath == "" {
+		return fp.OldPath
+	}
+	return fp.NewPath
+}
+
+// OldBlock returns the lines the hunk expects to find (context and removed lines)
+func (h *Hunk) OldBlock() []string {
+	block := make([]string, 0, len(h.Lines))
+	for _, l := range h.Lines {
+		if l.Kind != LineAdded {
+			block = append(block, l.Text)
+		}
+	}
+	return block
+}
+
+// NewBlock returns the lines that replace the old block (context and added lines)
+func (h *Hunk) NewBlock() []string {
+	block := make([]string, 0, len(h.Lines))
+	for _, l := range h.Lines {
+		if l.Kind != LineRemoved {
+			block = append(block, l.Text)
+		}
+	}
+	return block
+}
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@+ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@+ ?(.*)$`)
+
+// Parse parses a unified diff (git style or plain ---/+++) into file patches.
+// Hunk line counts are used when they are consistent, but model-generated
+// diffs often get them wrong, so the parser keeps consuming hunk lines
+// until the next header.
+func Parse(text string) ([]*FilePatch, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read diff: %w", err)
+	}
+
+	var patches []*FilePatch
+	var current *FilePatch
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			current = &FilePatch{}
+			if oldPath, newPath, ok := parseGitHeader(line); ok {
+				current.OldPath = oldPath
+				current.NewPath = newPath
+			}
+			patches = append(patches, current)
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			// Plain unified diffs have no "diff --git" line, so a new
+			// ---/+++ pair after hunks starts a new file
+			if current == nil || len(current.Hunks) > 0 {
+				current = &FilePatch{}
+				patches = append(patches, current)
+			}
+			oldPath := parseFileHeader(line[4:])
+			newPath := parseFileHeader(lines[i+1][4:])
+			if oldPath == "/dev/null" {
+				current.IsNew = true
+			} else {
+				current.OldPath = oldPath
+			}
+			if newPath == "/dev/null" {
+				current.IsDelete = true
+			} else {
+				current.NewPath = newPath
+			}
+			i++
+
+		case strings.HasPrefix(line, "new file mode"):
+			if current != nil {
+				current.IsNew = true
+			}
+
+		case strings.HasPrefix(line, "deleted file mode"):
+			if current != nil {
+				current.IsDelete = true
+			}
+
+		case strings.HasPrefix(line, "rename from "):
+			if current != nil {
+				current.OldPath = strings.TrimPrefix(line, "rename from ")
+				current.IsRename = true
+			}
+
+		case strings.HasPrefix(line, "rename to "):
+			if current != nil {
+				current.NewPath = strings.TrimPrefix(line, "rename to ")
+				current.IsRename = true
+			}
+
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				// Bare hunks without file headers, target is supplied by the caller
+				current = &FilePatch{}
+				patches = append(patches, current)
+			}
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.Hunks = append(current.Hunks, hunk)
+			i = next - 1
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file changes found in diff")
+	}
+
+	for _, fp := range patches {
+		if fp.IsNew {
+			fp.OldPath = ""
+		}
+		if fp.IsDelete && fp.OldPath == "" {
+			fp.OldPath = fp.NewPath
+		}
+		if fp.IsDelete {
+			fp.NewPath = ""
+		}
+		if fp.OldPath != "" && fp.NewPath != "" && fp.OldPath != fp.NewPath {
+			fp.IsRename = true
+		}
+	}
+
+	return patches, nil
+}
+
+// parseHunk parses the hunk starting at lines[start] and returns the index of the
+// first line after it
+func parseHunk(lines []string, start int) (*Hunk, int, error) {
+	m := hunkHeaderRegex.FindStringSubmatch(lines[start])
+	if m == nil {
+		return nil, 0, fmt.Errorf("invalid hunk header at line %d: %q", start+1, lines[start])
+	}
+
+	hunk := &Hunk{
+		OldStart: atoi(m[1], 0),
+		OldLines: atoi(m[2], 1),
+		NewStart: atoi(m[3], 0),
+		NewLines: atoi(m[4], 1),
+		Section:  m[5],
+	}
+
+	oldLeft, newLeft := hunk.OldLines, hunk.NewLines
+	i := start + 1
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		counted := oldLeft > 0 || newLeft > 0
+
+		if !counted && isHeaderLine(lines, i) {
+			break
+		}
+		if counted && (strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "diff --git ")) {
+			// Header counts were too large
+			break
+		}
+
+		if line == "" {
+			// Editors and models often strip the leading space of blank context lines
+			hunk.Lines = append(hunk.Lines, Line{Kind: LineContext})
+			oldLeft--
+			newLeft--
+			continue
+		}
+
+		switch line[0] {
+		case LineContext:
+			hunk.Lines = append(hunk.Lines, Line{Kind: LineContext, Text: line[1:]})
+			oldLeft--
+			newLeft--
+		case LineRemoved:
+			hunk.Lines = append(hunk.Lines, Line{Kind: LineRemoved, Text: line[1:]})
+			oldLeft--
+		case LineAdded:
+			hunk.Lines = append(hunk.Lines, Line{Kind: LineAdded, Text: line[1:]})
+			newLeft--
+		case '\\':
+			// "\ No newline at end of file" refers to the preceding line
+			if n := len(hunk.Lines); n > 0 && hunk.Lines[n-1].Kind != LineRemoved {
+				hunk.NoNewlineAtEnd = true
+			}
+		default:
+			return trimTrailingBlank(hunk), i, nil
+		}
+	}
+
+	return trimTrailingBlank(hunk), i, nil
+}
+
+// isHeaderLine reports whether lines[i] starts a new hunk or file section
+func isHeaderLine(lines []string, i int) bool {
+	line := lines[i]
+	if strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "diff --git ") {
+		return true
+	}
+	return strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// trimTrailingBlank drops blank context lines that were picked up after the
+// real end of a hunk (e.g. the empty line before a closing code fence)
+func trimTrailingBlank(h *Hunk) *Hunk {
+	expected := h.OldLines
+	for len(h.Lines) > 0 {
+		last := h.Lines[len(h.Lines)-1]
+		if last.Kind != LineContext || last.Text != "" || len(h.OldBlock()) <= expected {
+			break
+		}
+		h.Lines = h.Lines[:len(h.Lines)-1]
+	}
+	return h
+}
+
+// parseGitHeader extracts paths from "diff --git a/x b/y"
+func parseGitHeader(line string) (string, string, bool) {
+	rest := strings.TrimPrefix(line, "diff --git ")
+	if strings.HasPrefix(rest, "a/") {
+		if idx := strings.Index(rest, " b/"); idx > 0 {
+			return rest[2:idx], rest[idx+3:], true
+		}
+	}
+	parts := strings.Fields(rest)
+	if len(parts) == 2 {
+		return stripPrefix(parts[0]), stripPrefix(parts[1]), true
+	}
+	return "", "", false
+}
+
+// parseFileHeader extracts the path from the text after "--- " or "+++ "
+func parseFileHeader(s string) string {
+	// Drop the optional timestamp that follows a tab
+	if idx := strings.Index(s, "\t"); idx >= 0 {
+		s = s[:idx]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return s
+	}
+	return stripPrefix(s)
+}
+
+// stripPrefix removes the a/ or b/ prefix git adds to paths
+func stripPrefix(path string) string {
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
+
+func atoi(s string, defaultValue int) int {
+	if s == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
@@ -0,0 +1,311 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+// File actions
+const (
+	ActionModify = "modify"
+	ActionCreate = "create"
+	ActionDelete = "delete"
+	ActionRename = "rename"
+)
+
+// Overall statuses for a file or a whole patch
+const (
+	ResultSuccess = "success"
+	ResultPartial = "partial"
+	ResultFailed  = "failed"
+)
+
+// Options controls how a patch is applied
+type Options struct {
+	// DryRun computes results without touching the filesystem
+	DryRun bool
+	// DefaultPath is used for patches whose headers carry no file name
+	DefaultPath string
+	// Content, when set, replaces the on-disk content of the (single) target file
+	Content *string
+}
+
+// FileResult describes the outcome for one file of a patch
+type FileResult struct {
+	Path    string       `json:"path"`
+	OldPath string       `json:"old_path,omitempty"`
+	Action  string       `json:"action"`
+	Status  string       `json:"status"`
+	Error   string       `json:"error,omitempty"`
+	Hunks   []HunkResult `json:"hunks"`
+
+	fullPath    string
+	oldFullPath string
+	newContent  string
+}
+
+// Result is the outcome of applying a multi-file patch
+type Result struct {
+	Status       string       `json:"status"`
+	Files        []FileResult `json:"files"`
+	AppliedHunks int          `json:"applied_hunks"`
+	FailedHunks  int          `json:"failed_hunks"`
+}
+
+// Hunks returns the results of every hunk across all files, in patch order
+func (r *Result) Hunks() []HunkResult {
+	var hunks []HunkResult
+	for _, f := range r.Files {
+		hunks = append(hunks, f.Hunks...)
+	}
+	return hunks
+}
+
+// Summary returns a one-line human readable summary
+func (r *Result) Summary() string {
+	return fmt.Sprintf("%d of %d hunk(s) applied across %d file(s)",
+		r.AppliedHunks, r.AppliedHunks+r.FailedHunks, len(r.Files))
+}
+
+// Apply applies parsed patches to files under baseDir. Every target path is
+// confined to baseDir. Hunks that apply are written even if others fail; a
+// file that is created or deleted is only touched if all of its hunks apply.
+func Apply(baseDir string, patches []*FilePatch, opts Options) (*Result, error) {
+	if opts.Content != nil && len(patches) > 1 {
+		return nil, fmt.Errorf("content override requires a single-file diff, got %d files", len(patches))
+	}
+
+	result := &Result{}
+	for _, fp := range patches {
+		fr := applyFile(baseDir, fp, opts)
+		for _, h := range fr.Hunks {
+			if h.Status == StatusSuccess {
+				result.AppliedHunks++
+			} else {
+				result.FailedHunks++
+			}
+		}
+		result.Files = append(result.Files, fr)
+	}
+
+	if !opts.DryRun {
+		for i := range result.Files {
+			fr := &result.Files[i]
+			if fr.Status == ResultFailed {
+				continue
+			}
+			if err := writeFile(fr); err != nil {
+				utils.Log.Error("Failed to write %s: %v", fr.Path, err)
+				fr.Status = ResultFailed
+				fr.Error = err.Error()
+			}
+		}
+	}
+
+	result.Status = combineStatus(result.Files)
+	return result, nil
+}
+
+// applyFile computes the new content of a single file
+func applyFile(baseDir string, fp *FilePatch, opts Options) FileResult {
+	path := fp.Path()
+	if path == "" {
+		path = opts.DefaultPath
+	}
+
+	fr := FileResult{Path: path, Action: ActionModify}
+	switch {
+	case fp.IsNew:
+		fr.Action = ActionCreate
+	case fp.IsDelete:
+		fr.Action = ActionDelete
+	case fp.IsRename:
+		fr.Action = ActionRename
+		fr.OldPath = fp.OldPath
+	}
+
+	fail := func(format string, args ...interface{}) FileResult {
+		fr.Status = ResultFailed
+		fr.Error = fmt.Sprintf(format, args...)
+		fr.Hunks = failAll(fp.Hunks, path, fr.Error)
+		return fr
+	}
+
+	if path == "" {
+		return fail("diff does not name a target file")
+	}
+
+	fullPath, err := utils.SafeJoin(baseDir, path)
+	if err != nil {
+		return fail("%v", err)
+	}
+	fr.fullPath = fullPath
+
+	sourcePath := fullPath
+	if fr.Action == ActionRename {
+		if sourcePath, err = utils.SafeJoin(baseDir, fp.OldPath); err != nil {
+			return fail("%v", err)
+		}
+		fr.oldFullPath = sourcePath
+		if _, err := os.Stat(fullPath); err == nil {
+			return fail("rename target already exists: %s", path)
+		}
+	}
+
+	var original string
+	switch {
+	case opts.Content != nil:
+		original = *opts.Content
+	case fr.Action == ActionCreate:
+		if data, err := os.ReadFile(fullPath); err == nil && len(data) > 0 {
+			return fail("file already exists: %s", path)
+		}
+	default:
+		info, err := os.Stat(sourcePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fail("file not found: %s", pathOrOld(fr))
+			}
+			return fail("cannot access file: %v", err)
+		}
+		if info.IsDir() {
+			return fail("path is a directory: %s", pathOrOld(fr))
+		}
+		if utils.IsBinaryFile(sourcePath) {
+			return fail("binary file: %s", pathOrOld(fr))
+		}
+		data, err := os.ReadFile(sourcePath)
+		if err != nil {
+			return fail("error reading file: %v", err)
+		}
+		original = string(data)
+	}
+
+	newContent, hunks := ApplyHunks(original, fp.Hunks)
+	for i := range hunks {
+		hunks[i].File = path
+	}
+	fr.Hunks = hunks
+	fr.newContent = newContent
+	fr.Status = hunkStatus(hunks)
+
+	if fr.Status != ResultSuccess && (fr.Action == ActionCreate || fr.Action == ActionDelete) {
+		// Half-created or half-deleted files are never what the user wants
+		fr.Status = ResultFailed
+		fr.Error = fmt.Sprintf("cannot %s %s: not all hunks apply", fr.Action, path)
+	}
+	if fr.Action == ActionDelete && fr.Status == ResultSuccess && len(fp.Hunks) > 0 && newContent != "" {
+		fr.Status = ResultFailed
+		fr.Error = fmt.Sprintf("cannot delete %s: file has content not covered by the diff", path)
+	}
+
+	return fr
+}
+
+func pathOrOld(fr FileResult) string {
+	if fr.OldPath != "" {
+		return fr.OldPath
+	}
+	return fr.Path
+}
+
+// writeFile persists a computed file result
+func writeFile(fr *FileResult) error {
+	switch fr.Action {
+	case ActionDelete:
+		return os.Remove(fr.fullPath)
+	case ActionRename:
+		if err := writeAtomic(fr.fullPath, fr.newContent, fr.oldFullPath); err != nil {
+			return err
+		}
+		return os.Remove(fr.oldFullPath)
+	default:
+		return writeAtomic(fr.fullPath, fr.newContent, fr.fullPath)
+	}
+}
+
+// writeAtomic writes content to path via a temp file, keeping modeFrom's permissions
+func writeAtomic(path, content, modeFrom string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(modeFrom); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".codewhisper-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func failAll(hunks []*Hunk, path, reason string) []HunkResult {
+	results := make([]HunkResult, 0, len(hunks))
+	for i, h := range hunks {
+		results = append(results, HunkResult{
+			File:      path,
+			Index:     i,
+			Status:    StatusFailed,
+			StartLine: h.OldStart,
+			Reason:    reason,
+		})
+	}
+	return results
+}
+
+func hunkStatus(hunks []HunkResult) string {
+	applied := 0
+	for _, h := range hunks {
+		if h.Status == StatusSuccess {
+			applied++
+		}
+	}
+	switch {
+	case applied == len(hunks):
+		return ResultSuccess
+	case applied == 0:
+		return ResultFailed
+	default:
+		return ResultPartial
+	}
+}
+
+func combineStatus(files []FileResult) string {
+	success, failed := 0, 0
+	for _, f := range files {
+		switch f.Status {
+		case ResultSuccess:
+			success++
+		case ResultFailed:
+			failed++
+		}
+	}
+	switch {
+	case success == len(files):
+		return ResultSuccess
+	case failed == len(files):
+		return ResultFailed
+	default:
+		return ResultPartial
+	}
+}
@@ -0,0 +1,193 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hunk validation outcomes, from best to worst
+const (
+	HunkClean    = "clean"
+	HunkOffset   = "offset"
+	HunkFuzz     = "fuzz"
+	HunkConflict = "conflict"
+)
+
+// Region is a range of lines in a file used to explain a conflicting hunk
+type Region struct {
+	StartLine  int      `json:"start_line"`
+	EndLine    int      `json:"end_line"`
+	Similarity float64  `json:"similarity"`
+	Lines      []string `json:"lines"`
+	// FirstMismatch is the 1-based file line where the region stops matching the hunk
+	FirstMismatch int    `json:"first_mismatch,omitempty"`
+	Expected      string `json:"expected,omitempty"`
+	Actual        string `json:"actual,omitempty"`
+}
+
+// HunkValidation is the dry-run verdict for a single hunk
+type HunkValidation struct {
+	HunkResult
+	Result string `json:"result"`
+}
+
+// FileValidation is the dry-run verdict for a single file
+type FileValidation struct {
+	Path    string           `json:"path"`
+	OldPath string           `json:"old_path,omitempty"`
+	Action  string           `json:"action"`
+	Result  string           `json:"result"`
+	Error   string           `json:"error,omitempty"`
+	Hunks   []HunkValidation `json:"hunks"`
+}
+
+// Validation is the dry-run verdict for a whole patch
+type Validation struct {
+	// WouldApply is true when every hunk can be located, with or without fuzz
+	WouldApply bool `json:"wouldApply"`
+	// WouldApplyCleanly follows git apply: offsets are fine, fuzz and conflicts are not
+	WouldApplyCleanly bool             `json:"wouldApplyCleanly"`
+	Result            string           `json:"result"`
+	Summary           string           `json:"summary"`
+	Counts            map[string]int   `json:"counts"`
+	Files             []FileValidation `json:"files"`
+}
+
+// Validate runs a patch in dry-run mode and classifies every hunk as clean,
+// offset, fuzz or conflict. Conflicting hunks carry the closest matching
+// region of the current file.
+func Validate(baseDir string, patches []*FilePatch, opts Options) (*Validation, error) {
+	opts.DryRun = true
+	result, err := Apply(baseDir, patches, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Validation{
+		Result: HunkClean,
+		Counts: map[string]int{HunkClean: 0, HunkOffset: 0, HunkFuzz: 0, HunkConflict: 0},
+	}
+
+	for _, fr := range result.Files {
+		fv := FileValidation{
+			Path:    fr.Path,
+			OldPath: fr.OldPath,
+			Action:  fr.Action,
+			Result:  HunkClean,
+			Error:   fr.Error,
+		}
+		for _, h := range fr.Hunks {
+			verdict := classify(h)
+			fv.Hunks = append(fv.Hunks, HunkValidation{HunkResult: h, Result: verdict})
+			fv.Result = worse(fv.Result, verdict)
+			v.Counts[verdict]++
+		}
+		if fr.Error != "" {
+			// File-level failures (missing file, create over existing) conflict the whole file
+			fv.Result = HunkConflict
+		}
+		v.Result = worse(v.Result, fv.Result)
+		v.Files = append(v.Files, fv)
+	}
+
+	v.WouldApply = v.Result != HunkConflict
+	v.WouldApplyCleanly = v.Result == HunkClean || v.Result == HunkOffset
+	v.Summary = fmt.Sprintf("%d clean, %d with offset, %d with fuzz, %d conflicting",
+		v.Counts[HunkClean], v.Counts[HunkOffset], v.Counts[HunkFuzz], v.Counts[HunkConflict])
+
+	return v, nil
+}
+
+func classify(h HunkResult) string {
+	switch {
+	case h.Status != StatusSuccess:
+		return HunkConflict
+	case h.Fuzz > 0 || h.IgnoredWhitespace:
+		return HunkFuzz
+	case h.Offset != 0:
+		return HunkOffset
+	default:
+		return HunkClean
+	}
+}
+
+var severity = map[string]int{HunkClean: 0, HunkOffset: 1, HunkFuzz: 2, HunkConflict: 3}
+
+func worse(a, b string) string {
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
+
+// closestRegion finds the window of lines most similar to block, preferring
+// windows near expected when scores tie
+func closestRegion(lines, block []string, expected int) *Region {
+	if len(block) == 0 || len(lines) == 0 {
+		return nil
+	}
+
+	size := min(len(block), len(lines))
+	bestPos, bestScore := -1, -1.0
+	for pos := 0; pos+size <= len(lines); pos++ {
+		score := 0.0
+		for i := 0; i < size; i++ {
+			score += lineSimilarity(lines[pos+i], block[i])
+		}
+		if score > bestScore || (score == bestScore && abs(pos-expected) < abs(bestPos-expected)) {
+			bestPos, bestScore = pos, score
+		}
+	}
+
+	region := &Region{
+		StartLine:  bestPos + 1,
+		EndLine:    bestPos + size,
+		Similarity: float64(int(bestScore/float64(len(block))*1000)) / 1000,
+		Lines:      append([]string(nil), lines[bestPos:bestPos+size]...),
+	}
+	for i := 0; i < len(block); i++ {
+		if i >= size {
+			region.FirstMismatch = bestPos + size + 1
+			region.Expected = block[i]
+			break
+		}
+		if !linesEqual(lines[bestPos+i], block[i], false) {
+			region.FirstMismatch = bestPos + i + 1
+			region.Expected = block[i]
+			region.Actual = lines[bestPos+i]
+			break
+		}
+	}
+	return region
+}
+
+// lineSimilarity scores two lines between 0 and 1 by their common prefix and
+// suffix after whitespace normalization
+func lineSimilarity(a, b string) float64 {
+	if linesEqual(a, b, true) {
+		return 1
+	}
+	a = strings.Join(strings.Fields(a), " ")
+	b = strings.Join(strings.Fields(b), " ")
+	longest := max(len(a), len(b))
+	if longest == 0 {
+		return 1
+	}
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	return float64(prefix+suffix) / float64(longest) * 0.9
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
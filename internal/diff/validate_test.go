@@ -0,0 +1,182 @@
+package diff
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseHunkHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		diff  string
+		err   string
+		old   []string
+		new   []string
+		noEOL bool
+	}{
+		{
+			name: "malformed header",
+			diff: "--- a/f\n+++ b/f\n@@ -x,1 +1 @@\n-a\n+b\n",
+			err:  "invalid hunk header at line 3",
+		},
+		{
+			name: "counts omitted",
+			diff: "@@ -1 +1 @@\n-a\n+b\n",
+			old:  []string{"a"},
+			new:  []string{"b"},
+		},
+		{
+			name: "counts too small",
+			diff: "@@ -1,1 +1,1 @@\n a\n-b\n+B\n c\n",
+			old:  []string{"a", "b", "c"},
+			new:  []string{"a", "B", "c"},
+		},
+		{
+			name: "counts too large",
+			diff: "@@ -1,9 +1,9 @@\n a\n-b\n+B\n@@ -20 +20 @@\n-x\n+y\n",
+			old:  []string{"a", "b"},
+			new:  []string{"a", "B"},
+		},
+		{
+			name: "blank context without its space",
+			diff: "@@ -1,3 +1,3 @@\n a\n\n-b\n+B\n",
+			old:  []string{"a", "", "b"},
+			new:  []string{"a", "", "B"},
+		},
+		{
+			name:  "no newline at end of file",
+			diff:  "@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n",
+			old:   []string{"a"},
+			new:   []string{"b"},
+			noEOL: true,
+		},
+		{
+			name: "no newline on the removed side only",
+			diff: "@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+			old:  []string{"a"},
+			new:  []string{"a"},
+		},
+		{
+			name: "no changes",
+			diff: "just some text\n",
+			err:  "no file changes found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := Parse(tt.diff)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Parse error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			h := patches[0].Hunks[0]
+			if got := strings.Join(h.OldBlock(), "|"); got != strings.Join(tt.old, "|") {
+				t.Errorf("old block = %q, want %q", got, strings.Join(tt.old, "|"))
+			}
+			if got := strings.Join(h.NewBlock(), "|"); got != strings.Join(tt.new, "|") {
+				t.Errorf("new block = %q, want %q", got, strings.Join(tt.new, "|"))
+			}
+			if h.NoNewlineAtEnd != tt.noEOL {
+				t.Errorf("NoNewlineAtEnd = %v, want %v", h.NoNewlineAtEnd, tt.noEOL)
+			}
+		})
+	}
+}
+
+func TestParseMultiFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		diff  string
+		paths []string
+	}{
+		{
+			name: "git",
+			diff: "diff --git a/one.go b/one.go\n--- a/one.go\n+++ b/one.go\n@@ -1 +1 @@\n-a\n+b\n" +
+				"diff --git a/two.go b/two.go\nnew file mode 100644\n--- /dev/null\n+++ b/two.go\n@@ -0,0 +1 @@\n+c\n",
+			paths: []string{"one.go", "two.go"},
+		},
+		{
+			name: "plain",
+			diff: "--- one.go\t2024-01-01\n+++ one.go\t2024-01-02\n@@ -1 +1 @@\n-a\n+b\n" +
+				"--- two.go\n+++ two.go\n@@ -1 +1 @@\n-c\n+d\n",
+			paths: []string{"one.go", "two.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches := mustParse(t, tt.diff)
+			var paths []string
+			for _, fp := range patches {
+				paths = append(paths, fp.Path())
+				if len(fp.Hunks) != 1 {
+					t.Errorf("%s has %d hunks, want 1", fp.Path(), len(fp.Hunks))
+				}
+			}
+			if strings.Join(paths, " ") != strings.Join(tt.paths, " ") {
+				t.Errorf("paths = %v, want %v", paths, tt.paths)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a\nb\nc\nd\ne\n")
+	writeTestFile(t, filepath.Join(dir, "b.txt"), "x\ny\n")
+
+	diff := "--- a/a.txt\n+++ b/a.txt\n" +
+		"@@ -1,2 +1,2 @@\n-a\n+A\n b\n" + // clean
+		"@@ -1,2 +1,2 @@\n c\n-d\n+D\n" + // offset
+		"@@ -4,2 +4,2 @@\n changed\n-e\n+E\n" + // fuzz
+		"--- a/b.txt\n+++ b/b.txt\n" +
+		"@@ -1,2 +1,2 @@\n x\n-nothing like it\n+z\n" // conflict
+
+	v, err := Validate(dir, mustParse(t, diff), Options{})
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	var verdicts []string
+	for _, f := range v.Files {
+		for _, h := range f.Hunks {
+			verdicts = append(verdicts, h.Result)
+		}
+	}
+	if want := "clean offset fuzz conflict"; strings.Join(verdicts, " ") != want {
+		t.Errorf("verdicts = %v, want %s", verdicts, want)
+	}
+	if v.Files[0].Result != HunkFuzz || v.Files[1].Result != HunkConflict {
+		t.Errorf("file results = %s, %s, want fuzz, conflict", v.Files[0].Result, v.Files[1].Result)
+	}
+	if v.Result != HunkConflict || v.WouldApply || v.WouldApplyCleanly {
+		t.Errorf("result = %s, wouldApply %v, cleanly %v", v.Result, v.WouldApply, v.WouldApplyCleanly)
+	}
+
+	closest := v.Files[1].Hunks[0].Closest
+	if closest == nil || closest.FirstMismatch != 2 || closest.Actual != "y" {
+		t.Errorf("closest region = %+v, want a mismatch at line 2", closest)
+	}
+}
+
+func TestValidateClean(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "x\na\nb\n")
+
+	// An offset still applies cleanly, as with git apply
+	v, err := Validate(dir, mustParse(t, "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n-a\n+A\n b\n"), Options{})
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if v.Result != HunkOffset || !v.WouldApply || !v.WouldApplyCleanly {
+		t.Errorf("result = %s, wouldApply %v, cleanly %v", v.Result, v.WouldApply, v.WouldApplyCleanly)
+	}
+}
@@ -0,0 +1,449 @@
+// Package index keeps a persistent inverted index of a codebase: trigrams
+// for literal and regex search, identifier terms from contents and paths
+// for ranking, and the symbols each file defines. It is stored under
+// ~/.codewhisper/index/<repo-hash>, or the configured index directory, and
+// updated incrementally from file sizes and modification times.
+package index
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+// formatVersion changes whenever the stored layout does; older indexes are
+// rebuilt
+const formatVersion = 1
+
+const (
+	// maxFileSize skips generated bundles and data files
+	maxFileSize = 1024 * 1024
+	// pathWeight counts each path term as this many occurrences, since a
+	// file's name says more about it than any one line
+	pathWeight = 3
+	// refreshInterval is how stale Refresh lets the index get
+	refreshInterval = 2 * time.Second
+)
+
+// FileRecord describes one indexed file
+type FileRecord struct {
+	Path    string // relative to the codebase, slash-separated; empty for a free slot
+	ModTime int64
+	Size    int64
+	Binary  bool
+	Length  int // identifier terms, path terms included
+}
+
+// Posting is one file's occurrences of a term
+type Posting struct {
+	File  uint32
+	Count uint32
+}
+
+// Symbol is a definition found in a file
+type Symbol struct {
+	Name string
+	Kind string
+	File uint32
+	Line int
+}
+
+// snapshot is what is stored on disk
+type snapshot struct {
+	Version  int
+	Root     string
+	Files    []FileRecord
+	Trigrams map[uint32][]uint32
+	Terms    map[string][]Posting
+	Symbols  map[string][]Symbol // keyed by lowercased name
+}
+
+// Options says where indexes are stored and which files they leave out
+type Options struct {
+	// Dir holds one index per codebase; empty for ~/.codewhisper/index
+	Dir string
+	// Exclude holds patterns left out as for utils.WalkOptions.Exclude
+	Exclude []string
+}
+
+// Index is the index of one codebase directory. It is safe for concurrent
+// use.
+type Index struct {
+	root string // codebase directory as configured
+	file string // where the snapshot is stored
+
+	// update serializes updates, mu guards the fields below
+	update sync.Mutex
+	mu     sync.RWMutex
+
+	data    snapshot
+	byPath  map[string]uint32
+	free    []uint32
+	updated time.Time
+	exclude []string
+}
+
+var (
+	openMu  sync.Mutex
+	indexes = make(map[string]*Index)
+)
+
+// For returns the index of a codebase directory, loading it from disk the
+// first time. Call Refresh before relying on it being current.
+func For(root string, opts Options) *Index {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		abs = filepath.Clean(root)
+	}
+	file := indexFile(abs, opts.Dir)
+
+	openMu.Lock()
+	defer openMu.Unlock()
+
+	if ix, ok := indexes[file]; ok {
+		ix.mu.Lock()
+		if !slices.Equal(ix.exclude, opts.Exclude) {
+			// Files may have been excluded or included since
+			ix.exclude = slices.Clone(opts.Exclude)
+			ix.updated = time.Time{}
+		}
+		ix.mu.Unlock()
+		return ix
+	}
+	ix := &Index{root: root, file: file, exclude: slices.Clone(opts.Exclude)}
+	if err := ix.load(abs); err != nil {
+		if !os.IsNotExist(err) {
+			utils.Log.Warning("Rebuilding code index: %v", err)
+		}
+		ix.reset(abs)
+	}
+	indexes[file] = ix
+	return ix
+}
+
+// indexFile returns where the index of the codebase at abs is stored:
+// <dir>/<hash>/index.gob, dir defaulting to ~/.codewhisper/index
+func indexFile(abs, dir string) string {
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		dir = filepath.Join(home, ".codewhisper", "index")
+	}
+
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8]), "index.gob")
+}
+
+func (ix *Index) reset(abs string) {
+	ix.data = snapshot{
+		Version:  formatVersion,
+		Root:     abs,
+		Trigrams: make(map[uint32][]uint32),
+		Terms:    make(map[string][]Posting),
+		Symbols:  make(map[string][]Symbol),
+	}
+	ix.byPath = make(map[string]uint32)
+	ix.free = nil
+}
+
+func (ix *Index) load(abs string) error {
+	f, err := os.Open(ix.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var data snapshot
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&data); err != nil {
+		return fmt.Errorf("failed to read %s: %w", ix.file, err)
+	}
+	if data.Version != formatVersion || data.Root != abs {
+		return fmt.Errorf("%s is from another version or directory", ix.file)
+	}
+
+	ix.data = data
+	ix.byPath = make(map[string]uint32, len(data.Files))
+	for id, rec := range data.Files {
+		if rec.Path == "" {
+			ix.free = append(ix.free, uint32(id))
+		} else {
+			ix.byPath[rec.Path] = uint32(id)
+		}
+	}
+	return nil
+}
+
+// save writes the snapshot atomically. The caller holds update and at
+// least a read lock on mu.
+func (ix *Index) save() error {
+	if err := os.MkdirAll(filepath.Dir(ix.file), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ix.file), "index-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := gob.NewEncoder(w).Encode(&ix.data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ix.file)
+}
+
+// Stats summarizes an update
+type Stats struct {
+	Files   int `json:"files"`
+	Indexed int `json:"indexed"`
+	Removed int `json:"removed"`
+}
+
+// Refresh updates the index unless it was updated very recently
+func (ix *Index) Refresh() error {
+	ix.mu.RLock()
+	fresh := time.Since(ix.updated) < refreshInterval
+	ix.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+	_, err := ix.Update()
+	return err
+}
+
+// Invalidate makes the next Refresh update the index, e.g. after the file
+// watcher saw changes
+func (ix *Index) Invalidate() {
+	ix.mu.Lock()
+	ix.updated = time.Time{}
+	ix.mu.Unlock()
+}
+
+// fileData is the analysis of one file, before it has an id
+type fileData struct {
+	rec      FileRecord
+	trigrams []uint32
+	terms    map[string]int
+	symbols  []Symbol
+}
+
+// Update walks the codebase, re-indexing files whose size or modification
+// time changed and dropping deleted ones, and saves the index if anything
+// changed
+func (ix *Index) Update() (Stats, error) {
+	ix.update.Lock()
+	defer ix.update.Unlock()
+
+	var mu sync.Mutex
+	var changed []*fileData
+	seen := make(map[string]bool)
+
+	ix.mu.RLock()
+	exclude := ix.exclude
+	ix.mu.RUnlock()
+
+	utils.WalkTree(ix.root, utils.WalkOptions{
+		MaxDepth: -1,
+		Exclude:  exclude,
+		Visit: func(path string, entry fs.DirEntry) bool {
+			info, err := entry.Info()
+			if err != nil || info.Size() > maxFileSize || utils.IsImageFile(path) {
+				return false
+			}
+			rel, err := filepath.Rel(ix.root, path)
+			if err != nil {
+				return false
+			}
+			rel = filepath.ToSlash(rel)
+
+			ix.mu.RLock()
+			id, ok := ix.byPath[rel]
+			var rec FileRecord
+			if ok {
+				rec = ix.data.Files[id]
+			}
+			ix.mu.RUnlock()
+
+			var data *fileData
+			if !ok || rec.ModTime != info.ModTime().UnixNano() || rec.Size != info.Size() {
+				data = analyze(path, rel, info)
+			}
+
+			mu.Lock()
+			seen[rel] = true
+			if data != nil {
+				changed = append(changed, data)
+			}
+			mu.Unlock()
+			return false
+		},
+	})
+
+	ix.mu.Lock()
+	stale := make(map[uint32]bool)
+	for _, data := range changed {
+		if id, ok := ix.byPath[data.rec.Path]; ok {
+			stale[id] = true
+		}
+	}
+	removed := 0
+	for path, id := range ix.byPath {
+		if !seen[path] {
+			stale[id] = true
+			delete(ix.byPath, path)
+			ix.data.Files[id] = FileRecord{}
+			ix.free = append(ix.free, id)
+			removed++
+		}
+	}
+	ix.removePostings(stale)
+
+	for _, data := range changed {
+		ix.add(data)
+	}
+
+	ix.updated = time.Now()
+	stats := Stats{Files: len(ix.byPath), Indexed: len(changed), Removed: removed}
+	ix.mu.Unlock()
+
+	if len(changed) == 0 && removed == 0 {
+		return stats, nil
+	}
+	utils.Log.Info("Code index: %d files, %d re-indexed, %d removed", stats.Files, stats.Indexed, stats.Removed)
+
+	// Searches can go on while the index is written; update keeps other
+	// writers out
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if err := ix.save(); err != nil {
+		return stats, fmt.Errorf("failed to save code index: %w", err)
+	}
+	return stats, nil
+}
+
+// analyze reads and indexes one file
+func analyze(path, rel string, info fs.FileInfo) *fileData {
+	data := &fileData{
+		rec: FileRecord{Path: rel, ModTime: info.ModTime().UnixNano(), Size: info.Size()},
+	}
+	if utils.IsBinaryFile(path) {
+		data.rec.Binary = true
+		return data
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	content := string(raw)
+
+	data.trigrams = trigrams(content)
+	data.terms = make(map[string]int)
+	for _, term := range Terms(content) {
+		data.terms[term]++
+		data.rec.Length++
+	}
+	for _, term := range Terms(rel) {
+		data.terms[term] += pathWeight
+		data.rec.Length += pathWeight
+	}
+	data.symbols = extractSymbols(content)
+	return data
+}
+
+// add gives a file an id and adds its postings. The caller holds mu.
+func (ix *Index) add(data *fileData) {
+	id, ok := ix.byPath[data.rec.Path]
+	if !ok {
+		if n := len(ix.free); n > 0 {
+			id, ix.free = ix.free[n-1], ix.free[:n-1]
+		} else {
+			id = uint32(len(ix.data.Files))
+			ix.data.Files = append(ix.data.Files, FileRecord{})
+		}
+		ix.byPath[data.rec.Path] = id
+	}
+	ix.data.Files[id] = data.rec
+
+	for _, t := range data.trigrams {
+		ix.data.Trigrams[t] = append(ix.data.Trigrams[t], id)
+	}
+	for term, count := range data.terms {
+		ix.data.Terms[term] = append(ix.data.Terms[term], Posting{File: id, Count: uint32(count)})
+	}
+	for _, sym := range data.symbols {
+		sym.File = id
+		key := strings.ToLower(sym.Name)
+		ix.data.Symbols[key] = append(ix.data.Symbols[key], sym)
+	}
+}
+
+// removePostings drops every posting of the given files. The caller holds
+// mu.
+func (ix *Index) removePostings(stale map[uint32]bool) {
+	if len(stale) == 0 {
+		return
+	}
+
+	for t, ids := range ix.data.Trigrams {
+		kept := ids[:0]
+		for _, id := range ids {
+			if !stale[id] {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ix.data.Trigrams, t)
+		} else {
+			ix.data.Trigrams[t] = kept
+		}
+	}
+	for term, postings := range ix.data.Terms {
+		kept := postings[:0]
+		for _, p := range postings {
+			if !stale[p.File] {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ix.data.Terms, term)
+		} else {
+			ix.data.Terms[term] = kept
+		}
+	}
+	for name, symbols := range ix.data.Symbols {
+		kept := symbols[:0]
+		for _, s := range symbols {
+			if !stale[s.File] {
+				kept = append(kept, s)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ix.data.Symbols, name)
+		} else {
+			ix.data.Symbols[name] = kept
+		}
+	}
+}
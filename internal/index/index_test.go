@@ -0,0 +1,162 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testIndex returns the index of a new codebase holding files, stored in
+// its own directory so tests don't share indexes
+func testIndex(t *testing.T, files map[string]string, exclude ...string) (*Index, string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	root := t.TempDir()
+	for name, content := range files {
+		writeFile(t, root, name, content)
+	}
+	return For(root, Options{Dir: t.TempDir(), Exclude: exclude}), root
+}
+
+func writeFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func update(t *testing.T, ix *Index, want Stats) {
+	t.Helper()
+	stats, err := ix.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != want {
+		t.Errorf("Update = %+v, want %+v", stats, want)
+	}
+}
+
+// postingsOf reports whether any term, trigram or symbol still refers to id
+func postingsOf(ix *Index, id uint32) bool {
+	for _, ids := range ix.data.Trigrams {
+		for _, i := range ids {
+			if i == id {
+				return true
+			}
+		}
+	}
+	for _, postings := range ix.data.Terms {
+		for _, p := range postings {
+			if p.File == id {
+				return true
+			}
+		}
+	}
+	for _, symbols := range ix.data.Symbols {
+		for _, s := range symbols {
+			if s.File == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestUpdate(t *testing.T) {
+	ix, root := testIndex(t, map[string]string{
+		"config/load.go":  "package config\n\nfunc LoadSettings() {}\n",
+		"config/store.go": "package config\n\ntype Store struct{}\n",
+		"README.md":       "# Settings\n",
+	})
+
+	update(t, ix, Stats{Files: 3, Indexed: 3})
+	update(t, ix, Stats{Files: 3})
+
+	// Changed files are re-indexed and deleted ones dropped
+	storeID := ix.byPath["config/store.go"]
+	writeFile(t, root, "config/load.go", "package config\n\nfunc ReadSettings() error { return nil }\n")
+	os.Remove(filepath.Join(root, "config", "store.go"))
+	update(t, ix, Stats{Files: 2, Indexed: 1, Removed: 1})
+
+	if postingsOf(ix, storeID) {
+		t.Errorf("postings of the deleted file remain")
+	}
+	if _, ok := ix.data.Symbols["store"]; ok {
+		t.Error("symbol of the deleted file remains")
+	}
+	if _, ok := ix.data.Symbols["loadsettings"]; ok {
+		t.Error("symbol removed from a changed file remains")
+	}
+	if _, ok := ix.data.Symbols["readsettings"]; !ok {
+		t.Error("symbol added to a changed file is missing")
+	}
+	if postings := ix.data.Terms["settings"]; len(postings) != 2 {
+		t.Errorf("postings of settings = %v, want one per file", postings)
+	}
+
+	// A new file takes the deleted file's slot
+	writeFile(t, root, "config/save.go", "package config\n\nfunc Save() {}\n")
+	update(t, ix, Stats{Files: 3, Indexed: 1})
+	if id := ix.byPath["config/save.go"]; id != storeID || len(ix.data.Files) != 3 || len(ix.free) != 0 {
+		t.Errorf("new file has id %d of %d files, want the freed id %d", id, len(ix.data.Files), storeID)
+	}
+	if ix.data.Files[storeID].Path != "config/save.go" {
+		t.Errorf("record in the freed slot = %+v", ix.data.Files[storeID])
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ix, root := testIndex(t, map[string]string{
+		"a.go": "package a\n\nfunc Alpha() {}\n",
+		"b.go": "package a\n\nfunc Beta() {}\n",
+	})
+	update(t, ix, Stats{Files: 2, Indexed: 2})
+	os.Remove(filepath.Join(root, "a.go"))
+	update(t, ix, Stats{Files: 1, Removed: 1})
+
+	loaded := &Index{root: root, file: ix.file}
+	if err := loaded.load(ix.data.Root); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.byPath) != 1 || len(loaded.free) != 1 || loaded.free[0] != ix.free[0] {
+		t.Errorf("loaded byPath %v, free %v, want %v, %v", loaded.byPath, loaded.free, ix.byPath, ix.free)
+	}
+	if _, ok := loaded.data.Symbols["beta"]; !ok {
+		t.Error("loaded index lost symbols")
+	}
+
+	// Nothing changed on disk since it was saved
+	stats, err := loaded.Update()
+	if err != nil || stats != (Stats{Files: 1}) {
+		t.Errorf("Update of the loaded index = %+v, %v", stats, err)
+	}
+
+	if err := loaded.load("/elsewhere"); err == nil {
+		t.Error("loaded the index of another directory")
+	}
+}
+
+func TestExcludeChange(t *testing.T) {
+	ix, root := testIndex(t, map[string]string{
+		"main.go":       "package main\n",
+		"gen/schema.go": "package gen\n",
+	})
+	update(t, ix, Stats{Files: 2, Indexed: 2})
+
+	// The same codebase with new excludes is the same index, made stale
+	again := For(root, Options{Dir: filepath.Dir(filepath.Dir(ix.file)), Exclude: []string{"gen"}})
+	if again != ix {
+		t.Fatal("For returned a different index for the same codebase")
+	}
+	if err := ix.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ix.byPath["gen/schema.go"]; ok || len(ix.byPath) != 1 {
+		t.Errorf("files after excluding gen = %v", ix.byPath)
+	}
+}
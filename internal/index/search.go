@@ -0,0 +1,373 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+// Search modes
+const (
+	ModeLiteral = "literal"
+	ModeRegex   = "regex"
+	ModeSymbol  = "symbol"
+)
+
+const (
+	defaultLimit = 100
+	// maxLineLength truncates the text of long matching lines
+	maxLineLength = 300
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// symbolBoost is added for each identifier a file defines or is named after
+	symbolBoost = 6.0
+)
+
+// Query is a search of the codebase. Literal and regex patterns match
+// within a line.
+type Query struct {
+	Pattern       string
+	Mode          string
+	CaseSensitive bool
+	// Path limits the search to a file or directory, relative to the codebase
+	Path  string
+	Limit int
+}
+
+// Match is one line or symbol found by Search. Line and Column are 1-based.
+type Match struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Column int    `json:"column,omitempty"`
+	Text   string `json:"text"`
+	Symbol string `json:"symbol,omitempty"`
+	Kind   string `json:"kind,omitempty"`
+}
+
+// Result holds the matches of a search. Truncated is set when the limit
+// cut it short.
+type Result struct {
+	Matches       []Match `json:"matches"`
+	FilesSearched int     `json:"files_searched"`
+	Truncated     bool    `json:"truncated"`
+}
+
+// Search finds lines matching a literal or regular expression, using the
+// trigram index to read only files that can match, or symbols whose name
+// equals or starts with the pattern
+func (ix *Index) Search(ctx context.Context, q Query) (*Result, error) {
+	if q.Pattern == "" {
+		return nil, errors.New("search pattern is empty")
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultLimit
+	}
+	q.Path = strings.Trim(path.Clean("/"+filepath.ToSlash(q.Path)), "/")
+
+	var expr string
+	var literals []string
+	switch q.Mode {
+	case "", ModeLiteral:
+		expr = regexp.QuoteMeta(q.Pattern)
+		literals = []string{q.Pattern}
+	case ModeRegex:
+		parsed, err := syntax.Parse(q.Pattern, syntax.Perl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		expr = q.Pattern
+		literals = requiredLiterals(parsed)
+	case ModeSymbol:
+		return ix.searchSymbols(q), nil
+	default:
+		return nil, fmt.Errorf("unknown search mode %q, expected literal, regex or symbol", q.Mode)
+	}
+	if !q.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	result := &Result{Matches: []Match{}}
+	for _, rel := range ix.candidates(literals, q.Path) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		content, err := os.ReadFile(filepath.Join(ix.root, filepath.FromSlash(rel)))
+		if err != nil {
+			continue
+		}
+		result.FilesSearched++
+
+		for lineNum, line := range strings.Split(string(content), "\n") {
+			loc := re.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			if len(result.Matches) == q.Limit {
+				result.Truncated = true
+				return result, nil
+			}
+			result.Matches = append(result.Matches, Match{
+				Path:   rel,
+				Line:   lineNum + 1,
+				Column: loc[0] + 1,
+				Text:   clipLine(line),
+			})
+		}
+	}
+	return result, nil
+}
+
+// candidates returns, sorted, the text files under dir that contain every
+// trigram of the literals
+func (ix *Index) candidates(literals []string, dir string) []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var set map[uint32]bool // nil until a literal narrows the search
+	for _, lit := range literals {
+		// Trigrams are folded for ASCII only
+		if len(lit) < 3 || !isASCII(lit) {
+			continue
+		}
+		for i := 0; i+2 < len(lit); i++ {
+			ids := ix.data.Trigrams[trigram(lit[i], lit[i+1], lit[i+2])]
+			next := make(map[uint32]bool, len(ids))
+			for _, id := range ids {
+				if set == nil || set[id] {
+					next[id] = true
+				}
+			}
+			if len(next) == 0 {
+				return nil
+			}
+			set = next
+		}
+	}
+
+	var paths []string
+	for id, rec := range ix.data.Files {
+		if rec.Path == "" || rec.Binary || (set != nil && !set[uint32(id)]) || !under(rec.Path, dir) {
+			continue
+		}
+		paths = append(paths, rec.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// requiredLiterals returns strings every match of re must contain
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return requiredLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		var out []string
+		var run []rune
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral {
+				run = append(run, sub.Rune...)
+				continue
+			}
+			if len(run) > 0 {
+				out = append(out, string(run))
+				run = nil
+			}
+			out = append(out, requiredLiterals(sub)...)
+		}
+		if len(run) > 0 {
+			out = append(out, string(run))
+		}
+		return out
+	}
+	return nil
+}
+
+// searchSymbols finds definitions whose name equals the pattern, then those
+// whose name starts with it
+func (ix *Index) searchSymbols(q Query) *Result {
+	name := strings.ToLower(q.Pattern)
+	type found struct {
+		Symbol
+		path string
+	}
+
+	ix.mu.RLock()
+	keys := []string{name}
+	var prefixed []string
+	for key := range ix.data.Symbols {
+		if key != name && strings.HasPrefix(key, name) {
+			prefixed = append(prefixed, key)
+		}
+	}
+	sort.Strings(prefixed)
+	keys = append(keys, prefixed...)
+
+	var symbols []found
+	truncated := false
+	for _, key := range keys {
+		for _, sym := range ix.data.Symbols[key] {
+			rel := ix.data.Files[sym.File].Path
+			if !under(rel, q.Path) || (q.CaseSensitive && !strings.HasPrefix(sym.Name, q.Pattern)) {
+				continue
+			}
+			if len(symbols) == q.Limit {
+				truncated = true
+				break
+			}
+			symbols = append(symbols, found{Symbol: sym, path: rel})
+		}
+	}
+	ix.mu.RUnlock()
+
+	result := &Result{Matches: []Match{}, Truncated: truncated}
+	lines := make(map[string][]string)
+	for _, sym := range symbols {
+		fileLines, ok := lines[sym.path]
+		if !ok {
+			if content, err := os.ReadFile(filepath.Join(ix.root, filepath.FromSlash(sym.path))); err == nil {
+				fileLines = strings.Split(string(content), "\n")
+			}
+			lines[sym.path] = fileLines
+			result.FilesSearched++
+		}
+
+		match := Match{Path: sym.path, Line: sym.Line, Symbol: sym.Name, Kind: sym.Kind}
+		if sym.Line <= len(fileLines) {
+			match.Text = clipLine(fileLines[sym.Line-1])
+		}
+		result.Matches = append(result.Matches, match)
+	}
+	return result
+}
+
+// Ranked is a file scored for relevance
+type Ranked struct {
+	Path  string
+	Score float64
+}
+
+// Rank scores the text files accepted by include with BM25 over terms,
+// adding a boost for each identifier a file defines or is named after, and
+// returns those that scored, best first. Identifiers are lowercased.
+func (ix *Index) Rank(terms, identifiers []string, include func(path string) bool) []Ranked {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	included := make(map[uint32]bool)
+	totalLength := 0
+	for id, rec := range ix.data.Files {
+		if rec.Path == "" || rec.Binary || (include != nil && !include(rec.Path)) {
+			continue
+		}
+		included[uint32(id)] = true
+		totalLength += rec.Length
+	}
+	if len(included) == 0 {
+		return nil
+	}
+	n := float64(len(included))
+	avgLength := math.Max(float64(totalLength)/n, 1)
+
+	scores := make(map[uint32]float64)
+	for _, term := range terms {
+		df := 0
+		for _, p := range ix.data.Terms[term] {
+			if included[p.File] {
+				df++
+			}
+		}
+		if df == 0 {
+			continue
+		}
+
+		idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+		for _, p := range ix.data.Terms[term] {
+			if !included[p.File] {
+				continue
+			}
+			tf := float64(p.Count)
+			length := float64(ix.data.Files[p.File].Length)
+			scores[p.File] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/avgLength))
+		}
+	}
+
+	for _, ident := range identifiers {
+		matched := make(map[uint32]bool)
+		for _, sym := range ix.data.Symbols[ident] {
+			if included[sym.File] {
+				matched[sym.File] = true
+			}
+		}
+		for id := range included {
+			rel := ix.data.Files[id].Path
+			if strings.ToLower(strings.TrimSuffix(path.Base(rel), path.Ext(rel))) == ident {
+				matched[id] = true
+			}
+		}
+		for id := range matched {
+			scores[id] += symbolBoost
+		}
+	}
+
+	ranked := make([]Ranked, 0, len(scores))
+	for id, score := range scores {
+		ranked = append(ranked, Ranked{Path: ix.data.Files[id].Path, Score: score})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Path < ranked[j].Path
+	})
+	return ranked
+}
+
+// under reports whether rel is dir or inside it; an empty dir is the root
+func under(rel, dir string) bool {
+	return dir == "" || rel == dir || strings.HasPrefix(rel, dir+"/")
+}
+
+func clipLine(line string) string {
+	line = strings.TrimRight(line, "\r")
+	if len(line) > maxLineLength {
+		// Don't split a UTF-8 sequence
+		cut := maxLineLength
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		return line[:cut] + "…"
+	}
+	return line
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
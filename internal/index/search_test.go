@@ -0,0 +1,169 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp/syntax"
+	"testing"
+)
+
+var searchFiles = map[string]string{
+	"config/load.go":   "package config\n\n// LoadConfig reads the settings file\nfunc LoadConfig(path string) error {\n\treturn parseConfig(path)\n}\n",
+	"config/parse.go":  "package config\n\nfunc parseConfig(path string) error { return nil }\n\ntype ConfigError struct{}\n",
+	"server/routes.go": "package server\n\n// routes never touches the config loader\nfunc routes() {}\n",
+	"web/app.js":       "export function loadConfigFromUrl(url) {}\nclass ConfigPanel {}\n",
+}
+
+// matches renders matches as path:line:column or path:line kind symbol
+func matches(result *Result) []string {
+	out := make([]string, 0, len(result.Matches))
+	for _, m := range result.Matches {
+		if m.Symbol != "" {
+			out = append(out, fmt.Sprintf("%s:%d %s %s", m.Path, m.Line, m.Kind, m.Symbol))
+		} else {
+			out = append(out, fmt.Sprintf("%s:%d:%d", m.Path, m.Line, m.Column))
+		}
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	ix, _ := testIndex(t, searchFiles)
+	update(t, ix, Stats{Files: 4, Indexed: 4})
+
+	tests := []struct {
+		name      string
+		query     Query
+		want      []string
+		truncated bool
+	}{
+		{
+			name:  "literal",
+			query: Query{Pattern: "parseConfig(path"},
+			want:  []string{"config/load.go:5:9", "config/parse.go:3:6"},
+		},
+		{
+			name:  "literal ignores case",
+			query: Query{Pattern: "loadconfig"},
+			want:  []string{"config/load.go:3:4", "config/load.go:4:6", "web/app.js:1:17"},
+		},
+		{
+			name:  "literal with case",
+			query: Query{Pattern: "loadConfig", CaseSensitive: true},
+			want:  []string{"web/app.js:1:17"},
+		},
+		{
+			name:  "literal is not a regex",
+			query: Query{Pattern: "Config(p"},
+			want:  []string{"config/load.go:4:10", "config/load.go:5:14", "config/parse.go:3:11"},
+		},
+		{
+			name:  "regex",
+			query: Query{Pattern: `^func \w+Config\(`, Mode: ModeRegex},
+			want:  []string{"config/load.go:4:1", "config/parse.go:3:1"},
+		},
+		{
+			name:  "regex alternation",
+			query: Query{Pattern: `routes|panel`, Mode: ModeRegex},
+			want:  []string{"server/routes.go:3:4", "server/routes.go:4:6", "web/app.js:2:13"},
+		},
+		{
+			name:  "path",
+			query: Query{Pattern: "config", Path: "/server/"},
+			want:  []string{"server/routes.go:3:29"},
+		},
+		{
+			name:      "limit",
+			query:     Query{Pattern: "package", Limit: 2},
+			want:      []string{"config/load.go:1:1", "config/parse.go:1:1"},
+			truncated: true,
+		},
+		{
+			name:  "no trigram matches",
+			query: Query{Pattern: "zzzz"},
+			want:  []string{},
+		},
+		{
+			name:  "symbol exact then prefix",
+			query: Query{Pattern: "loadconfig", Mode: ModeSymbol},
+			want:  []string{"config/load.go:4 function LoadConfig", "web/app.js:1 function loadConfigFromUrl"},
+		},
+		{
+			name:  "symbol with case",
+			query: Query{Pattern: "Config", Mode: ModeSymbol, CaseSensitive: true},
+			want:  []string{"config/parse.go:5 type ConfigError", "web/app.js:2 class ConfigPanel"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ix.Search(context.Background(), tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matches(result); !reflect.DeepEqual(got, tt.want) || result.Truncated != tt.truncated {
+				t.Errorf("Search = %v (truncated %v), want %v (truncated %v)", got, result.Truncated, tt.want, tt.truncated)
+			}
+		})
+	}
+
+	for _, q := range []Query{{}, {Pattern: "x", Mode: "fuzzy"}, {Pattern: "(", Mode: ModeRegex}} {
+		if _, err := ix.Search(context.Background(), q); err == nil {
+			t.Errorf("Search(%+v) succeeded", q)
+		}
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	ix, _ := testIndex(t, searchFiles)
+	update(t, ix, Stats{Files: 4, Indexed: 4})
+	all := []string{"config/load.go", "config/parse.go", "server/routes.go", "web/app.js"}
+
+	tests := []struct {
+		name     string
+		literals []string
+		dir      string
+		want     []string
+	}{
+		{"no literals", nil, "", all},
+		{"too short to narrow", []string{"go", "é"}, "", all},
+		{"one literal", []string{"PARSECONFIG"}, "", []string{"config/load.go", "config/parse.go"}},
+		{"every literal", []string{"parseconfig", "loadconfig"}, "", []string{"config/load.go"}},
+		{"missing trigram", []string{"xyz"}, "", nil},
+		{"directory", []string{"func"}, "server", []string{"server/routes.go"}},
+	}
+
+	for _, tt := range tests {
+		if got := ix.candidates(tt.literals, tt.dir); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: candidates = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRequiredLiterals(t *testing.T) {
+	tests := []struct {
+		re   string
+		want []string
+	}{
+		{`parseConfig`, []string{"parseConfig"}},
+		{`load.*Config`, []string{"load", "Config"}},
+		{`func (\w+)Config\(`, []string{"func ", "Config("}},
+		{`(?:abc)+x`, []string{"abc", "x"}},
+		{`(abc){2,}`, []string{"abc"}},
+		{`(abc)?def`, []string{"def"}},
+		{`(abc){0,3}`, nil},
+		{`abc|def`, nil},
+		{`[a-z]+`, nil},
+	}
+
+	for _, tt := range tests {
+		parsed, err := syntax.Parse(tt.re, syntax.Perl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := requiredLiterals(parsed); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("requiredLiterals(%q) = %q, want %q", tt.re, got, tt.want)
+		}
+	}
+}
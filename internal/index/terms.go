@@ -0,0 +1,124 @@
+package index
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Terms splits text into identifiers and returns, lowercased, the words of
+// each (parseHTTPRequest gives parse, http, request) plus the whole
+// identifier when it has several
+func Terms(text string) []string {
+	var terms []string
+	for _, ident := range Identifiers(text) {
+		parts := SplitIdentifier(ident)
+		for _, part := range parts {
+			if len(part) > 1 {
+				terms = append(terms, strings.ToLower(part))
+			}
+		}
+		if len(parts) > 1 {
+			terms = append(terms, strings.ToLower(ident))
+		}
+	}
+	return terms
+}
+
+// Identifiers returns the runs of letters, digits and underscores in text
+// that don't start with a digit
+func Identifiers(text string) []string {
+	isIdent := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	var idents []string
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return !isIdent(r) }) {
+		if !unicode.IsDigit([]rune(field)[0]) {
+			idents = append(idents, field)
+		}
+	}
+	return idents
+}
+
+// SplitIdentifier splits snake_case and camelCase names into words,
+// keeping acronyms together: HTTPServer gives HTTP and Server
+func SplitIdentifier(ident string) []string {
+	var parts []string
+	for _, chunk := range strings.Split(ident, "_") {
+		runes := []rune(chunk)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+			acronymEnd := unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			letterDigit := unicode.IsLetter(runes[i-1]) != unicode.IsLetter(runes[i])
+			if lowerToUpper || acronymEnd || letterDigit {
+				parts = append(parts, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			parts = append(parts, string(runes[start:]))
+		}
+	}
+	return parts
+}
+
+// symbolPattern finds definitions in common languages: Go, Python,
+// JavaScript/TypeScript, Java, Rust and similar. Group 1 is the keyword,
+// group 2 the name.
+var symbolPattern = regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+)?(?:default[ \t]+)?(?:pub(?:\([a-z]+\))?[ \t]+)?(?:(?:public|private|protected|static|abstract|async)[ \t]+)*(func(?:[ \t]*\([^)]*\))?|type|class|interface|struct|enum|trait|def|function|fn|const|let|var)[ \t]+([A-Za-z_$][\w$]*)`)
+
+// extractSymbols returns the definitions in content with 1-based lines
+func extractSymbols(content string) []Symbol {
+	var symbols []Symbol
+	line, offset := 1, 0
+	for _, m := range symbolPattern.FindAllStringSubmatchIndex(content, -1) {
+		line += strings.Count(content[offset:m[0]], "\n")
+		offset = m[0]
+
+		// The match may start with the newline ending the previous line
+		matchLine := line + strings.Count(content[m[0]:m[4]], "\n")
+		symbols = append(symbols, Symbol{
+			Name: content[m[4]:m[5]],
+			Kind: symbolKind(content[m[2]:m[3]]),
+			Line: matchLine,
+		})
+	}
+	return symbols
+}
+
+// symbolKind names the kind of definition a keyword introduces
+func symbolKind(keyword string) string {
+	switch {
+	case strings.HasPrefix(keyword, "func") && strings.Contains(keyword, "("):
+		return "method"
+	case keyword == "func" || keyword == "def" || keyword == "function" || keyword == "fn":
+		return "function"
+	case keyword == "let" || keyword == "var":
+		return "variable"
+	}
+	return keyword
+}
+
+// trigram packs three bytes, ASCII letters lowercased
+func trigram(a, b, c byte) uint32 {
+	return uint32(lowerASCII(a))<<16 | uint32(lowerASCII(b))<<8 | uint32(lowerASCII(c))
+}
+
+func lowerASCII(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// trigrams returns the distinct case-folded trigrams of content
+func trigrams(content string) []uint32 {
+	seen := make(map[uint32]struct{})
+	for i := 0; i+2 < len(content); i++ {
+		seen[trigram(content[i], content[i+1], content[i+2])] = struct{}{}
+	}
+	out := make([]uint32, 0, len(seen))
+	for t := range seen {
+		out = append(out, t)
+	}
+	return out
+}
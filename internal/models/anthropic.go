@@ -0,0 +1,401 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+const (
+    defaultAnthropicAPIBase = "https://api.anthropic.com"
+    anthropicAPIVersion     = "2023-06-01"
+)
+
+// AnthropicProvider implements the Provider interface for the Anthropic Messages API
+type AnthropicProvider struct {
+    client  *http.Client
+    apiKey  string
+    apiBase string
+    modelID string
+}
+
+// Model mapping for Anthropic, keyed by the aliases the UI already uses
+var anthropicModelMap = map[string]string{
+    "sonnet4":      "claude-sonnet-4-20250514",
+    "opus4":        "claude-opus-4-20250514",
+    "sonnet3.7":    "claude-3-7-sonnet-20250219",
+    "sonnet3.5-v2": "claude-3-5-sonnet-20241022",
+    "sonnet3.5":    "claude-3-5-sonnet-20240620",
+    "haiku3.5":     "claude-3-5-haiku-20241022",
+    "opus":         "claude-3-opus-20240229",
+    "sonnet":       "claude-3-sonnet-20240229",
+    "haiku":        "claude-3-haiku-20240307",
+}
+
+// anthropicRequest is the body of a Messages API call
+type anthropicRequest struct {
+    Model    string             `json:"model"`
+    System   string             `json:"system,omitempty"`
+    Messages []anthropicMessage `json:"messages"`
+    Stream   bool               `json:"stream,omitempty"`
+    anthropicSampling
+}
+
+// anthropicSampling holds the generation options shared by the Messages API
+// and Bedrock
+type anthropicSampling struct {
+    MaxTokens     int                `json:"max_tokens"`
+    Temperature   *float64           `json:"temperature,omitempty"`
+    TopP          *float64           `json:"top_p,omitempty"`
+    TopK          int                `json:"top_k,omitempty"`
+    StopSequences []string           `json:"stop_sequences,omitempty"`
+    Thinking      *anthropicThinking `json:"thinking,omitempty"`
+}
+
+type anthropicThinking struct {
+    Type         string `json:"type"`
+    BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicMessage struct {
+    Role    string                  `json:"role"`
+    Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicContentBlock struct {
+    Type string `json:"type"`
+    Text string `json:"text"`
+}
+
+// anthropicStreamEvent covers the fields we read from any streaming event
+type anthropicStreamEvent struct {
+    Type  string `json:"type"`
+    Delta struct {
+        Type       string `json:"type"`
+        Text       string `json:"text"`
+        StopReason string `json:"stop_reason"`
+    } `json:"delta"`
+    Error *anthropicError `json:"error"`
+}
+
+type anthropicError struct {
+    Type    string `json:"type"`
+    Message string `json:"message"`
+}
+
+// NewAnthropicProvider creates a new Anthropic provider
+func NewAnthropicProvider(modelAlias string, settings config.Provider) (*AnthropicProvider, error) {
+    apiKey := settings.APIKey
+    if apiKey == "" {
+        return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable is not set. " +
+            "Please set it in your environment, create a .env file with:\n" +
+            "ANTHROPIC_API_KEY=sk-ant-your-api-key-here\n" +
+            "or set providers.anthropic.api_key in ~/.codewhisper/config.yaml")
+    }
+
+    if modelAlias == "" {
+        modelAlias = DefaultModel("anthropic")
+    }
+    modelID, exists := anthropicModelMap[modelAlias]
+    if !exists {
+        modelID = modelAlias // Use as-is if not in map
+    }
+
+    utils.Log.Info("Using Anthropic model: %s", modelID)
+    apiBase := defaultAnthropicAPIBase
+    if settings.APIBase != "" {
+        utils.Log.Info("Using custom API base: %s", settings.APIBase)
+        apiBase = settings.APIBase
+    }
+
+    return &AnthropicProvider{
+        // No overall timeout, responses are streamed for as long as the model writes
+        client:  &http.Client{},
+        apiKey:  apiKey,
+        apiBase: strings.TrimSuffix(apiBase, "/"),
+        modelID: modelID,
+    }, nil
+}
+
+// StreamChat implements streaming chat for Anthropic
+func (a *AnthropicProvider) StreamChat(ctx context.Context, conv Conversation) (<-chan StreamChunk, error) {
+    messages := buildAnthropicMessages(conv)
+    if len(messages) == 0 {
+        return nil, fmt.Errorf("no valid messages to send")
+    }
+
+    settings := conv.GenerationSettings()
+    req := anthropicRequest{
+        Model:             a.modelID,
+        System:            conv.System,
+        Messages:          messages,
+        Stream:            true,
+        anthropicSampling: newAnthropicSampling(settings),
+    }
+
+    utils.Log.Info("Creating Anthropic stream with model: %s, temperature: %.2f, maxTokens: %d, thinking: %t, messages: %d",
+        a.modelID, settings.Temperature, req.MaxTokens, settings.ThinkingMode, len(messages))
+
+    resp, err := a.post(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+
+    streamChan := make(chan StreamChunk, 100)
+
+    go func() {
+        defer close(streamChan)
+        defer resp.Body.Close()
+
+        send := func(chunk StreamChunk) bool {
+            select {
+            case streamChan <- chunk:
+                return true
+            case <-ctx.Done():
+                return false
+            }
+        }
+
+        reader := newSSEReader(resp.Body)
+        chunkCount := 0
+        for {
+            event, err := reader.Next()
+            if errors.Is(err, io.EOF) {
+                // Without message_stop the answer was cut off
+                utils.Log.Warning("Anthropic stream ended after %d chunks without message_stop", chunkCount)
+                send(StreamChunk{Error: fmt.Errorf("stream error: the response ended before message_stop")})
+                return
+            }
+            if err != nil {
+                send(StreamChunk{Error: fmt.Errorf("stream error: %w", err)})
+                return
+            }
+
+            if event.Data == "" {
+                continue
+            }
+
+            text, done, err := decodeAnthropicEvent([]byte(event.Data))
+            if err != nil {
+                utils.Log.Error("Anthropic stream error: %v", err)
+                send(StreamChunk{Error: fmt.Errorf("stream error: %w", err)})
+                return
+            }
+            if text != "" {
+                chunkCount++
+                if !send(StreamChunk{Content: text}) {
+                    return
+                }
+            }
+            if done {
+                utils.Log.Info("Anthropic stream completed after %d chunks", chunkCount)
+                return
+            }
+        }
+    }()
+
+    return streamChan, nil
+}
+
+// buildAnthropicMessages converts a conversation to Anthropic messages, with
+// each part as its own content block. Bedrock's Claude models take the same shape.
+func buildAnthropicMessages(conv Conversation) []anthropicMessage {
+    var messages []anthropicMessage
+    for _, msg := range conv.NormalizedMessages() {
+        blocks := make([]anthropicContentBlock, 0, len(msg.Parts))
+        for _, part := range msg.Parts {
+            blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Render()})
+        }
+        messages = append(messages, anthropicMessage{Role: string(msg.Role), Content: blocks})
+    }
+    return messages
+}
+
+// newAnthropicSampling converts generation settings to Anthropic options.
+// Extended thinking requires the default temperature and top_k, and top_p of
+// at least 0.95, so those are dropped when thinking is on.
+func newAnthropicSampling(s GenerationSettings) anthropicSampling {
+    sampling := anthropicSampling{
+        MaxTokens:     s.MaxOutputTokens,
+        StopSequences: s.StopSequences,
+    }
+
+    if s.ThinkingMode {
+        sampling.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: s.anthropicThinkingBudget()}
+        if s.TopP >= 0.95 {
+            sampling.TopP = &s.TopP
+        }
+        return sampling
+    }
+
+    sampling.Temperature = &s.Temperature
+    if s.TopP > 0 {
+        sampling.TopP = &s.TopP
+    }
+    sampling.TopK = s.TopK
+    return sampling
+}
+
+// decodeAnthropicEvent interprets one streaming event payload. It returns the
+// text delta if any, whether the message is complete, and any error the API reported.
+func decodeAnthropicEvent(raw []byte) (string, bool, error) {
+    var data anthropicStreamEvent
+    if err := json.Unmarshal(raw, &data); err != nil {
+        utils.Log.Warning("Skipping malformed Anthropic event: %v", err)
+        return "", false, nil
+    }
+
+    switch data.Type {
+    case "content_block_delta":
+        if data.Delta.Type == "text_delta" {
+            return data.Delta.Text, false, nil
+        }
+
+    case "message_delta":
+        if data.Delta.StopReason == "max_tokens" {
+            utils.Log.Warning("Anthropic response truncated at max_tokens")
+        }
+
+    case "message_stop":
+        return "", true, nil
+
+    case "error":
+        if data.Error != nil {
+            return "", true, fmt.Errorf("%s: %s", data.Error.Type, data.Error.Message)
+        }
+        return "", true, fmt.Errorf("unknown error")
+    }
+
+    return "", false, nil
+}
+
+// post sends a Messages API request and returns the response on HTTP 200
+func (a *AnthropicProvider) post(ctx context.Context, body anthropicRequest) (*http.Response, error) {
+    payload, err := json.Marshal(body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode request: %w", err)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.apiBase+"/v1/messages", bytes.NewReader(payload))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %w", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+    if body.Stream {
+        req.Header.Set("Accept", "text/event-stream")
+    }
+
+    return a.send(req)
+}
+
+// send authenticates a request and returns the response on HTTP 200
+func (a *AnthropicProvider) send(req *http.Request) (*http.Response, error) {
+    req.Header.Set("x-api-key", a.apiKey)
+    req.Header.Set("anthropic-version", anthropicAPIVersion)
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("request to Anthropic failed: %w", err)
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+        respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+        var apiErr struct {
+            Error anthropicError `json:"error"`
+        }
+        if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+            return nil, fmt.Errorf("Anthropic API error (%d %s): %s", resp.StatusCode, apiErr.Error.Type, apiErr.Error.Message)
+        }
+        return nil, fmt.Errorf("Anthropic API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+    }
+
+    return resp, nil
+}
+
+// ValidateAuth validates the Anthropic API key
+func (a *AnthropicProvider) ValidateAuth() error {
+    // Test with a minimal request
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    resp, err := a.post(ctx, anthropicRequest{
+        Model:             a.modelID,
+        Messages:          []anthropicMessage{{Role: string(RoleUser), Content: []anthropicContentBlock{{Type: "text", Text: "Hi"}}}},
+        anthropicSampling: anthropicSampling{MaxTokens: 5},
+    })
+    if err != nil {
+        return fmt.Errorf("Anthropic authentication failed: %w", err)
+    }
+    resp.Body.Close()
+
+    utils.Log.Info("Anthropic authentication successful")
+    return nil
+}
+
+// ListModels lists the models available to the API key via /v1/models
+func (a *AnthropicProvider) ListModels(ctx context.Context) ([]ModelSpec, error) {
+    specs := []ModelSpec{}
+    afterID := ""
+    for {
+        endpoint := a.apiBase + "/v1/models?limit=1000"
+        if afterID != "" {
+            endpoint += "&after_id=" + url.QueryEscape(afterID)
+        }
+        req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create request: %w", err)
+        }
+
+        resp, err := a.send(req)
+        if err != nil {
+            return nil, err
+        }
+
+        var page struct {
+            Data []struct {
+                ID          string `json:"id"`
+                DisplayName string `json:"display_name"`
+            } `json:"data"`
+            HasMore bool   `json:"has_more"`
+            LastID  string `json:"last_id"`
+        }
+        err = json.NewDecoder(resp.Body).Decode(&page)
+        resp.Body.Close()
+        if err != nil {
+            return nil, fmt.Errorf("failed to decode Anthropic model list: %w", err)
+        }
+
+        for _, m := range page.Data {
+            spec := LookupModel("anthropic", m.ID)
+            if m.DisplayName != "" {
+                spec.Name = m.DisplayName
+            }
+            specs = append(specs, spec)
+        }
+        if !page.HasMore || page.LastID == "" {
+            return specs, nil
+        }
+        afterID = page.LastID
+    }
+}
+
+// GetModelInfo returns information about the current model
+func (a *AnthropicProvider) GetModelInfo() ModelInfo {
+    return ModelInfo{
+        ModelID:   a.modelID,
+        Endpoint:  "anthropic",
+        MaxTokens: LookupModel("anthropic", a.modelID).ContextWindow,
+    }
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+// A stream recorded from the Messages API, trimmed to the events we read
+const anthropicStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_01","type":"message","role":"assistant","content":[],"model":"claude-3-5-sonnet-20241022","stop_reason":null,"usage":{"input_tokens":25,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}
+
+: keep-alive
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":", world"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":15}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+// streamResult is what a test read from a provider's stream
+type streamResult struct {
+	text string
+	err  error
+}
+
+func collectStream(t *testing.T, chunks <-chan StreamChunk) streamResult {
+	t.Helper()
+	var result streamResult
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return result
+			}
+			if chunk.Error != nil {
+				result.err = chunk.Error
+				continue
+			}
+			result.text += chunk.Content
+		case <-timeout:
+			t.Fatal("stream did not end")
+		}
+	}
+}
+
+func TestAnthropicStreamChat(t *testing.T) {
+	tests := []struct {
+		name string
+		// handler writes the response after the headers
+		handler func(w http.ResponseWriter)
+		text    string
+		err     string
+	}{
+		{
+			name:    "complete",
+			handler: func(w http.ResponseWriter) { io.WriteString(w, anthropicStream) },
+			text:    "Hello, world",
+		},
+		{
+			name: "stopped at max_tokens",
+			handler: func(w http.ResponseWriter) {
+				stream := strings.Replace(anthropicStream, `"stop_reason":"end_turn"`, `"stop_reason":"max_tokens"`, 1)
+				io.WriteString(w, stream)
+			},
+			text: "Hello, world",
+		},
+		{
+			name: "nothing after message_stop is read",
+			handler: func(w http.ResponseWriter) {
+				io.WriteString(w, anthropicStream)
+				io.WriteString(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"late\"}}\n\n")
+			},
+			text: "Hello, world",
+		},
+		{
+			name: "error event mid-stream",
+			handler: func(w http.ResponseWriter) {
+				before, _, _ := strings.Cut(anthropicStream, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\", world\"}}")
+				io.WriteString(w, before)
+				io.WriteString(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+				io.WriteString(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"late\"}}\n\n")
+			},
+			text: "Hello",
+			err:  "overloaded_error: Overloaded",
+		},
+		{
+			name: "malformed event skipped",
+			handler: func(w http.ResponseWriter) {
+				io.WriteString(w, "event: content_block_delta\ndata: {not json\n\n")
+				io.WriteString(w, anthropicStream)
+			},
+			text: "Hello, world",
+		},
+		{
+			name: "cut off before message_stop",
+			handler: func(w http.ResponseWriter) {
+				io.WriteString(w, anthropicStream[:strings.Index(anthropicStream, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\", world")])
+			},
+			text: "Hello",
+			err:  "ended before message_stop",
+		},
+		{
+			name: "connection dropped",
+			handler: func(w http.ResponseWriter) {
+				io.WriteString(w, anthropicStream[:strings.Index(anthropicStream, "event: content_block_stop")])
+				w.(http.Flusher).Flush()
+				// Abort closes the connection without ending the chunked body
+				panic(http.ErrAbortHandler)
+			},
+			text: "Hello, world",
+			err:  "stream error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body anthropicRequest
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") != anthropicAPIVersion {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(http.StatusOK)
+				tt.handler(w)
+			}))
+			defer srv.Close()
+
+			p, err := NewAnthropicProvider("sonnet3.5-v2", config.Provider{APIKey: "key", APIBase: srv.URL + "/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks, err := p.StreamChat(context.Background(), Conversation{
+				System:   "Be brief",
+				Messages: []Message{{Role: RoleUser, Parts: []ContentPart{TextPart("Hi")}}},
+			})
+			if err != nil {
+				t.Fatalf("StreamChat: %v", err)
+			}
+
+			got := collectStream(t, chunks)
+			if got.text != tt.text {
+				t.Errorf("text = %q, want %q", got.text, tt.text)
+			}
+			switch {
+			case tt.err == "" && got.err != nil:
+				t.Errorf("unexpected error: %v", got.err)
+			case tt.err != "" && (got.err == nil || !strings.Contains(got.err.Error(), tt.err)):
+				t.Errorf("error = %v, want %q", got.err, tt.err)
+			}
+
+			if body.Model != "claude-3-5-sonnet-20241022" || !body.Stream || body.System != "Be brief" {
+				t.Errorf("request = %+v", body)
+			}
+		})
+	}
+}
+
+func TestAnthropicAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+	}))
+	defer srv.Close()
+
+	p, err := NewAnthropicProvider("", config.Provider{APIKey: "bad", APIBase: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.StreamChat(context.Background(), Conversation{
+		Messages: []Message{{Role: RoleUser, Parts: []ContentPart{TextPart("Hi")}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "401 authentication_error") || !strings.Contains(err.Error(), "invalid x-api-key") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestSSEReader(t *testing.T) {
+	stream := ": comment\n\nevent: a\ndata: one\ndata: two\n\n\n\ndata:three\nid: 7\n\nevent: b\ndata: last"
+	reader := newSSEReader(strings.NewReader(stream))
+
+	want := []sseEvent{{Event: "a", Data: "one\ntwo"}, {Data: "three"}, {Event: "b", Data: "last"}}
+	for _, w := range want {
+		got, err := reader.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if got != w {
+			t.Errorf("event = %+v, want %+v", got, w)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next after the last event = %v, want io.EOF", err)
+	}
+}
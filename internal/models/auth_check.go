@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+// Endpoints lists every supported endpoint
+var Endpoints = []string{"openai", "anthropic", "bedrock", "google", "deepseek", "ollama"}
+
+// AuthCheck is the outcome of validating an endpoint's credentials
+type AuthCheck struct {
+    Endpoint string
+    ModelID  string
+    BaseURL  string
+    // Credential describes where credentials other than an API key came
+    // from
+    Credential string
+    Latency    time.Duration
+    Err        error
+}
+
+// ConfiguredEndpoints returns the endpoints set up in the configuration:
+// those with an API key, Bedrock when an AWS profile was chosen and Ollama
+// when its host was
+func ConfiguredEndpoints(cfg config.Config) []string {
+    var endpoints []string
+    for _, endpoint := range Endpoints {
+        configured := cfg.Provider(endpoint).APIKey != ""
+        switch endpoint {
+        case "bedrock":
+            configured = cfg.AWSProfile != ""
+        case "ollama":
+            configured = cfg.Providers.Ollama.APIBase != ""
+        }
+        if configured {
+            endpoints = append(endpoints, endpoint)
+        }
+    }
+    return endpoints
+}
+
+// CheckAuth builds the provider for an endpoint and model (the endpoint's
+// default when empty) and validates its credentials with a minimal request
+func CheckAuth(cfg config.Config, endpoint, model string) AuthCheck {
+    check := AuthCheck{Endpoint: endpoint}
+
+    provider, err := NewProvider(cfg, endpoint, model)
+    if err != nil {
+        check.Err = err
+        return check
+    }
+    check.ModelID = provider.GetModelInfo().ModelID
+
+    switch p := provider.(type) {
+    case *OpenAIProvider:
+        check.BaseURL = p.apiBase
+    case *AnthropicProvider:
+        check.BaseURL = p.apiBase
+    case *GeminiProvider:
+        check.BaseURL = p.apiBase
+    case *BedrockProvider:
+        check.BaseURL = p.endpoint
+        check.Credential = p.creds.Source
+    case *OllamaProvider:
+        check.BaseURL = p.host
+        check.Credential = "none needed"
+    }
+
+    start := time.Now()
+    check.Err = provider.ValidateAuth()
+    check.Latency = time.Since(start)
+    return check
+}
@@ -0,0 +1,287 @@
+package models
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+// awsCredentials holds static AWS credentials and where they came from
+type awsCredentials struct {
+    AccessKeyID     string
+    SecretAccessKey string
+    SessionToken    string
+    Source          string
+}
+
+// loadAWSCredentials resolves credentials the way the AWS CLI does for static
+// keys: an explicit profile wins, then AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY,
+// then the AWS_PROFILE (or "default") profile from the shared files.
+func loadAWSCredentials(profile string) (*awsCredentials, string, error) {
+    explicitProfile := profile != ""
+    if profile == "" {
+        profile = config.GetEnv("AWS_PROFILE", "default")
+    }
+
+    if !explicitProfile {
+        if keyID, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); keyID != "" && secret != "" {
+            return &awsCredentials{
+                AccessKeyID:     keyID,
+                SecretAccessKey: secret,
+                SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+                Source:          "environment",
+            }, profile, nil
+        }
+    }
+
+    credsFile := awsSharedFile("AWS_SHARED_CREDENTIALS_FILE", "credentials")
+    configFile := awsSharedFile("AWS_CONFIG_FILE", "config")
+
+    // Credentials may live in either file; the credentials file takes precedence
+    sources := []struct {
+        path    string
+        section string
+    }{
+        {credsFile, profile},
+        {configFile, configSection(profile)},
+    }
+    for _, src := range sources {
+        values, err := readINISection(src.path, src.section)
+        if err != nil {
+            continue
+        }
+        keyID, secret := values["aws_access_key_id"], values["aws_secret_access_key"]
+        if keyID != "" && secret != "" {
+            return &awsCredentials{
+                AccessKeyID:     keyID,
+                SecretAccessKey: secret,
+                SessionToken:    values["aws_session_token"],
+                Source:          fmt.Sprintf("profile %q in %s", profile, src.path),
+            }, profile, nil
+        }
+        if values["sso_session"] != "" || values["sso_start_url"] != "" || values["role_arn"] != "" {
+            return nil, profile, fmt.Errorf("AWS profile %q uses SSO or role assumption, which is not supported; "+
+                "export temporary credentials with `aws configure export-credentials --profile %s --format env`", profile, profile)
+        }
+    }
+
+    return nil, profile, fmt.Errorf("no AWS credentials found for profile %q (checked %s and %s)", profile, credsFile, configFile)
+}
+
+// loadAWSRegion resolves the region from the environment or the profile's config
+func loadAWSRegion(profile string) string {
+    if region := os.Getenv("AWS_REGION"); region != "" {
+        return region
+    }
+    if region := os.Getenv("AWS_DEFAULT_REGION"); region != "" {
+        return region
+    }
+    values, err := readINISection(awsSharedFile("AWS_CONFIG_FILE", "config"), configSection(profile))
+    if err == nil && values["region"] != "" {
+        return values["region"]
+    }
+    return "us-east-1"
+}
+
+func awsSharedFile(envKey, name string) string {
+    if path := os.Getenv(envKey); path != "" {
+        return path
+    }
+    homeDir, err := os.UserHomeDir()
+    if err != nil {
+        return filepath.Join(".aws", name)
+    }
+    return filepath.Join(homeDir, ".aws", name)
+}
+
+// configSection returns the section name of a profile in ~/.aws/config
+func configSection(profile string) string {
+    if profile == "default" {
+        return "default"
+    }
+    return "profile " + profile
+}
+
+// readINISection reads key/value pairs of one [section] from an AWS ini file
+func readINISection(path, section string) (map[string]string, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    values := make(map[string]string)
+    found := false
+    inSection := false
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+            continue
+        }
+        if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+            name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+            inSection = name == section
+            found = found || inSection
+            continue
+        }
+        if !inSection {
+            continue
+        }
+        if key, value, ok := strings.Cut(line, "="); ok {
+            values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+        }
+    }
+
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+    if !found {
+        return nil, fmt.Errorf("section [%s] not found in %s", section, path)
+    }
+    return values, nil
+}
+
+// signAWSRequest signs req in place with AWS Signature Version 4
+func signAWSRequest(req *http.Request, body []byte, creds *awsCredentials, region, service string, now time.Time) {
+    payloadHash := sha256Hex(body)
+    req.Header.Set("X-Amz-Date", now.UTC().Format("20060102T150405Z"))
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+    if creds.SessionToken != "" {
+        req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+    }
+
+    sig := computeSigV4(req, payloadHash, creds, region, service)
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        creds.AccessKeyID, sig.scope, sig.signedHeaders, sig.signature))
+}
+
+// sigV4 holds the intermediate steps of a signature along with the result
+type sigV4 struct {
+    canonicalRequest string
+    stringToSign     string
+    scope            string
+    signedHeaders    string
+    signature        string
+}
+
+// computeSigV4 signs a request whose X-Amz-Date header is already set,
+// covering the host and whichever of the headers we send are present
+func computeSigV4(req *http.Request, payloadHash string, creds *awsCredentials, region, service string) sigV4 {
+    amzDate := req.Header.Get("X-Amz-Date")
+    date := amzDate[:min(8, len(amzDate))]
+
+    headers := map[string]string{"host": req.URL.Host}
+    for _, name := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Content-Sha256", "X-Amz-Security-Token"} {
+        if v := req.Header.Get(name); v != "" {
+            headers[strings.ToLower(name)] = strings.TrimSpace(v)
+        }
+    }
+    names := make([]string, 0, len(headers))
+    for name := range headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var canonicalHeaders strings.Builder
+    for _, name := range names {
+        canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+    }
+
+    var sig sigV4
+    sig.signedHeaders = strings.Join(names, ";")
+    sig.canonicalRequest = strings.Join([]string{
+        req.Method,
+        canonicalURI(req.URL),
+        canonicalQuery(req.URL),
+        canonicalHeaders.String(),
+        sig.signedHeaders,
+        payloadHash,
+    }, "\n")
+
+    sig.scope = strings.Join([]string{date, region, service, "aws4_request"}, "/")
+    sig.stringToSign = strings.Join([]string{
+        "AWS4-HMAC-SHA256",
+        amzDate,
+        sig.scope,
+        sha256Hex([]byte(sig.canonicalRequest)),
+    }, "\n")
+
+    key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+    key = hmacSHA256(key, region)
+    key = hmacSHA256(key, service)
+    key = hmacSHA256(key, "aws4_request")
+    sig.signature = hex.EncodeToString(hmacSHA256(key, sig.stringToSign))
+    return sig
+}
+
+// canonicalURI URI-encodes each segment of the already escaped path, as SigV4
+// requires for every service except S3
+func canonicalURI(u *url.URL) string {
+    path := u.EscapedPath()
+    if path == "" {
+        return "/"
+    }
+    segments := strings.Split(path, "/")
+    for i, segment := range segments {
+        segments[i] = awsURIEncode(segment)
+    }
+    return strings.Join(segments, "/")
+}
+
+func canonicalQuery(u *url.URL) string {
+    query := u.Query()
+    keys := make([]string, 0, len(query))
+    for k := range query {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+
+    var parts []string
+    for _, k := range keys {
+        values := query[k]
+        sort.Strings(values)
+        for _, v := range values {
+            parts = append(parts, awsURIEncode(k)+"="+awsURIEncode(v))
+        }
+    }
+    return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything except RFC 3986 unreserved characters
+func awsURIEncode(s string) string {
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+            c == '-' || c == '_' || c == '.' || c == '~' {
+            b.WriteByte(c)
+        } else {
+            fmt.Fprintf(&b, "%%%02X", c)
+        }
+    }
+    return b.String()
+}
+
+func sha256Hex(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Credentials, date and scope shared by the AWS Signature Version 4 test suite
+var sigV4TestCreds = &awsCredentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+const sigV4TestDate = "20150830T123600Z"
+
+func TestComputeSigV4(t *testing.T) {
+	// Vectors from the AWS Signature Version 4 test suite
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		headers   map[string]string
+		body      string
+		creq      string
+		sts       string
+		signature string
+	}{
+		{
+			name:   "get-vanilla",
+			method: "GET",
+			url:    "https://example.amazonaws.com/",
+			creq: "GET\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			sts: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"bb579772317eb040ac9ed261061d46c1f17a8133879d6129b6e1c25292927e63",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "get-vanilla-query-order-key-case",
+			method: "GET",
+			url:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			creq: "GET\n/\nParam1=value1&Param2=value2\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			sts: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"816cd5b414d056048ba4f7c5386d6e0533120fb1fcfa93762cf0fc39e2cf19e0",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:   "get-unreserved",
+			method: "GET",
+			url:    "https://example.amazonaws.com/-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+			creq: "GET\n/-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			sts: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"6a968768eefaa713e2a6b16b589a8ea192661f098f37349f4e2c0082757446f9",
+			signature: "07ef7494c76fa4850883e2b006601f940f8a34d404d0cfa977f52a65bbf5f24f",
+		},
+		{
+			name:   "post-vanilla",
+			method: "POST",
+			url:    "https://example.amazonaws.com/",
+			creq: "POST\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			sts: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"553f88c9e4d10fc9e109e2aeb65f030801b70c2f6468faca261d401ae622fc87",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:    "post-x-www-form-urlencoded",
+			method:  "POST",
+			url:     "https://example.amazonaws.com/",
+			headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body:    "Param1=value1",
+			creq: "POST\n/\n\ncontent-type:application/x-www-form-urlencoded\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\ncontent-type;host;x-amz-date\n" +
+				"9095672bbd1f56dfc5b65f3e153adc8731a4a654192329106275f4c7b24d0b6e",
+			sts: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"42a5e5bb34198acb3e84da4f085bb7927f2bc277ca766e6d19c73c2154021281",
+			signature: "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Amz-Date", sigV4TestDate)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			sig := computeSigV4(req, sha256Hex([]byte(tt.body)), sigV4TestCreds, "us-east-1", "service")
+			if sig.canonicalRequest != tt.creq {
+				t.Errorf("canonical request =\n%s\nwant\n%s", sig.canonicalRequest, tt.creq)
+			}
+			if sig.stringToSign != tt.sts {
+				t.Errorf("string to sign =\n%s\nwant\n%s", sig.stringToSign, tt.sts)
+			}
+			if sig.signature != tt.signature {
+				t.Errorf("signature = %s, want %s", sig.signature, tt.signature)
+			}
+		})
+	}
+}
+
+func TestCanonicalURI(t *testing.T) {
+	// Every service but S3 encodes the already encoded path a second time
+	tests := []struct {
+		path, rawPath string
+		want          string
+	}{
+		{"", "", "/"},
+		{"/", "", "/"},
+		{"/example space/", "", "/example%2520space/"},
+		{"/ሴ", "", "/%25E1%2588%25B4"},
+		{
+			"/model/anthropic.claude-3-5-sonnet-20241022-v2:0/invoke",
+			"/model/anthropic.claude-3-5-sonnet-20241022-v2%3A0/invoke",
+			"/model/anthropic.claude-3-5-sonnet-20241022-v2%253A0/invoke",
+		},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "https://example.amazonaws.com", nil)
+		req.URL.Path, req.URL.RawPath = tt.path, tt.rawPath
+		if got := canonicalURI(req.URL); got != tt.want {
+			t.Errorf("canonicalURI(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	req, _ := http.NewRequest("POST", "https://bedrock-runtime.us-east-1.amazonaws.com/model/m/invoke", nil)
+	req.Header.Set("Content-Type", "application/json")
+	creds := *sigV4TestCreds
+	creds.SessionToken = "token"
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	signAWSRequest(req, []byte("{}"), &creds, "us-east-1", "bedrock", now)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/bedrock/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature="
+	if got := req.Header.Get("Authorization"); !strings.HasPrefix(got, want) {
+		t.Errorf("Authorization = %s, want prefix %s", got, want)
+	}
+	if req.Header.Get("X-Amz-Date") != sigV4TestDate || req.Header.Get("X-Amz-Security-Token") != "token" {
+		t.Errorf("headers = %v", req.Header)
+	}
+}
+
+// eventStreamFrame encodes a message as the event-stream protocol frames it
+func eventStreamFrame(headers map[string]string, payload string) []byte {
+	var h bytes.Buffer
+	for name, value := range headers {
+		h.WriteByte(byte(len(name)))
+		h.WriteString(name)
+		h.WriteByte(7)
+		binary.Write(&h, binary.BigEndian, uint16(len(value)))
+		h.WriteString(value)
+	}
+
+	var frame bytes.Buffer
+	binary.Write(&frame, binary.BigEndian, uint32(16+h.Len()+len(payload)))
+	binary.Write(&frame, binary.BigEndian, uint32(h.Len()))
+	binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	frame.Write(h.Bytes())
+	frame.WriteString(payload)
+	binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	return frame.Bytes()
+}
+
+func TestEventStreamReader(t *testing.T) {
+	valid := eventStreamFrame(map[string]string{":event-type": "chunk", ":message-type": "event"}, `{"bytes":"e30="}`)
+	corrupt := func(i int) []byte {
+		frame := bytes.Clone(valid)
+		frame[i] ^= 0xff
+		return frame
+	}
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		err     string
+		payload string
+	}{
+		{name: "valid frame", stream: valid, payload: `{"bytes":"e30="}`},
+		{name: "empty stream", stream: nil, err: "EOF"},
+		{name: "bad prelude CRC", stream: corrupt(9), err: "prelude checksum mismatch"},
+		{name: "bad length", stream: eventStreamFrameWithLength(valid, 8), err: "invalid event-stream message length"},
+		{name: "bad message CRC", stream: corrupt(len(valid) - 6), err: "message checksum mismatch"},
+		{name: "truncated prelude", stream: valid[:7], err: "truncated event-stream prelude"},
+		{name: "truncated frame", stream: valid[:len(valid)-3], err: "truncated event-stream message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := newEventStreamReader(bytes.NewReader(tt.stream)).Next()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Next error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Next: %v", err)
+			}
+			if string(msg.Payload) != tt.payload {
+				t.Errorf("payload = %q, want %q", msg.Payload, tt.payload)
+			}
+			if msg.Headers[":event-type"] != "chunk" || msg.Headers[":message-type"] != "event" {
+				t.Errorf("headers = %v", msg.Headers)
+			}
+		})
+	}
+}
+
+func TestEventStreamReaderSequence(t *testing.T) {
+	stream := append(eventStreamFrame(nil, "one"), eventStreamFrame(map[string]string{"a": "b"}, "")...)
+	reader := newEventStreamReader(bytes.NewReader(stream))
+
+	for _, want := range []string{"one", ""} {
+		msg, err := reader.Next()
+		if err != nil || string(msg.Payload) != want {
+			t.Fatalf("Next = %v, %v, want payload %q", msg, err, want)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next at the end = %v, want io.EOF", err)
+	}
+}
+
+// eventStreamFrameWithLength rewrites a frame's total length, keeping its
+// prelude checksum valid
+func eventStreamFrameWithLength(frame []byte, length uint32) []byte {
+	frame = bytes.Clone(frame)
+	binary.BigEndian.PutUint32(frame[0:4], length)
+	binary.BigEndian.PutUint32(frame[8:12], crc32.ChecksumIEEE(frame[0:8]))
+	return frame
+}
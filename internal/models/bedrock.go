@@ -0,0 +1,272 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+const bedrockAnthropicVersion = "bedrock-2023-05-31"
+
+// BedrockProvider implements the Provider interface for Claude models on AWS Bedrock
+type BedrockProvider struct {
+    client   *http.Client
+    creds    *awsCredentials
+    profile  string
+    region   string
+    endpoint string
+    modelID  string
+}
+
+// Model mapping for Bedrock, keyed by the aliases the UI already uses
+var bedrockModelMap = map[string]string{
+    "sonnet3.5-v2": "anthropic.claude-3-5-sonnet-20241022-v2:0",
+    "sonnet3.5":    "anthropic.claude-3-5-sonnet-20240620-v1:0",
+    "opus":         "anthropic.claude-3-opus-20240229-v1:0",
+    "sonnet":       "anthropic.claude-3-sonnet-20240229-v1:0",
+    "haiku":        "anthropic.claude-3-haiku-20240307-v1:0",
+}
+
+// bedrockRequest is the InvokeModel body for Anthropic models
+type bedrockRequest struct {
+    AnthropicVersion string             `json:"anthropic_version"`
+    System           string             `json:"system,omitempty"`
+    Messages         []anthropicMessage `json:"messages"`
+    anthropicSampling
+}
+
+// NewBedrockProvider creates a new Bedrock provider using credentials from
+// the --profile AWS profile (or the default credential sources)
+func NewBedrockProvider(modelAlias, profile string) (*BedrockProvider, error) {
+    creds, profile, err := loadAWSCredentials(profile)
+    if err != nil {
+        return nil, err
+    }
+    region := loadAWSRegion(profile)
+
+    if modelAlias == "" {
+        modelAlias = DefaultModel("bedrock")
+    }
+    modelID, exists := bedrockModelMap[modelAlias]
+    if !exists {
+        modelID = modelAlias // Use as-is if not in map
+    }
+
+    endpoint := fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", region)
+    if custom := config.GetEnv("AWS_ENDPOINT_URL_BEDROCK_RUNTIME", os.Getenv("AWS_ENDPOINT_URL")); custom != "" {
+        utils.Log.Info("Using custom Bedrock endpoint: %s", custom)
+        endpoint = custom
+    }
+
+    utils.Log.Info("Using Bedrock model: %s (region: %s, credentials: %s)", modelID, region, creds.Source)
+
+    return &BedrockProvider{
+        client:   &http.Client{},
+        creds:    creds,
+        profile:  profile,
+        region:   region,
+        endpoint: strings.TrimSuffix(endpoint, "/"),
+        modelID:  modelID,
+    }, nil
+}
+
+// StreamChat implements streaming chat via InvokeModelWithResponseStream
+func (b *BedrockProvider) StreamChat(ctx context.Context, conv Conversation) (<-chan StreamChunk, error) {
+    messages := buildAnthropicMessages(conv)
+    if len(messages) == 0 {
+        return nil, fmt.Errorf("no valid messages to send")
+    }
+
+    settings := conv.GenerationSettings()
+    req := bedrockRequest{
+        AnthropicVersion:  bedrockAnthropicVersion,
+        System:            conv.System,
+        Messages:          messages,
+        anthropicSampling: newAnthropicSampling(settings),
+    }
+
+    utils.Log.Info("Creating Bedrock stream with model: %s, temperature: %.2f, maxTokens: %d, thinking: %t, messages: %d",
+        b.modelID, settings.Temperature, req.MaxTokens, settings.ThinkingMode, len(messages))
+
+    resp, err := b.invoke(ctx, "invoke-with-response-stream", req)
+    if err != nil {
+        return nil, err
+    }
+
+    streamChan := make(chan StreamChunk, 100)
+
+    go func() {
+        defer close(streamChan)
+        defer resp.Body.Close()
+
+        send := func(chunk StreamChunk) bool {
+            select {
+            case streamChan <- chunk:
+                return true
+            case <-ctx.Done():
+                return false
+            }
+        }
+
+        reader := newEventStreamReader(resp.Body)
+        chunkCount := 0
+        for {
+            msg, err := reader.Next()
+            if errors.Is(err, io.EOF) {
+                utils.Log.Info("Bedrock stream completed after %d chunks", chunkCount)
+                return
+            }
+            if err != nil {
+                utils.Log.Error("Bedrock stream error: %v", err)
+                send(StreamChunk{Error: fmt.Errorf("stream error: %w", err)})
+                return
+            }
+
+            if msg.Headers[":message-type"] == "exception" || msg.Headers[":message-type"] == "error" {
+                err := bedrockException(msg)
+                utils.Log.Error("Bedrock stream error: %v", err)
+                send(StreamChunk{Error: fmt.Errorf("stream error: %w", err)})
+                return
+            }
+            if msg.Headers[":event-type"] != "chunk" {
+                continue
+            }
+
+            // Chunk payloads wrap the Anthropic streaming event in base64
+            var chunk struct {
+                Bytes []byte `json:"bytes"`
+            }
+            if err := json.Unmarshal(msg.Payload, &chunk); err != nil {
+                utils.Log.Warning("Skipping malformed Bedrock chunk: %v", err)
+                continue
+            }
+
+            text, done, err := decodeAnthropicEvent(chunk.Bytes)
+            if err != nil {
+                send(StreamChunk{Error: fmt.Errorf("stream error: %w", err)})
+                return
+            }
+            if text != "" {
+                chunkCount++
+                if !send(StreamChunk{Content: text}) {
+                    return
+                }
+            }
+            if done {
+                utils.Log.Info("Bedrock stream completed after %d chunks", chunkCount)
+                return
+            }
+        }
+    }()
+
+    return streamChan, nil
+}
+
+// bedrockException builds an error from an exception frame
+func bedrockException(msg *eventStreamMessage) error {
+    kind := msg.Headers[":exception-type"]
+    if kind == "" {
+        kind = msg.Headers[":error-code"]
+    }
+    var body struct {
+        Message string `json:"message"`
+    }
+    if json.Unmarshal(msg.Payload, &body) == nil && body.Message != "" {
+        return fmt.Errorf("%s: %s", kind, body.Message)
+    }
+    return fmt.Errorf("%s: %s", kind, strings.TrimSpace(string(msg.Payload)))
+}
+
+// invoke sends a signed request to /model/{modelId}/{action} and returns the response on HTTP 200
+func (b *BedrockProvider) invoke(ctx context.Context, action string, body bedrockRequest) (*http.Response, error) {
+    payload, err := json.Marshal(body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode request: %w", err)
+    }
+
+    u, err := url.Parse(b.endpoint)
+    if err != nil {
+        return nil, fmt.Errorf("invalid Bedrock endpoint %q: %w", b.endpoint, err)
+    }
+    // Model IDs contain ':' which must travel percent-encoded
+    base := strings.TrimSuffix(u.Path, "/")
+    u.Path = base + "/model/" + b.modelID + "/" + action
+    u.RawPath = base + "/model/" + strings.ReplaceAll(url.PathEscape(b.modelID), ":", "%3A") + "/" + action
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(payload))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %w", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+    // Accept describes the model output inside the (possibly event-stream) response
+    req.Header.Set("X-Amzn-Bedrock-Accept", "application/json")
+    signAWSRequest(req, payload, b.creds, b.region, "bedrock", time.Now())
+
+    resp, err := b.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("request to Bedrock failed: %w", err)
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+        respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+        var apiErr struct {
+            Message string `json:"message"`
+        }
+        kind := resp.Header.Get("X-Amzn-Errortype")
+        if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Message != "" {
+            return nil, fmt.Errorf("Bedrock API error (%d %s): %s", resp.StatusCode, kind, apiErr.Message)
+        }
+        return nil, fmt.Errorf("Bedrock API error (%d %s): %s", resp.StatusCode, kind, strings.TrimSpace(string(respBody)))
+    }
+
+    return resp, nil
+}
+
+// ValidateAuth validates the AWS credentials and model access
+func (b *BedrockProvider) ValidateAuth() error {
+    // Test with a minimal request
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    resp, err := b.invoke(ctx, "invoke", bedrockRequest{
+        AnthropicVersion:  bedrockAnthropicVersion,
+        Messages:          []anthropicMessage{{Role: string(RoleUser), Content: []anthropicContentBlock{{Type: "text", Text: "Hi"}}}},
+        anthropicSampling: anthropicSampling{MaxTokens: 5},
+    })
+    if err != nil {
+        return fmt.Errorf("Bedrock authentication failed (profile %s): %w", b.profile, err)
+    }
+    resp.Body.Close()
+
+    utils.Log.Info("Bedrock authentication successful")
+    return nil
+}
+
+// ListModels returns the built-in Bedrock model list. Listing foundation
+// models needs the Bedrock control-plane API and extra IAM permissions, so
+// the runtime credentials aren't asked.
+func (b *BedrockProvider) ListModels(ctx context.Context) ([]ModelSpec, error) {
+    return StaticModels("bedrock"), nil
+}
+
+// GetModelInfo returns information about the current model
+func (b *BedrockProvider) GetModelInfo() ModelInfo {
+    return ModelInfo{
+        ModelID:   b.modelID,
+        Endpoint:  "bedrock",
+        MaxTokens: LookupModel("bedrock", b.modelID).ContextWindow,
+    }
+}
@@ -0,0 +1,285 @@
+package models
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/tokenizer"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+const (
+    // catalogTTL is how long a provider's model list is reused before refetching
+    catalogTTL = 10 * time.Minute
+    // catalogRetry is how long a failed fetch's fallback list is reused, so
+    // a provider that is down isn't asked again on every request
+    catalogRetry = 30 * time.Second
+)
+
+// ModelSpec describes a model and what it can do
+type ModelSpec struct {
+    ID               string  `json:"id"`
+    Name             string  `json:"name"`
+    Alias            string  `json:"alias,omitempty"`
+    Endpoint         string  `json:"endpoint"`
+    ContextWindow    int     `json:"context_window"`
+    MaxOutputTokens  int     `json:"max_output_tokens"`
+    SupportsVision   bool    `json:"supports_vision"`
+    SupportsTools    bool    `json:"supports_tools"`
+    SupportsThinking bool    `json:"supports_thinking"`
+    SupportsTopK     bool    `json:"supports_top_k"`
+    MaxTemperature   float64 `json:"max_temperature"`
+    Tokenizer        string  `json:"tokenizer"`
+}
+
+// knownModels holds limits for models whose APIs don't report them, keyed by
+// the provider-neutral model ID (Bedrock IDs are normalized by knownModelKey)
+var knownModels = map[string]ModelSpec{
+    // Anthropic
+    "claude-sonnet-4-20250514":   {Name: "Claude Sonnet 4", ContextWindow: 200000, MaxOutputTokens: 64000, SupportsVision: true, SupportsTools: true, SupportsThinking: true},
+    "claude-opus-4-20250514":     {Name: "Claude Opus 4", ContextWindow: 200000, MaxOutputTokens: 32000, SupportsVision: true, SupportsTools: true, SupportsThinking: true},
+    "claude-3-7-sonnet-20250219": {Name: "Claude 3.7 Sonnet", ContextWindow: 200000, MaxOutputTokens: 64000, SupportsVision: true, SupportsTools: true, SupportsThinking: true},
+    "claude-3-5-sonnet-20241022": {Name: "Claude 3.5 Sonnet v2", ContextWindow: 200000, MaxOutputTokens: 8192, SupportsVision: true, SupportsTools: true},
+    "claude-3-5-sonnet-20240620": {Name: "Claude 3.5 Sonnet", ContextWindow: 200000, MaxOutputTokens: 8192, SupportsVision: true, SupportsTools: true},
+    "claude-3-5-haiku-20241022":  {Name: "Claude 3.5 Haiku", ContextWindow: 200000, MaxOutputTokens: 8192, SupportsTools: true},
+    "claude-3-opus-20240229":     {Name: "Claude 3 Opus", ContextWindow: 200000, MaxOutputTokens: 4096, SupportsVision: true, SupportsTools: true},
+    "claude-3-sonnet-20240229":   {Name: "Claude 3 Sonnet", ContextWindow: 200000, MaxOutputTokens: 4096, SupportsVision: true, SupportsTools: true},
+    "claude-3-haiku-20240307":    {Name: "Claude 3 Haiku", ContextWindow: 200000, MaxOutputTokens: 4096, SupportsVision: true, SupportsTools: true},
+
+    // OpenAI
+    "gpt-4o":              {Name: "GPT-4o", ContextWindow: 128000, MaxOutputTokens: 16384, SupportsVision: true, SupportsTools: true},
+    "gpt-4o-mini":         {Name: "GPT-4o mini", ContextWindow: 128000, MaxOutputTokens: 16384, SupportsVision: true, SupportsTools: true},
+    "gpt-4-turbo":         {Name: "GPT-4 Turbo", ContextWindow: 128000, MaxOutputTokens: 4096, SupportsVision: true, SupportsTools: true},
+    "gpt-4-turbo-preview": {Name: "GPT-4 Turbo Preview", ContextWindow: 128000, MaxOutputTokens: 4096, SupportsTools: true},
+    "gpt-4-1106-preview":  {Name: "GPT-4 Turbo (1106)", ContextWindow: 128000, MaxOutputTokens: 4096, SupportsTools: true},
+    "gpt-4":               {Name: "GPT-4", ContextWindow: 8192, MaxOutputTokens: 8192, SupportsTools: true},
+    "gpt-3.5-turbo":       {Name: "GPT-3.5 Turbo", ContextWindow: 16385, MaxOutputTokens: 4096, SupportsTools: true},
+    "o1":                  {Name: "o1", ContextWindow: 200000, MaxOutputTokens: 100000, SupportsVision: true, SupportsTools: true, SupportsThinking: true},
+    "o3-mini":             {Name: "o3-mini", ContextWindow: 200000, MaxOutputTokens: 100000, SupportsTools: true, SupportsThinking: true},
+
+    // DeepSeek
+    "deepseek-chat":     {Name: "DeepSeek V3", ContextWindow: 64000, MaxOutputTokens: 8192, SupportsTools: true},
+    "deepseek-reasoner": {Name: "DeepSeek R1", ContextWindow: 64000, MaxOutputTokens: 8192, SupportsThinking: true},
+
+    // Google
+    "gemini-1.5-pro":   {Name: "Gemini 1.5 Pro", ContextWindow: 2097152, MaxOutputTokens: 8192, SupportsVision: true, SupportsTools: true, SupportsTopK: true},
+    "gemini-1.5-flash": {Name: "Gemini 1.5 Flash", ContextWindow: 1048576, MaxOutputTokens: 8192, SupportsVision: true, SupportsTools: true, SupportsTopK: true},
+    "gemini-2.0-flash": {Name: "Gemini 2.0 Flash", ContextWindow: 1048576, MaxOutputTokens: 8192, SupportsVision: true, SupportsTools: true, SupportsTopK: true},
+    "gemini-2.5-pro":   {Name: "Gemini 2.5 Pro", ContextWindow: 1048576, MaxOutputTokens: 65536, SupportsVision: true, SupportsTools: true, SupportsThinking: true, SupportsTopK: true},
+    "gemini-2.5-flash": {Name: "Gemini 2.5 Flash", ContextWindow: 1048576, MaxOutputTokens: 65536, SupportsVision: true, SupportsTools: true, SupportsThinking: true, SupportsTopK: true},
+}
+
+// endpointDefaults are the limits assumed for models missing from knownModels
+var endpointDefaults = map[string]ModelSpec{
+    "anthropic": {ContextWindow: 200000, MaxOutputTokens: 4096, SupportsTools: true},
+    "bedrock":   {ContextWindow: 200000, MaxOutputTokens: 4096, SupportsTools: true},
+    "openai":    {ContextWindow: 128000, MaxOutputTokens: 4096, SupportsTools: true},
+    "deepseek":  {ContextWindow: 64000, MaxOutputTokens: 8192},
+    "google":    {ContextWindow: 32768, MaxOutputTokens: 8192, SupportsTopK: true},
+    "ollama":    {ContextWindow: defaultOllamaNumCtx, MaxOutputTokens: 4096, SupportsTopK: true},
+}
+
+// bedrockModelPattern matches Bedrock IDs such as
+// us.anthropic.claude-3-5-sonnet-20241022-v2:0
+var bedrockModelPattern = regexp.MustCompile(`^(?:[a-z]{2}\.)?anthropic\.(.+?)-v\d+(?::\d+)?$`)
+
+// knownModelKey maps a provider model ID to its knownModels key
+func knownModelKey(modelID string) string {
+    if m := bedrockModelPattern.FindStringSubmatch(modelID); m != nil {
+        return m[1]
+    }
+    return strings.TrimPrefix(modelID, "models/")
+}
+
+// LookupModel returns the spec for a model, filling in what we know about it
+// and falling back to the endpoint's defaults
+func LookupModel(endpoint, modelID string) ModelSpec {
+    spec, ok := knownModels[knownModelKey(modelID)]
+    if !ok {
+        spec = endpointDefaults[endpoint]
+        spec.Name = modelID
+    }
+
+    spec.ID = modelID
+    spec.Endpoint = endpoint
+    spec.Alias = aliasFor(endpoint, modelID)
+    if spec.ContextWindow == 0 {
+        spec.ContextWindow = 4096
+    }
+    if spec.MaxOutputTokens == 0 {
+        spec.MaxOutputTokens = 4096
+    }
+    if spec.MaxTemperature == 0 {
+        spec.MaxTemperature = maxTemperature(endpoint)
+    }
+    spec.Tokenizer = tokenizer.ForModel(endpoint, modelID)
+    // Claude models accept top_k on every endpoint that serves them
+    if endpoint == "anthropic" || endpoint == "bedrock" {
+        spec.SupportsTopK = true
+    }
+    return spec
+}
+
+// maxTemperature returns the upper bound of the endpoint's temperature range
+func maxTemperature(endpoint string) float64 {
+    switch endpoint {
+    case "anthropic", "bedrock":
+        return 1
+    default:
+        return 2
+    }
+}
+
+// aliasMaps returns the alias-to-ID map used by the endpoint's provider
+func aliasMaps(endpoint string) map[string]string {
+    switch endpoint {
+    case "openai":
+        return openAIModelMap
+    case "anthropic":
+        return anthropicModelMap
+    case "bedrock":
+        return bedrockModelMap
+    case "google":
+        return geminiModelMap
+    case "deepseek":
+        return deepSeekModelMap
+    }
+    return nil
+}
+
+// defaultModels holds the model each endpoint uses when none is configured
+var defaultModels = map[string]string{
+    "openai":    "gpt-4-turbo",
+    "anthropic": "sonnet3.5-v2",
+    "bedrock":   "sonnet3.5-v2",
+    "google":    "gemini-1.5-pro",
+    "deepseek":  "deepseek-chat",
+    "ollama":    "llama3.1",
+}
+
+// DefaultModel returns the model an endpoint uses when none is configured
+func DefaultModel(endpoint string) string {
+    return defaultModels[endpoint]
+}
+
+// ResolveModelID maps a UI alias such as sonnet3.5-v2 to the endpoint's
+// model ID; unknown names are returned as-is
+func ResolveModelID(endpoint, alias string) string {
+    if id, ok := aliasMaps(endpoint)[alias]; ok {
+        return id
+    }
+    return alias
+}
+
+// aliasFor returns the shortest alias that resolves to modelID, if any
+func aliasFor(endpoint, modelID string) string {
+    alias := ""
+    for a, id := range aliasMaps(endpoint) {
+        if id != modelID || a == modelID {
+            continue
+        }
+        if alias == "" || len(a) < len(alias) || (len(a) == len(alias) && a < alias) {
+            alias = a
+        }
+    }
+    return alias
+}
+
+// StaticModels returns the built-in model list for an endpoint, used when the
+// provider can't be asked. Endpoints without one get an empty list, never
+// nil, so it encodes as a JSON array.
+func StaticModels(endpoint string) []ModelSpec {
+    seen := make(map[string]bool)
+    specs := []ModelSpec{}
+    for _, id := range aliasMaps(endpoint) {
+        if seen[id] {
+            continue
+        }
+        seen[id] = true
+        specs = append(specs, LookupModel(endpoint, id))
+    }
+    sortModels(specs)
+    return specs
+}
+
+// sortModels orders specs by name for stable output
+func sortModels(specs []ModelSpec) {
+    sort.Slice(specs, func(i, j int) bool {
+        if specs[i].Name != specs[j].Name {
+            return specs[i].Name < specs[j].Name
+        }
+        return specs[i].ID < specs[j].ID
+    })
+}
+
+// catalogEntry is one endpoint's cached model list. A fallback list kept
+// after a failed fetch has err set and expires sooner.
+type catalogEntry struct {
+    models    []ModelSpec
+    expiresAt time.Time
+    err       error
+}
+
+// ModelCatalog caches each endpoint's model list
+type ModelCatalog struct {
+    mu      sync.Mutex
+    ttl     time.Duration
+    entries map[string]catalogEntry
+}
+
+// NewModelCatalog creates a catalog that refetches lists older than ttl
+func NewModelCatalog(ttl time.Duration) *ModelCatalog {
+    return &ModelCatalog{
+        ttl:     ttl,
+        entries: make(map[string]catalogEntry),
+    }
+}
+
+// Models returns the models offered by a provider, never nil. A failed
+// fetch falls back to the last good list, then to the static list, and
+// reports the error; the fallback is reused for catalogRetry before the
+// provider is asked again.
+func (c *ModelCatalog) Models(ctx context.Context, endpoint string, provider Provider) ([]ModelSpec, error) {
+    c.mu.Lock()
+    entry, cached := c.entries[endpoint]
+    c.mu.Unlock()
+
+    if cached && time.Now().Before(entry.expiresAt) {
+        return entry.models, entry.err
+    }
+
+    specs, err := provider.ListModels(ctx)
+    if err != nil {
+        utils.Log.Warning("Failed to list %s models: %v", endpoint, err)
+        fallback := entry.models
+        if !cached {
+            fallback = StaticModels(endpoint)
+        }
+        c.mu.Lock()
+        c.entries[endpoint] = catalogEntry{models: fallback, expiresAt: time.Now().Add(min(catalogRetry, c.ttl)), err: err}
+        c.mu.Unlock()
+        return fallback, err
+    }
+    if specs == nil {
+        specs = []ModelSpec{}
+    }
+    sortModels(specs)
+
+    c.mu.Lock()
+    c.entries[endpoint] = catalogEntry{models: specs, expiresAt: time.Now().Add(c.ttl)}
+    c.mu.Unlock()
+
+    utils.Log.Info("Cached %d %s models", len(specs), endpoint)
+    return specs, nil
+}
+
+// Invalidate drops the cached list for an endpoint
+func (c *ModelCatalog) Invalidate(endpoint string) {
+    c.mu.Lock()
+    delete(c.entries, endpoint)
+    c.mu.Unlock()
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStaticModels(t *testing.T) {
+	for _, endpoint := range Endpoints {
+		specs := StaticModels(endpoint)
+		data, err := json.Marshal(specs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != '[' {
+			t.Errorf("StaticModels(%q) encodes as %s, want an array", endpoint, data)
+		}
+		if endpoint != "ollama" && len(specs) == 0 {
+			t.Errorf("StaticModels(%q) is empty", endpoint)
+		}
+	}
+}
+
+// listProvider is a Provider whose model list is scripted
+type listProvider struct {
+	Provider
+	specs []ModelSpec
+	err   error
+	calls int
+}
+
+func (p *listProvider) ListModels(ctx context.Context) ([]ModelSpec, error) {
+	p.calls++
+	return p.specs, p.err
+}
+
+func TestModelCatalog(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no matching models", func(t *testing.T) {
+		c := NewModelCatalog(time.Minute)
+		specs, err := c.Models(ctx, "openai", &listProvider{})
+		if err != nil || specs == nil {
+			t.Errorf("Models = %#v, %v, want an empty list", specs, err)
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		c := NewModelCatalog(time.Minute)
+		p := &listProvider{specs: []ModelSpec{{ID: "b", Name: "B"}, {ID: "a", Name: "A"}}}
+		for i := 0; i < 3; i++ {
+			specs, err := c.Models(ctx, "openai", p)
+			if err != nil || len(specs) != 2 || specs[0].ID != "a" {
+				t.Fatalf("Models = %v, %v", specs, err)
+			}
+		}
+		if p.calls != 1 {
+			t.Errorf("listed %d times, want 1", p.calls)
+		}
+	})
+
+	t.Run("failure falls back to the static list and is cached", func(t *testing.T) {
+		c := NewModelCatalog(time.Minute)
+		p := &listProvider{err: errors.New("down")}
+		for i := 0; i < 3; i++ {
+			specs, err := c.Models(ctx, "anthropic", p)
+			if err == nil || len(specs) != len(StaticModels("anthropic")) {
+				t.Fatalf("Models = %d specs, %v, want the static list and the error", len(specs), err)
+			}
+		}
+		if p.calls != 1 {
+			t.Errorf("listed %d times while down, want 1", p.calls)
+		}
+	})
+
+	t.Run("failure keeps the last good list", func(t *testing.T) {
+		c := NewModelCatalog(0)
+		p := &listProvider{specs: []ModelSpec{{ID: "a"}}}
+		c.Models(ctx, "openai", p)
+		p.specs, p.err = nil, errors.New("down")
+		specs, err := c.Models(ctx, "openai", p)
+		if err == nil || len(specs) != 1 || specs[0].ID != "a" {
+			t.Errorf("Models = %v, %v, want the last good list", specs, err)
+		}
+
+		// A zero TTL retries every time
+		p.specs, p.err = []ModelSpec{{ID: "b"}}, nil
+		if specs, err := c.Models(ctx, "openai", p); err != nil || specs[0].ID != "b" {
+			t.Errorf("Models after recovery = %v, %v", specs, err)
+		}
+	})
+}
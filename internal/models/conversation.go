@@ -0,0 +1,121 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role identifies the author of a message
+type Role string
+
+// Message roles. The system prompt travels separately in Conversation.System.
+const (
+    RoleUser      Role = "user"
+    RoleAssistant Role = "assistant"
+)
+
+// Content part types
+const (
+    PartText = "text"
+    PartFile = "file"
+)
+
+// FileAttachment is a source file sent to the model as context
+type FileAttachment struct {
+    Path    string
+    Content string
+}
+
+// ContentPart is one piece of a message: plain text or a file attachment
+type ContentPart struct {
+    Type string
+    Text string
+    File *FileAttachment
+}
+
+// TextPart creates a text content part
+func TextPart(text string) ContentPart {
+    return ContentPart{Type: PartText, Text: text}
+}
+
+// FilePart creates a file attachment content part
+func FilePart(path, content string) ContentPart {
+    return ContentPart{Type: PartFile, File: &FileAttachment{Path: path, Content: content}}
+}
+
+// Render returns the part as plain text, for providers without native attachments
+func (p ContentPart) Render() string {
+    if p.Type == PartFile && p.File != nil {
+        return fmt.Sprintf("File: %s\n%s\n", p.File.Path, p.File.Content)
+    }
+    return p.Text
+}
+
+// empty reports whether the part carries no content
+func (p ContentPart) empty() bool {
+    if p.Type == PartFile {
+        return p.File == nil
+    }
+    return strings.TrimSpace(p.Text) == ""
+}
+
+// Message is a single conversation turn
+type Message struct {
+    Role  Role
+    Parts []ContentPart
+}
+
+// Text renders all parts of the message into a single string
+func (m Message) Text() string {
+    rendered := make([]string, 0, len(m.Parts))
+    for _, part := range m.Parts {
+        rendered = append(rendered, part.Render())
+    }
+    return strings.Join(rendered, "\n")
+}
+
+// Conversation is everything a provider needs for one request
+type Conversation struct {
+    System   string
+    Messages []Message
+    Settings GenerationSettings
+}
+
+// GenerationSettings returns the conversation's settings, or the defaults
+// when none were set
+func (c Conversation) GenerationSettings() GenerationSettings {
+    if c.Settings.MaxOutputTokens == 0 {
+        return DefaultGenerationSettings()
+    }
+    return c.Settings
+}
+
+// NormalizedMessages returns the messages in the shape every API accepts:
+// empty parts and messages dropped, consecutive turns of the same role merged,
+// and starting with a user turn
+func (c Conversation) NormalizedMessages() []Message {
+    var messages []Message
+
+    for _, msg := range c.Messages {
+        var parts []ContentPart
+        for _, part := range msg.Parts {
+            if !part.empty() {
+                parts = append(parts, part)
+            }
+        }
+        if len(parts) == 0 {
+            continue
+        }
+
+        if n := len(messages); n > 0 && messages[n-1].Role == msg.Role {
+            messages[n-1].Parts = append(messages[n-1].Parts, parts...)
+            continue
+        }
+        if len(messages) == 0 && msg.Role != RoleUser {
+            continue
+        }
+        messages = append(messages, Message{Role: msg.Role, Parts: parts})
+    }
+
+    return messages
+}
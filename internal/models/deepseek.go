@@ -0,0 +1,59 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+const defaultDeepSeekAPIBase = "https://api.deepseek.com/v1"
+
+// Model mapping for DeepSeek
+var deepSeekModelMap = map[string]string{
+    "deepseek":          "deepseek-chat",
+    "deepseek-v3":       "deepseek-chat",
+    "deepseek-coder":    "deepseek-chat",
+    "deepseek-chat":     "deepseek-chat",
+    "deepseek-r1":       "deepseek-reasoner",
+    "deepseek-reasoner": "deepseek-reasoner",
+}
+
+// NewDeepSeekProvider creates a provider for DeepSeek, whose API is
+// OpenAI-compatible so it reuses OpenAIProvider with a different base URL
+func NewDeepSeekProvider(modelAlias string, settings config.Provider) (*OpenAIProvider, error) {
+    apiKey := settings.APIKey
+    if apiKey == "" {
+        return nil, fmt.Errorf("DEEPSEEK_API_KEY environment variable is not set. " +
+            "Please set it in your environment, create a .env file with:\n" +
+            "DEEPSEEK_API_KEY=sk-your-api-key-here\n" +
+            "or set providers.deepseek.api_key in ~/.codewhisper/config.yaml")
+    }
+
+    if modelAlias == "" {
+        modelAlias = DefaultModel("deepseek")
+    }
+    modelID, exists := deepSeekModelMap[modelAlias]
+    if !exists {
+        modelID = modelAlias // Use as-is if not in map
+    }
+
+    utils.Log.Info("Using DeepSeek model: %s", modelID)
+    apiBase := defaultDeepSeekAPIBase
+    if settings.APIBase != "" {
+        utils.Log.Info("Using custom API base: %s", settings.APIBase)
+        apiBase = settings.APIBase
+    }
+
+    clientConfig := openai.DefaultConfig(apiKey)
+    clientConfig.BaseURL = apiBase
+
+    return &OpenAIProvider{
+        client:   openai.NewClientWithConfig(clientConfig),
+        apiBase:  apiBase,
+        modelID:  modelID,
+        endpoint: "deepseek",
+    }, nil
+}
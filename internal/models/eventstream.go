@@ -0,0 +1,122 @@
+package models
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// eventStreamMessage is one frame of the AWS event-stream binary protocol
+// (application/vnd.amazon.eventstream)
+type eventStreamMessage struct {
+    Headers map[string]string
+    Payload []byte
+}
+
+// eventStreamReader decodes event-stream frames:
+//
+//	total length (4) | headers length (4) | prelude CRC (4) | headers | payload | message CRC (4)
+type eventStreamReader struct {
+    r io.Reader
+}
+
+func newEventStreamReader(r io.Reader) *eventStreamReader {
+    return &eventStreamReader{r: r}
+}
+
+// maxEventStreamMessage bounds a single frame so a corrupt length can't exhaust memory
+const maxEventStreamMessage = 16 * 1024 * 1024
+
+// Next returns the next message, or io.EOF at the end of the stream
+func (er *eventStreamReader) Next() (*eventStreamMessage, error) {
+    prelude := make([]byte, 12)
+    if _, err := io.ReadFull(er.r, prelude); err != nil {
+        if err == io.ErrUnexpectedEOF {
+            return nil, fmt.Errorf("truncated event-stream prelude")
+        }
+        return nil, err
+    }
+
+    totalLen := binary.BigEndian.Uint32(prelude[0:4])
+    headersLen := binary.BigEndian.Uint32(prelude[4:8])
+    if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+        return nil, fmt.Errorf("event-stream prelude checksum mismatch")
+    }
+    if totalLen < 16 || totalLen > maxEventStreamMessage || headersLen > totalLen-16 {
+        return nil, fmt.Errorf("invalid event-stream message length %d (headers %d)", totalLen, headersLen)
+    }
+
+    rest := make([]byte, totalLen-12)
+    if _, err := io.ReadFull(er.r, rest); err != nil {
+        return nil, fmt.Errorf("truncated event-stream message: %w", err)
+    }
+
+    crc := crc32.NewIEEE()
+    crc.Write(prelude)
+    crc.Write(rest[:len(rest)-4])
+    if crc.Sum32() != binary.BigEndian.Uint32(rest[len(rest)-4:]) {
+        return nil, fmt.Errorf("event-stream message checksum mismatch")
+    }
+
+    headers, err := decodeEventStreamHeaders(rest[:headersLen])
+    if err != nil {
+        return nil, err
+    }
+
+    return &eventStreamMessage{
+        Headers: headers,
+        Payload: rest[headersLen : len(rest)-4],
+    }, nil
+}
+
+// decodeEventStreamHeaders parses the header block. Only string values are kept,
+// other types are skipped since Bedrock only sends strings.
+func decodeEventStreamHeaders(data []byte) (map[string]string, error) {
+    headers := make(map[string]string)
+    errTruncated := fmt.Errorf("truncated event-stream header")
+
+    for len(data) > 0 {
+        nameLen := int(data[0])
+        if len(data) < 1+nameLen+1 {
+            return nil, errTruncated
+        }
+        name := string(data[1 : 1+nameLen])
+        valueType := data[1+nameLen]
+        data = data[2+nameLen:]
+
+        var size int
+        switch valueType {
+        case 0, 1: // bool true / false
+            size = 0
+        case 2: // byte
+            size = 1
+        case 3: // int16
+            size = 2
+        case 4: // int32
+            size = 4
+        case 5, 8: // int64, timestamp
+            size = 8
+        case 9: // uuid
+            size = 16
+        case 6, 7: // byte array, string
+            if len(data) < 2 {
+                return nil, errTruncated
+            }
+            size = int(binary.BigEndian.Uint16(data[:2]))
+            data = data[2:]
+        default:
+            return nil, fmt.Errorf("unknown event-stream header type %d", valueType)
+        }
+
+        if len(data) < size {
+            return nil, errTruncated
+        }
+        if valueType == 7 {
+            headers[name] = string(data[:size])
+        }
+        data = data[size:]
+    }
+
+    return headers, nil
+}
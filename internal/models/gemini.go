@@ -0,0 +1,383 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+const defaultGeminiAPIBase = "https://generativelanguage.googleapis.com"
+
+// GeminiProvider implements the Provider interface for the Google Gemini API
+type GeminiProvider struct {
+    client  *http.Client
+    apiKey  string
+    apiBase string
+    modelID string
+}
+
+// Model mapping for Gemini
+var geminiModelMap = map[string]string{
+    "gemini-pro":   "gemini-1.5-pro",
+    "gemini-flash": "gemini-1.5-flash",
+    "gemini-2":     "gemini-2.0-flash",
+    "gemini-2.5":   "gemini-2.5-pro",
+}
+
+type geminiPart struct {
+    Text string `json:"text"`
+}
+
+type geminiContent struct {
+    Role  string       `json:"role,omitempty"`
+    Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+    Temperature     *float64              `json:"temperature,omitempty"`
+    TopP            float64               `json:"topP,omitempty"`
+    TopK            int                   `json:"topK,omitempty"`
+    MaxOutputTokens int                   `json:"maxOutputTokens,omitempty"`
+    StopSequences   []string              `json:"stopSequences,omitempty"`
+    ThinkingConfig  *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// geminiThinkingConfig sets the thinking budget; -1 lets the model decide
+type geminiThinkingConfig struct {
+    ThinkingBudget int `json:"thinkingBudget"`
+}
+
+// geminiRequest is the body of a generateContent call
+type geminiRequest struct {
+    Contents          []geminiContent         `json:"contents"`
+    SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+    GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// geminiResponse is one streamed GenerateContentResponse
+type geminiResponse struct {
+    Candidates []struct {
+        Content      geminiContent `json:"content"`
+        FinishReason string        `json:"finishReason"`
+    } `json:"candidates"`
+    PromptFeedback *struct {
+        BlockReason string `json:"blockReason"`
+    } `json:"promptFeedback"`
+    Error *geminiError `json:"error"`
+}
+
+type geminiError struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+    Status  string `json:"status"`
+}
+
+// NewGeminiProvider creates a new Gemini provider
+func NewGeminiProvider(modelAlias string, settings config.Provider) (*GeminiProvider, error) {
+    apiKey := settings.APIKey
+    if apiKey == "" {
+        return nil, fmt.Errorf("GEMINI_API_KEY environment variable is not set. " +
+            "Please set it in your environment, create a .env file with:\n" +
+            "GEMINI_API_KEY=your-api-key-here\n" +
+            "or set providers.google.api_key in ~/.codewhisper/config.yaml")
+    }
+
+    if modelAlias == "" {
+        modelAlias = DefaultModel("google")
+    }
+    modelID, exists := geminiModelMap[modelAlias]
+    if !exists {
+        modelID = modelAlias // Use as-is if not in map
+    }
+
+    utils.Log.Info("Using Gemini model: %s", modelID)
+    apiBase := defaultGeminiAPIBase
+    if settings.APIBase != "" {
+        utils.Log.Info("Using custom API base: %s", settings.APIBase)
+        apiBase = settings.APIBase
+    }
+
+    return &GeminiProvider{
+        client:  &http.Client{},
+        apiKey:  apiKey,
+        apiBase: strings.TrimSuffix(apiBase, "/"),
+        modelID: modelID,
+    }, nil
+}
+
+// StreamChat implements streaming chat via streamGenerateContent
+func (g *GeminiProvider) StreamChat(ctx context.Context, conv Conversation) (<-chan StreamChunk, error) {
+    req := g.buildRequest(conv)
+    if len(req.Contents) == 0 {
+        return nil, fmt.Errorf("no valid messages to send")
+    }
+
+    settings := conv.GenerationSettings()
+    req.GenerationConfig = &geminiGenerationConfig{
+        Temperature:     &settings.Temperature,
+        TopP:            settings.TopP,
+        TopK:            settings.TopK,
+        MaxOutputTokens: settings.MaxOutputTokens,
+        StopSequences:   settings.StopSequences,
+    }
+    if settings.ThinkingMode {
+        budget := settings.ThinkingBudget
+        if budget == 0 {
+            budget = -1
+        }
+        req.GenerationConfig.ThinkingConfig = &geminiThinkingConfig{ThinkingBudget: budget}
+    }
+
+    utils.Log.Info("Creating Gemini stream with model: %s, temperature: %.2f, maxTokens: %d, thinking: %t, messages: %d",
+        g.modelID, settings.Temperature, settings.MaxOutputTokens, settings.ThinkingMode, len(req.Contents))
+
+    payload, err := json.Marshal(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode request: %w", err)
+    }
+
+    endpoint := fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", g.apiBase, url.PathEscape(g.modelID))
+    resp, err := g.do(ctx, http.MethodPost, endpoint, payload)
+    if err != nil {
+        return nil, err
+    }
+
+    streamChan := make(chan StreamChunk, 100)
+
+    go func() {
+        defer close(streamChan)
+        defer resp.Body.Close()
+
+        send := func(chunk StreamChunk) bool {
+            select {
+            case streamChan <- chunk:
+                return true
+            case <-ctx.Done():
+                return false
+            }
+        }
+
+        reader := newSSEReader(resp.Body)
+        chunkCount := 0
+        for {
+            event, err := reader.Next()
+            if errors.Is(err, io.EOF) {
+                utils.Log.Info("Gemini stream completed after %d chunks", chunkCount)
+                return
+            }
+            if err != nil {
+                send(StreamChunk{Error: fmt.Errorf("stream error: %w", err)})
+                return
+            }
+            if event.Data == "" {
+                continue
+            }
+
+            var data geminiResponse
+            if err := json.Unmarshal([]byte(event.Data), &data); err != nil {
+                utils.Log.Warning("Skipping malformed Gemini event: %v", err)
+                continue
+            }
+
+            if data.Error != nil {
+                utils.Log.Error("Gemini stream error: %s", data.Error.Message)
+                send(StreamChunk{Error: fmt.Errorf("stream error: %s: %s", data.Error.Status, data.Error.Message)})
+                return
+            }
+            if data.PromptFeedback != nil && data.PromptFeedback.BlockReason != "" {
+                send(StreamChunk{Error: fmt.Errorf("prompt blocked by Gemini: %s", data.PromptFeedback.BlockReason)})
+                return
+            }
+
+            for _, candidate := range data.Candidates {
+                for _, part := range candidate.Content.Parts {
+                    if part.Text == "" {
+                        continue
+                    }
+                    chunkCount++
+                    if !send(StreamChunk{Content: part.Text}) {
+                        return
+                    }
+                }
+                if candidate.FinishReason == "SAFETY" || candidate.FinishReason == "RECITATION" {
+                    send(StreamChunk{Error: fmt.Errorf("response stopped by Gemini: %s", candidate.FinishReason)})
+                    return
+                }
+            }
+        }
+    }()
+
+    return streamChan, nil
+}
+
+// buildRequest converts a conversation to Gemini contents, one part per
+// content part. Gemini names the assistant role "model" and takes the system
+// prompt separately.
+func (g *GeminiProvider) buildRequest(conv Conversation) geminiRequest {
+    var req geminiRequest
+    if strings.TrimSpace(conv.System) != "" {
+        req.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: conv.System}}}
+    }
+
+    for _, msg := range conv.NormalizedMessages() {
+        role := "user"
+        if msg.Role == RoleAssistant {
+            role = "model"
+        }
+
+        parts := make([]geminiPart, 0, len(msg.Parts))
+        for _, part := range msg.Parts {
+            parts = append(parts, geminiPart{Text: part.Render()})
+        }
+        req.Contents = append(req.Contents, geminiContent{Role: role, Parts: parts})
+    }
+
+    return req
+}
+
+// do sends an authenticated request and returns the response on HTTP 200
+func (g *GeminiProvider) do(ctx context.Context, method, endpoint string, payload []byte) (*http.Response, error) {
+    var body io.Reader
+    if payload != nil {
+        body = bytes.NewReader(payload)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %w", err)
+    }
+    req.Header.Set("x-goog-api-key", g.apiKey)
+    if payload != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := g.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("request to Gemini failed: %w", err)
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+        respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+        var apiErr struct {
+            Error geminiError `json:"error"`
+        }
+        if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+            return nil, fmt.Errorf("Gemini API error (%d %s): %s", resp.StatusCode, apiErr.Error.Status, apiErr.Error.Message)
+        }
+        return nil, fmt.Errorf("Gemini API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+    }
+
+    return resp, nil
+}
+
+// ValidateAuth validates the API key by looking up the configured model
+func (g *GeminiProvider) ValidateAuth() error {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    endpoint := fmt.Sprintf("%s/v1beta/models/%s", g.apiBase, url.PathEscape(g.modelID))
+    resp, err := g.do(ctx, http.MethodGet, endpoint, nil)
+    if err != nil {
+        return fmt.Errorf("Gemini authentication failed: %w", err)
+    }
+    resp.Body.Close()
+
+    utils.Log.Info("Gemini authentication successful")
+    return nil
+}
+
+// geminiModel is one entry of the models.list response
+type geminiModel struct {
+    Name                       string   `json:"name"`
+    DisplayName                string   `json:"displayName"`
+    InputTokenLimit            int      `json:"inputTokenLimit"`
+    OutputTokenLimit           int      `json:"outputTokenLimit"`
+    SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+    MaxTemperature             float64  `json:"maxTemperature"`
+    TopK                       int      `json:"topK"`
+    Thinking                   bool     `json:"thinking"`
+}
+
+// ListModels lists the models that support generateContent, with the token
+// limits reported by the API
+func (g *GeminiProvider) ListModels(ctx context.Context) ([]ModelSpec, error) {
+    specs := []ModelSpec{}
+    pageToken := ""
+    for {
+        endpoint := g.apiBase + "/v1beta/models?pageSize=1000"
+        if pageToken != "" {
+            endpoint += "&pageToken=" + url.QueryEscape(pageToken)
+        }
+
+        resp, err := g.do(ctx, http.MethodGet, endpoint, nil)
+        if err != nil {
+            return nil, err
+        }
+
+        var page struct {
+            Models        []geminiModel `json:"models"`
+            NextPageToken string        `json:"nextPageToken"`
+        }
+        err = json.NewDecoder(resp.Body).Decode(&page)
+        resp.Body.Close()
+        if err != nil {
+            return nil, fmt.Errorf("failed to decode Gemini model list: %w", err)
+        }
+
+        for _, m := range page.Models {
+            if !containsString(m.SupportedGenerationMethods, "generateContent") {
+                continue
+            }
+            spec := LookupModel("google", strings.TrimPrefix(m.Name, "models/"))
+            if m.DisplayName != "" {
+                spec.Name = m.DisplayName
+            }
+            if m.InputTokenLimit > 0 {
+                spec.ContextWindow = m.InputTokenLimit
+            }
+            if m.OutputTokenLimit > 0 {
+                spec.MaxOutputTokens = m.OutputTokenLimit
+            }
+            if m.MaxTemperature > 0 {
+                spec.MaxTemperature = m.MaxTemperature
+            }
+            spec.SupportsTopK = m.TopK > 0
+            spec.SupportsThinking = spec.SupportsThinking || m.Thinking
+            specs = append(specs, spec)
+        }
+        if page.NextPageToken == "" {
+            return specs, nil
+        }
+        pageToken = page.NextPageToken
+    }
+}
+
+func containsString(list []string, s string) bool {
+    for _, item := range list {
+        if item == s {
+            return true
+        }
+    }
+    return false
+}
+
+// GetModelInfo returns information about the current model
+func (g *GeminiProvider) GetModelInfo() ModelInfo {
+    return ModelInfo{
+        ModelID:   g.modelID,
+        Endpoint:  "google",
+        MaxTokens: LookupModel("google", g.modelID).ContextWindow,
+    }
+}
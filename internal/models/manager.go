@@ -3,7 +3,10 @@ package models
 import (
 	"context"
 	"fmt"
+	"sync"
 
+	"github.com/gongzhen/codewhisper-go/internal/tokenizer"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
 	"github.com/gongzhen/codewhisper-go/pkg/config"
 )
 
@@ -22,80 +25,240 @@ type ModelInfo struct {
 
 // Provider interface for different model providers
 type Provider interface {
-    StreamChat(ctx context.Context, prompt string) (<-chan StreamChunk, error)
+    StreamChat(ctx context.Context, conv Conversation) (<-chan StreamChunk, error)
     ValidateAuth() error
     GetModelInfo() ModelInfo
+    ListModels(ctx context.Context) ([]ModelSpec, error)
 }
 
-// ModelManager placeholder - will be implemented in next task
-// ModelManager manages different model providers
+// ModelManager manages different model providers. Providers are registered
+// per endpoint and the current one can be switched at runtime.
 type ModelManager struct {
+    mu        sync.RWMutex
     providers map[string]Provider
     current   string
+    catalog   *ModelCatalog
+    config    *config.Store
 }
 
-// NewModelManager creates a new model manager
-func NewModelManager() (*ModelManager, error) {
+// NewModelManager creates a new model manager for the configured endpoint and model
+func NewModelManager(cfg *config.Store) (*ModelManager, error) {
+    current := cfg.Get()
+    return NewModelManagerFor(cfg, current.Endpoint, current.Model)
+}
+
+// NewModelManagerFor creates a model manager whose current provider serves
+// the given endpoint and model
+func NewModelManagerFor(cfg *config.Store, endpoint, model string) (*ModelManager, error) {
+    provider, err := ValidatedProvider(cfg.Get(), endpoint, model)
+    if err != nil {
+        return nil, err
+    }
+    
+    return NewModelManagerWith(cfg, endpoint, provider), nil
+}
+
+// NewModelManagerWith creates a model manager around an already validated provider
+func NewModelManagerWith(cfg *config.Store, endpoint string, provider Provider) *ModelManager {
     mm := &ModelManager{
         providers: make(map[string]Provider),
+        catalog:   NewModelCatalog(catalogTTL),
+        config:    cfg,
     }
     
-    // Get endpoint from config
-    endpoint := config.GetEnv(config.EnvEndpoint, "openai")
-    
+    mm.UseProvider(endpoint, provider)
+    return mm
+}
+
+// NewProvider creates the provider for an endpoint, serving the given model
+// (or the endpoint's default model when empty)
+func NewProvider(cfg config.Config, endpoint, model string) (Provider, error) {
     switch endpoint {
     case "openai":
-        provider, err := NewOpenAIProvider()
+        provider, err := NewOpenAIProvider(model, cfg.Provider(endpoint))
         if err != nil {
             return nil, fmt.Errorf("failed to initialize OpenAI provider: %w", err)
         }
-        mm.providers["openai"] = provider
-        mm.current = "openai"
+        return provider, nil
+        
+    case "anthropic":
+        provider, err := NewAnthropicProvider(model, cfg.Provider(endpoint))
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize Anthropic provider: %w", err)
+        }
+        return provider, nil
         
     case "bedrock":
-        // We can add bedrock later
-        return nil, fmt.Errorf("bedrock not implemented yet, use --endpoint openai")
+        provider, err := NewBedrockProvider(model, cfg.AWSProfile)
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize Bedrock provider: %w", err)
+        }
+        return provider, nil
+        
+    case "google":
+        provider, err := NewGeminiProvider(model, cfg.Provider(endpoint))
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize Gemini provider: %w", err)
+        }
+        return provider, nil
+        
+    case "deepseek":
+        provider, err := NewDeepSeekProvider(model, cfg.Provider(endpoint))
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize DeepSeek provider: %w", err)
+        }
+        return provider, nil
         
-    default:
-        return nil, fmt.Errorf("unsupported endpoint: %s", endpoint)
+    case "ollama":
+        provider, err := NewOllamaProvider(model, cfg.Provider(endpoint))
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize Ollama provider: %w", err)
+        }
+        return provider, nil
     }
     
-    // Validate authentication
-    if err := mm.ValidateAuth(); err != nil {
+    return nil, fmt.Errorf("unsupported endpoint: %s", endpoint)
+}
+
+// Register adds or replaces the provider for an endpoint without making it current
+func (mm *ModelManager) Register(endpoint string, provider Provider) {
+    mm.mu.Lock()
+    defer mm.mu.Unlock()
+    
+    mm.providers[endpoint] = provider
+}
+
+// Use makes a registered endpoint the current one
+func (mm *ModelManager) Use(endpoint string) error {
+    mm.mu.Lock()
+    defer mm.mu.Unlock()
+    
+    if _, exists := mm.providers[endpoint]; !exists {
+        return fmt.Errorf("no provider registered for endpoint: %s", endpoint)
+    }
+    mm.current = endpoint
+    return nil
+}
+
+// SwitchModel builds and validates a provider for the endpoint and model, then
+// makes it current. On error the previous provider stays in use.
+func (mm *ModelManager) SwitchModel(endpoint, model string) error {
+    provider, err := ValidatedProvider(mm.config.Get(), endpoint, model)
+    if err != nil {
+        return err
+    }
+    
+    mm.UseProvider(endpoint, provider)
+    return nil
+}
+
+// ValidatedProvider builds the provider for an endpoint and model and checks
+// its credentials. It makes a network request, so callers holding locks
+// should call it first and swap the result in with UseProvider.
+func ValidatedProvider(cfg config.Config, endpoint, model string) (Provider, error) {
+    provider, err := NewProvider(cfg, endpoint, model)
+    if err != nil {
+        return nil, err
+    }
+    
+    if err := provider.ValidateAuth(); err != nil {
         return nil, fmt.Errorf("authentication failed: %w", err)
     }
+    return provider, nil
+}
+
+// UseProvider registers a provider for an endpoint and makes it current
+func (mm *ModelManager) UseProvider(endpoint string, provider Provider) {
+    mm.mu.Lock()
+    mm.providers[endpoint] = provider
+    mm.current = endpoint
+    mm.mu.Unlock()
+    
+    modelID := provider.GetModelInfo().ModelID
+    utils.Log.Info("Switched to %s model %s", endpoint, modelID)
     
-    return mm, nil
+    // Count tokens the way the new model does
+    encoding := tokenizer.ForModel(endpoint, modelID)
+    if err := tokenizer.SetDefault(encoding); err != nil {
+        utils.Log.Warning("Keeping tokenizer %s: %v", tokenizer.Default().Name(), err)
+    }
 }
 
-// StreamChat streams a chat response
-func (mm *ModelManager) StreamChat(ctx context.Context, prompt string) (<-chan StreamChunk, error) {
+// currentProvider returns the current endpoint and its provider
+func (mm *ModelManager) currentProvider() (string, Provider, error) {
+    mm.mu.RLock()
+    defer mm.mu.RUnlock()
+    
     provider, exists := mm.providers[mm.current]
     if !exists {
-        return nil, fmt.Errorf("no provider for endpoint: %s", mm.current)
+        return mm.current, nil, fmt.Errorf("no provider for endpoint: %s", mm.current)
+    }
+    return mm.current, provider, nil
+}
+
+// StreamChat streams a chat response
+func (mm *ModelManager) StreamChat(ctx context.Context, conv Conversation) (<-chan StreamChunk, error) {
+    _, provider, err := mm.currentProvider()
+    if err != nil {
+        return nil, err
     }
     
-    return provider.StreamChat(ctx, prompt)
+    return provider.StreamChat(ctx, conv)
 }
 
 // ValidateAuth validates authentication for the current provider
 func (mm *ModelManager) ValidateAuth() error {
-    provider, exists := mm.providers[mm.current]
-    if !exists {
+    _, provider, err := mm.currentProvider()
+    if err != nil {
         return fmt.Errorf("no provider configured")
     }
     
     return provider.ValidateAuth()
 }
 
+// GenerationSettings returns the configured generation settings
+func (mm *ModelManager) GenerationSettings() GenerationSettings {
+    return GenerationSettings(mm.config.Get().Generation)
+}
+
 // GetCurrentModelInfo returns information about the current model
 func (mm *ModelManager) GetCurrentModelInfo() ModelInfo {
-    if provider, exists := mm.providers[mm.current]; exists {
+    endpoint, provider, err := mm.currentProvider()
+    if err == nil {
         return provider.GetModelInfo()
     }
     
     return ModelInfo{
-        ModelID:  config.GetEnv(config.EnvModel, "gpt-4-turbo-preview"),
-        Endpoint: mm.current,
+        ModelID:  mm.config.Get().Model,
+        Endpoint: endpoint,
+    }
+}
+
+// ListModels returns the current provider's models from the cached catalog
+func (mm *ModelManager) ListModels(ctx context.Context) ([]ModelSpec, error) {
+    endpoint, provider, err := mm.currentProvider()
+    if err != nil {
+        return nil, err
     }
-}
\ No newline at end of file
+    
+    return mm.catalog.Models(ctx, endpoint, provider)
+}
+
+// CurrentModelSpec returns the catalog entry for the current model, falling
+// back to the built-in limits when the provider doesn't list it
+func (mm *ModelManager) CurrentModelSpec(ctx context.Context) ModelSpec {
+    info := mm.GetCurrentModelInfo()
+    
+    specs, _ := mm.ListModels(ctx)
+    for _, spec := range specs {
+        if spec.ID == info.ModelID {
+            return spec
+        }
+    }
+    
+    spec := LookupModel(info.Endpoint, info.ModelID)
+    if info.MaxTokens > 0 {
+        spec.ContextWindow = info.MaxTokens
+    }
+    return spec
+}
@@ -0,0 +1,311 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+const (
+    defaultOllamaHost   = "http://localhost:11434"
+    defaultOllamaNumCtx = 8192
+)
+
+// OllamaProvider implements the Provider interface for a local Ollama server.
+// It needs no API key, so it works on air-gapped machines.
+type OllamaProvider struct {
+    client  *http.Client
+    host    string
+    modelID string
+    numCtx  int
+}
+
+// OllamaModel is a locally installed model as reported by /api/tags
+type OllamaModel struct {
+    Name    string `json:"name"`
+    Size    int64  `json:"size"`
+    Details struct {
+        Family        string `json:"family"`
+        ParameterSize string `json:"parameter_size"`
+    } `json:"details"`
+}
+
+type ollamaMessage struct {
+    Role    string `json:"role"`
+    Content string `json:"content"`
+}
+
+// ollamaChatRequest is the body of /api/chat
+type ollamaChatRequest struct {
+    Model    string                 `json:"model"`
+    Messages []ollamaMessage        `json:"messages"`
+    Stream   bool                   `json:"stream"`
+    Think    bool                   `json:"think,omitempty"`
+    Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// ollamaChatResponse is one NDJSON line of a streamed /api/chat response
+type ollamaChatResponse struct {
+    Message    ollamaMessage `json:"message"`
+    Done       bool          `json:"done"`
+    DoneReason string        `json:"done_reason"`
+    Error      string        `json:"error"`
+}
+
+// NewOllamaProvider creates a new Ollama provider
+func NewOllamaProvider(modelID string, settings config.Provider) (*OllamaProvider, error) {
+    if modelID == "" {
+        modelID = DefaultModel("ollama")
+    }
+    host := OllamaHost(settings.APIBase)
+    numCtx := settings.NumCtx
+    if numCtx <= 0 {
+        numCtx = defaultOllamaNumCtx
+    }
+
+    utils.Log.Info("Using Ollama model: %s at %s", modelID, host)
+
+    return &OllamaProvider{
+        client:  &http.Client{},
+        host:    host,
+        modelID: modelID,
+        numCtx:  numCtx,
+    }, nil
+}
+
+// OllamaHost returns the server URL for a configured host (OLLAMA_HOST),
+// which like the ollama CLI may omit the scheme
+func OllamaHost(host string) string {
+    if host == "" {
+        return defaultOllamaHost
+    }
+    if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+        host = "http://" + host
+    }
+    return strings.TrimSuffix(host, "/")
+}
+
+// StreamChat implements streaming chat via /api/chat
+func (o *OllamaProvider) StreamChat(ctx context.Context, conv Conversation) (<-chan StreamChunk, error) {
+    var messages []ollamaMessage
+    if strings.TrimSpace(conv.System) != "" {
+        messages = append(messages, ollamaMessage{Role: "system", Content: conv.System})
+    }
+    for _, msg := range conv.NormalizedMessages() {
+        messages = append(messages, ollamaMessage{Role: string(msg.Role), Content: msg.Text()})
+    }
+    if len(messages) == 0 {
+        return nil, fmt.Errorf("no valid messages to send")
+    }
+
+    settings := conv.GenerationSettings()
+    req := ollamaChatRequest{
+        Model:    o.modelID,
+        Messages: messages,
+        Stream:   true,
+        Think:    settings.ThinkingMode,
+        Options: map[string]interface{}{
+            "temperature": settings.Temperature,
+            "num_predict": settings.MaxOutputTokens,
+            // Ollama silently truncates prompts longer than num_ctx, so ask for the full window
+            "num_ctx": o.numCtx,
+        },
+    }
+    if settings.TopP > 0 {
+        req.Options["top_p"] = settings.TopP
+    }
+    if settings.TopK > 0 {
+        req.Options["top_k"] = settings.TopK
+    }
+    if len(settings.StopSequences) > 0 {
+        req.Options["stop"] = settings.StopSequences
+    }
+
+    utils.Log.Info("Creating Ollama stream with model: %s, temperature: %.2f, maxTokens: %d, num_ctx: %d",
+        o.modelID, settings.Temperature, settings.MaxOutputTokens, o.numCtx)
+
+    payload, err := json.Marshal(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode request: %w", err)
+    }
+
+    resp, err := o.do(ctx, http.MethodPost, "/api/chat", payload)
+    if err != nil {
+        return nil, err
+    }
+
+    streamChan := make(chan StreamChunk, 100)
+
+    go func() {
+        defer close(streamChan)
+        defer resp.Body.Close()
+
+        send := func(chunk StreamChunk) bool {
+            select {
+            case streamChan <- chunk:
+                return true
+            case <-ctx.Done():
+                return false
+            }
+        }
+
+        scanner := bufio.NewScanner(resp.Body)
+        scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+        chunkCount := 0
+        for scanner.Scan() {
+            line := bytes.TrimSpace(scanner.Bytes())
+            if len(line) == 0 {
+                continue
+            }
+
+            var data ollamaChatResponse
+            if err := json.Unmarshal(line, &data); err != nil {
+                utils.Log.Warning("Skipping malformed Ollama line: %v", err)
+                continue
+            }
+
+            if data.Error != "" {
+                utils.Log.Error("Ollama stream error: %s", data.Error)
+                send(StreamChunk{Error: fmt.Errorf("stream error: %s", data.Error)})
+                return
+            }
+            if data.Message.Content != "" {
+                chunkCount++
+                if !send(StreamChunk{Content: data.Message.Content}) {
+                    return
+                }
+            }
+            if data.Done {
+                if data.DoneReason == "length" {
+                    utils.Log.Warning("Ollama response truncated at num_predict")
+                }
+                utils.Log.Info("Ollama stream completed after %d chunks", chunkCount)
+                return
+            }
+        }
+
+        if err := scanner.Err(); err != nil {
+            send(StreamChunk{Error: fmt.Errorf("stream error: %w", err)})
+        }
+    }()
+
+    return streamChan, nil
+}
+
+// do sends a request to the Ollama server and returns the response on HTTP 200
+func (o *OllamaProvider) do(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+    return ollamaRequest(ctx, o.client, method, o.host+path, payload)
+}
+
+func ollamaRequest(ctx context.Context, client *http.Client, method, url string, payload []byte) (*http.Response, error) {
+    var body io.Reader
+    if payload != nil {
+        body = bytes.NewReader(payload)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, url, body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %w", err)
+    }
+    if payload != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("cannot reach Ollama (is `ollama serve` running?): %w", err)
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+        respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+        var apiErr struct {
+            Error string `json:"error"`
+        }
+        if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error != "" {
+            return nil, fmt.Errorf("Ollama error (%d): %s", resp.StatusCode, apiErr.Error)
+        }
+        return nil, fmt.Errorf("Ollama error (%d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+    }
+
+    return resp, nil
+}
+
+// ListOllamaModels returns the models installed on the Ollama server
+func ListOllamaModels(ctx context.Context, host string) ([]OllamaModel, error) {
+    client := &http.Client{Timeout: 10 * time.Second}
+    resp, err := ollamaRequest(ctx, client, http.MethodGet, host+"/api/tags", nil)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    var tags struct {
+        Models []OllamaModel `json:"models"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+        return nil, fmt.Errorf("failed to decode Ollama model list: %w", err)
+    }
+    return tags.Models, nil
+}
+
+// ValidateAuth checks that the Ollama server is reachable and has the model pulled
+func (o *OllamaProvider) ValidateAuth() error {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    installed, err := ListOllamaModels(ctx, o.host)
+    if err != nil {
+        return err
+    }
+
+    for _, m := range installed {
+        if m.Name == o.modelID || strings.TrimSuffix(m.Name, ":latest") == o.modelID {
+            utils.Log.Info("Ollama model %s is available", o.modelID)
+            return nil
+        }
+    }
+    return fmt.Errorf("model %q is not installed in Ollama, run `ollama pull %s`", o.modelID, o.modelID)
+}
+
+// ListModels lists the installed models. Every model runs with the
+// configured num_ctx window.
+func (o *OllamaProvider) ListModels(ctx context.Context) ([]ModelSpec, error) {
+    installed, err := ListOllamaModels(ctx, o.host)
+    if err != nil {
+        return nil, err
+    }
+
+    specs := make([]ModelSpec, 0, len(installed))
+    for _, m := range installed {
+        spec := LookupModel("ollama", m.Name)
+        if m.Details.ParameterSize != "" {
+            spec.Name = fmt.Sprintf("%s (%s)", m.Name, m.Details.ParameterSize)
+        }
+        spec.ContextWindow = o.numCtx
+        if spec.MaxOutputTokens > o.numCtx {
+            spec.MaxOutputTokens = o.numCtx
+        }
+        specs = append(specs, spec)
+    }
+    return specs, nil
+}
+
+// GetModelInfo returns information about the current model
+func (o *OllamaProvider) GetModelInfo() ModelInfo {
+    return ModelInfo{
+        ModelID:   o.modelID,
+        Endpoint:  "ollama",
+        MaxTokens: o.numCtx,
+    }
+}
@@ -5,8 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"strconv"
 	"strings"
 
 	"github.com/sashabaranov/go-openai"
@@ -15,10 +13,13 @@ import (
 	"github.com/gongzhen/codewhisper-go/pkg/config"
 )
 
-// OpenAIProvider implements the Provider interface for OpenAI
+// OpenAIProvider implements the Provider interface for OpenAI and
+// OpenAI-compatible APIs such as DeepSeek
 type OpenAIProvider struct {
-    client  *openai.Client
-    modelID string
+    client   *openai.Client
+    apiBase  string
+    modelID  string
+    endpoint string
 }
 
 // Model mapping for OpenAI
@@ -31,41 +32,40 @@ var openAIModelMap = map[string]string{
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
-func NewOpenAIProvider() (*OpenAIProvider, error) {
-    apiKey := os.Getenv("OPENAI_API_KEY")
+func NewOpenAIProvider(modelAlias string, settings config.Provider) (*OpenAIProvider, error) {
+    apiKey := settings.APIKey
     if apiKey == "" {
         return nil, fmt.Errorf("OPENAI_API_KEY environment variable is not set. " +
-            "Please set it in your environment or create a .env file with:\n" +
-            "OPENAI_API_KEY=sk-your-api-key-here")
+            "Please set it in your environment, create a .env file with:\n" +
+            "OPENAI_API_KEY=sk-your-api-key-here\n" +
+            "or set providers.openai.api_key in ~/.codewhisper/config.yaml")
     }
     
-    // Get model from config
-    modelAlias := config.GetEnv(config.EnvModel, "gpt-4-turbo")
+    if modelAlias == "" {
+        modelAlias = DefaultModel("openai")
+    }
     modelID, exists := openAIModelMap[modelAlias]
     if !exists {
         modelID = modelAlias // Use as-is if not in map
     }
     
     utils.Log.Info("Using OpenAI model: %s", modelID)
-    var client *openai.Client
-    apiBase := os.Getenv("OPENAI_API_BASE")
-    if apiBase != "" {
-        utils.Log.Info("Using custom API base: %s", apiBase)
-        config := openai.DefaultConfig(apiKey)
-        config.BaseURL = apiBase
-        client = openai.NewClientWithConfig(config)
-    } else {
-        client = openai.NewClient(apiKey)
+    clientConfig := openai.DefaultConfig(apiKey)
+    if settings.APIBase != "" {
+        utils.Log.Info("Using custom API base: %s", settings.APIBase)
+        clientConfig.BaseURL = settings.APIBase
     }
     
     return &OpenAIProvider{
-        client:  client,
-        modelID: modelID,
+        client:   openai.NewClientWithConfig(clientConfig),
+        apiBase:  clientConfig.BaseURL,
+        modelID:  modelID,
+        endpoint: "openai",
     }, nil
 }
 
 // StreamChat implements streaming chat for OpenAI
-func (o *OpenAIProvider) StreamChat(ctx context.Context, prompt string) (<-chan StreamChunk, error) {
+func (o *OpenAIProvider) StreamChat(ctx context.Context, conv Conversation) (<-chan StreamChunk, error) {
     streamChan := make(chan StreamChunk, 100)
     
     go func() {
@@ -75,8 +75,8 @@ func (o *OpenAIProvider) StreamChat(ctx context.Context, prompt string) (<-chan
             utils.Log.Info("Full OpenAI response: %s", fullResponse.String())
         }()        
         
-        // Parse the prompt to extract system message
-        messages := o.parsePrompt(prompt)
+        // Convert the conversation to OpenAI messages
+        messages := o.buildMessages(conv)
 
         // EXTRA SAFETY: Filter out any empty messages before sending
         var validMessages []openai.ChatCompletionMessage
@@ -102,27 +102,17 @@ func (o *OpenAIProvider) StreamChat(ctx context.Context, prompt string) (<-chan
             utils.Log.Info("Message %d - Role: %s, Content length: %d", i, msg.Role, len(msg.Content))
         }
         
-        // Get parameters from config
-        temperature := float32(0.7)
-        if tempStr := config.GetEnv(config.EnvTemperature, "0.7"); tempStr != "" {
-            if temp, err := strconv.ParseFloat(tempStr, 32); err == nil {
-                temperature = float32(temp)
-            }
-        }
-        
-        maxTokens := config.GetEnvInt(config.EnvMaxOutputTokens, 4096)
-        
         // Create chat completion request
+        settings := conv.GenerationSettings()
         req := openai.ChatCompletionRequest{
-            Model:       o.modelID,
-            Messages:    messages,
-            Temperature: temperature,
-            MaxTokens:   maxTokens,
-            Stream:      true,
+            Model:    o.modelID,
+            Messages: messages,
+            Stream:   true,
         }
+        o.applySettings(&req, settings)
         
         utils.Log.Info("Creating OpenAI stream with model: %s, temperature: %.2f, maxTokens: %d", 
-            o.modelID, temperature, maxTokens)
+            o.modelID, settings.Temperature, settings.MaxOutputTokens)
         
 
         // In StreamChat function, right before CreateChatCompletionStream
@@ -180,156 +170,61 @@ func (o *OpenAIProvider) StreamChat(ctx context.Context, prompt string) (<-chan
     return streamChan, nil
 }
 
-// parsePrompt converts our prompt format to OpenAI messages
-func (o *OpenAIProvider) parsePrompt(prompt string) []openai.ChatCompletionMessage {
-    messages := []openai.ChatCompletionMessage{}
+// applySettings copies generation settings onto a request. OpenAI reasoning
+// models take max_completion_tokens and a reasoning effort instead of the
+// sampling parameters, and the API has no top_k.
+func (o *OpenAIProvider) applySettings(req *openai.ChatCompletionRequest, s GenerationSettings) {
+    if len(s.StopSequences) > 0 {
+        req.Stop = s.StopSequences
+    }
     
-    // Check if prompt contains system message
-    if strings.Contains(prompt, "You are CodeWhisper") {
-        // Split on the codebase marker
-        parts := strings.SplitN(prompt, "\n\nCurrent codebase:", 2)
-        if len(parts) == 2 {
-            // Add system message
-            messages = append(messages, openai.ChatCompletionMessage{
-                Role:    openai.ChatMessageRoleSystem,
-                Content: strings.TrimSpace(parts[0]),
-            })
-            
-            // Parse the rest for user message and chat history
-            rest := parts[1]
-            
-            // Check for chat history
-            if strings.Contains(rest, "\nConversation history:\n") {
-                historyParts := strings.SplitN(rest, "\nConversation history:\n", 2)
-                
-                // Add codebase as first user message
-                codebasePart := strings.TrimSpace(historyParts[0])
-                
-                if len(historyParts) == 2 {
-                    // Parse conversation history
-                    convParts := strings.Split(historyParts[1], "\nHuman: ")
-                    
-                    // Add the codebase context as the first message
-                    messages = append(messages, openai.ChatCompletionMessage{
-                        Role:    openai.ChatMessageRoleUser,
-                        Content: "Current codebase:" + codebasePart,
-                    })
-                    
-                    // Process each conversation turn
-                    for _, part := range convParts {
-                        if part == "" {
-                            continue
-                        }
-                        
-                        if strings.Contains(part, "\nAssistant: ") {
-                            humanAssistant := strings.SplitN(part, "\nAssistant: ", 2)
-                            if len(humanAssistant) == 2 {
-                                humanContent := strings.TrimSpace(humanAssistant[0])
-                                assistantContent := strings.TrimSpace(humanAssistant[1])
+    if o.endpoint == "openai" && LookupModel(o.endpoint, o.modelID).SupportsThinking {
+        req.MaxCompletionTokens = s.MaxOutputTokens
+        if s.ThinkingMode {
+            req.ReasoningEffort = reasoningEffort(s.ThinkingBudget)
+        }
+        return
+    }
+    
+    req.MaxTokens = s.MaxOutputTokens
+    req.Temperature = float32(s.Temperature)
+    req.TopP = float32(s.TopP)
+}
 
-                                // Add human message if not empty
-                                if humanContent != "" && humanContent != "Human:" {
-                                    messages = append(messages, 
-                                        openai.ChatCompletionMessage{
-                                            Role:    openai.ChatMessageRoleUser,
-                                            Content: humanContent,
-                                        },
-                                    )
-                                }
-                                
-                                // IMPORTANT: Only add assistant message if it has real content
-                                // Skip if it's empty, just "Assistant:", or ends with "Assistant:"
-                                if assistantContent != "" && 
-                                   assistantContent != "Assistant:" &&
-                                   !strings.HasSuffix(assistantContent, "Assistant:") {
-                                    messages = append(messages, 
-                                        openai.ChatCompletionMessage{
-                                            Role:    openai.ChatMessageRoleAssistant,
-                                            Content: assistantContent,
-                                        },
-                                    )
-                                }                                
+// reasoningEffort maps a thinking budget to OpenAI's effort levels
+func reasoningEffort(budget int) string {
+    switch {
+    case budget == 0:
+        return "medium"
+    case budget <= 4096:
+        return "low"
+    case budget <= 16384:
+        return "medium"
+    default:
+        return "high"
+    }
+}
 
-                                // // Skip the closing Assistant: prompt at the end
-                                // if !strings.HasSuffix(humanAssistant[1], "Assistant: ") {
-                                //     messages = append(messages, 
-                                //         openai.ChatCompletionMessage{
-                                //             Role:    openai.ChatMessageRoleUser,
-                                //             Content: strings.TrimSpace(humanAssistant[0]),
-                                //         },
-                                //         openai.ChatCompletionMessage{
-                                //             Role:    openai.ChatMessageRoleAssistant,
-                                //             Content: strings.TrimSpace(humanAssistant[1]),
-                                //         },
-                                //     )
-                                // } else {
-                                //     // This is the current question
-                                //     messages = append(messages, openai.ChatCompletionMessage{
-                                //         Role:    openai.ChatMessageRoleUser,
-                                //         Content: strings.TrimSpace(humanAssistant[0]),
-                                //     })
-                                // }
-                            }
-                        } else {
-                            content := strings.TrimSpace(part)
-                            if content != "" && content != "Human:" {
-                                messages = append(messages, openai.ChatCompletionMessage{
-                                    Role:    openai.ChatMessageRoleUser,
-                                    Content: content,
-                                })                                
-                            }
-                        }
-                    }
-                } else {
-                    // No history, just add the question
-                    if strings.Contains(rest, "\nHuman: ") {
-                        parts := strings.SplitN(rest, "\nHuman: ", 2)
-                        if len(parts) == 2 {
-                            content := strings.TrimSuffix(parts[1], "\nAssistant: ")
-                            content = strings.TrimSpace(content)
-                            if content != "" {
-                                messages = append(messages, openai.ChatCompletionMessage{
-                                    Role:    openai.ChatMessageRoleUser,
-                                    Content: "Current codebase:" + parts[0] + "\n\n" + content,
-                                })
-                            }
-                        }
-                    }
-                }
-            } else {
-                // Simple format without history
-                if strings.Contains(rest, "\nHuman: ") {
-                    parts := strings.SplitN(rest, "\nHuman: ", 2)
-                    if len(parts) == 2 {
-                        content := strings.TrimSuffix(parts[1], "\nAssistant: ")
-                        content = strings.TrimSpace(content)
-                        messages = append(messages, openai.ChatCompletionMessage{
-                            Role:    openai.ChatMessageRoleUser,
-                            Content: "Current codebase:" + parts[0] + "\n\n" + content,
-                        })
-                    }
-                }
-            }
-        }
-    } else {
-        // Simple prompt without system message
+// buildMessages converts a conversation to OpenAI messages
+func (o *OpenAIProvider) buildMessages(conv Conversation) []openai.ChatCompletionMessage {
+    var messages []openai.ChatCompletionMessage
+    if strings.TrimSpace(conv.System) != "" {
         messages = append(messages, openai.ChatCompletionMessage{
-            Role:    openai.ChatMessageRoleUser,
-            Content: prompt,
+            Role:    openai.ChatMessageRoleSystem,
+            Content: conv.System,
         })
     }
-
-    // SAFETY NET: Filter out any empty messages that might have slipped through
-    var filteredMessages []openai.ChatCompletionMessage
-    for _, msg := range messages {
-        if strings.TrimSpace(msg.Content) != "" {
-            filteredMessages = append(filteredMessages, msg)
-        } else {
-            utils.Log.Warning("Filtering out empty %s message in parsePrompt", msg.Role);
+    for _, msg := range conv.NormalizedMessages() {
+        role := openai.ChatMessageRoleUser
+        if msg.Role == RoleAssistant {
+            role = openai.ChatMessageRoleAssistant
         }
+        messages = append(messages, openai.ChatCompletionMessage{
+            Role:    role,
+            Content: msg.Text(),
+        })
     }
-    
-    return filteredMessages
+    return messages
 }
 
 // ValidateAuth validates OpenAI API key
@@ -345,28 +240,60 @@ func (o *OpenAIProvider) ValidateAuth() error {
                 Content: "Hi",
             },
         },
-        MaxTokens: 5,
+    }
+    // Reasoning models reject max_tokens
+    if o.endpoint == "openai" && LookupModel(o.endpoint, o.modelID).SupportsThinking {
+        req.MaxCompletionTokens = 5
+    } else {
+        req.MaxTokens = 5
     }
     
     _, err := o.client.CreateChatCompletion(ctx, req)
     if err != nil {
-        return fmt.Errorf("OpenAI authentication failed: %w", err)
+        return fmt.Errorf("%s authentication failed: %w", o.endpoint, err)
     }
     
-    utils.Log.Info("OpenAI authentication successful")
+    utils.Log.Info("%s authentication successful", o.endpoint)
     return nil
 }
 
-// GetModelInfo returns information about the current model
-func (o *OpenAIProvider) GetModelInfo() ModelInfo {
-    maxTokens := 4096
-    if o.modelID == "gpt-4-turbo-preview" || o.modelID == "gpt-4-1106-preview" {
-        maxTokens = 128000
+// ListModels lists the chat models the API key can use
+func (o *OpenAIProvider) ListModels(ctx context.Context) ([]ModelSpec, error) {
+    list, err := o.client.ListModels(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list %s models: %w", o.endpoint, err)
     }
     
+    specs := []ModelSpec{}
+    for _, m := range list.Models {
+        if o.endpoint == "openai" && !isOpenAIChatModel(m.ID) {
+            continue
+        }
+        specs = append(specs, LookupModel(o.endpoint, m.ID))
+    }
+    return specs, nil
+}
+
+// isOpenAIChatModel filters the OpenAI model list down to chat completion
+// models, dropping embeddings, audio, image and moderation models
+func isOpenAIChatModel(id string) bool {
+    if !strings.HasPrefix(id, "gpt-") && !strings.HasPrefix(id, "o1") &&
+        !strings.HasPrefix(id, "o3") && !strings.HasPrefix(id, "o4") {
+        return false
+    }
+    for _, skip := range []string{"instruct", "audio", "realtime", "tts", "transcribe", "search", "image"} {
+        if strings.Contains(id, skip) {
+            return false
+        }
+    }
+    return true
+}
+
+// GetModelInfo returns information about the current model
+func (o *OpenAIProvider) GetModelInfo() ModelInfo {
     return ModelInfo{
         ModelID:   o.modelID,
-        Endpoint:  "openai",
-        MaxTokens: maxTokens,
+        Endpoint:  o.endpoint,
+        MaxTokens: LookupModel(o.endpoint, o.modelID).ContextWindow,
     }
-}
\ No newline at end of file
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+func TestOpenAIValidateAuth(t *testing.T) {
+	tests := []struct {
+		model string
+		limit string
+	}{
+		{"gpt-4o", "max_tokens"},
+		// Reasoning models only take max_completion_tokens
+		{"o3-mini", "max_completion_tokens"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			var body map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/chat/completions" || r.Header.Get("Authorization") != "Bearer key" {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{"id":"x","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"length"}]}`)
+			}))
+			defer srv.Close()
+
+			p, err := NewOpenAIProvider(tt.model, config.Provider{APIKey: "key", APIBase: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.ValidateAuth(); err != nil {
+				t.Fatalf("ValidateAuth: %v", err)
+			}
+			if body["model"] != tt.model || body[tt.limit] != float64(5) {
+				t.Errorf("request = %v, want %s 5", body, tt.limit)
+			}
+			for _, key := range []string{"max_tokens", "max_completion_tokens"} {
+				if _, ok := body[key]; ok && key != tt.limit {
+					t.Errorf("request sets %s: %v", key, body)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAIValidateAuthRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`)
+	}))
+	defer srv.Close()
+
+	p, err := NewOpenAIProvider("o3-mini", config.Provider{APIKey: "bad", APIBase: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ValidateAuth(); err == nil {
+		t.Error("ValidateAuth with a rejected key succeeded")
+	}
+}
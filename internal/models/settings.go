@@ -0,0 +1,113 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+// Limits shared by every endpoint
+const (
+    maxTopK                 = 500
+    minAnthropicThinkBudget = 1024
+)
+
+// GenerationSettings are the sampling and output options sent with every
+// request, as configured
+type GenerationSettings config.Generation
+
+// DefaultGenerationSettings returns the settings used when nothing is configured
+func DefaultGenerationSettings() GenerationSettings {
+    return GenerationSettings(config.Defaults().Generation)
+}
+
+// Validate checks the settings against a model's catalog entry and reports
+// every problem found
+func (s GenerationSettings) Validate(spec ModelSpec) error {
+    var problems []string
+    fail := func(format string, args ...interface{}) {
+        problems = append(problems, fmt.Sprintf(format, args...))
+    }
+
+    if s.Temperature < 0 || s.Temperature > spec.MaxTemperature {
+        fail("temperature must be between 0 and %g for %s", spec.MaxTemperature, spec.ID)
+    }
+    if s.TopP < 0 || s.TopP > 1 {
+        fail("top_p must be between 0 and 1")
+    }
+    if s.TopK < 0 || s.TopK > maxTopK {
+        fail("top_k must be between 0 and %d", maxTopK)
+    }
+    if s.MaxOutputTokens < 1 || s.MaxOutputTokens > spec.MaxOutputTokens {
+        fail("max_output_tokens must be between 1 and %d for %s", spec.MaxOutputTokens, spec.ID)
+    }
+
+    for _, stop := range s.StopSequences {
+        if stop == "" {
+            fail("stop sequences must not be empty")
+            break
+        }
+    }
+    if limit := maxStopSequences(spec.Endpoint); limit > 0 && len(s.StopSequences) > limit {
+        fail("%s accepts at most %d stop sequences", spec.Endpoint, limit)
+    }
+
+    if s.ThinkingBudget < 0 {
+        fail("thinking_budget must not be negative")
+    }
+    if s.ThinkingMode {
+        if !spec.SupportsThinking {
+            fail("%s does not support thinking mode", spec.ID)
+        } else if spec.Endpoint == "anthropic" || spec.Endpoint == "bedrock" {
+            if s.MaxOutputTokens <= minAnthropicThinkBudget {
+                fail("thinking mode needs max_output_tokens above %d", minAnthropicThinkBudget)
+            }
+            if s.ThinkingBudget != 0 && (s.ThinkingBudget < minAnthropicThinkBudget || s.ThinkingBudget >= s.MaxOutputTokens) {
+                fail("thinking_budget must be at least %d and less than max_output_tokens", minAnthropicThinkBudget)
+            }
+        }
+    }
+
+    if len(problems) > 0 {
+        return fmt.Errorf("%s", strings.Join(problems, "; "))
+    }
+    return nil
+}
+
+// Ignored lists the settings the model accepts but doesn't use
+func (s GenerationSettings) Ignored(spec ModelSpec) []string {
+    var ignored []string
+    if s.TopK > 0 && !spec.SupportsTopK {
+        ignored = append(ignored, "top_k")
+    }
+    if s.ThinkingBudget > 0 && !s.ThinkingMode {
+        ignored = append(ignored, "thinking_budget")
+    }
+    return ignored
+}
+
+// maxStopSequences returns how many stop sequences the endpoint accepts, or
+// 0 when it doesn't document a limit
+func maxStopSequences(endpoint string) int {
+    switch endpoint {
+    case "openai", "deepseek":
+        return 4
+    case "google":
+        return 5
+    }
+    return 0
+}
+
+// anthropicThinkingBudget returns the budget_tokens to send, defaulting to
+// half of the output allowance
+func (s GenerationSettings) anthropicThinkingBudget() int {
+    if s.ThinkingBudget > 0 {
+        return s.ThinkingBudget
+    }
+    budget := s.MaxOutputTokens / 2
+    if budget < minAnthropicThinkBudget {
+        budget = minAnthropicThinkBudget
+    }
+    return budget
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sseEvent is a single server-sent event
+type sseEvent struct {
+    Event string
+    Data  string
+}
+
+// sseReader reads server-sent events from a streaming HTTP response body
+type sseReader struct {
+    scanner *bufio.Scanner
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+    scanner := bufio.NewScanner(r)
+    // Single events can carry large JSON payloads
+    scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+    return &sseReader{scanner: scanner}
+}
+
+// Next returns the next event, or io.EOF when the stream ends
+func (r *sseReader) Next() (sseEvent, error) {
+    var event sseEvent
+    var data []string
+
+    for r.scanner.Scan() {
+        line := r.scanner.Text()
+
+        // A blank line dispatches the event
+        if line == "" {
+            if len(data) == 0 && event.Event == "" {
+                continue
+            }
+            event.Data = strings.Join(data, "\n")
+            return event, nil
+        }
+
+        // Comment lines (keep-alives)
+        if strings.HasPrefix(line, ":") {
+            continue
+        }
+
+        field, value, _ := strings.Cut(line, ":")
+        value = strings.TrimPrefix(value, " ")
+
+        switch field {
+        case "event":
+            event.Event = value
+        case "data":
+            data = append(data, value)
+        }
+    }
+
+    if err := r.scanner.Err(); err != nil {
+        return sseEvent{}, err
+    }
+
+    // Flush a final event that wasn't followed by a blank line
+    if len(data) > 0 {
+        event.Data = strings.Join(data, "\n")
+        return event, nil
+    }
+
+    return sseEvent{}, io.EOF
+}
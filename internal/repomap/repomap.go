@@ -0,0 +1,266 @@
+// Package repomap builds compact outlines of Go packages: the package,
+// type, function and method declarations with their doc comments but
+// without function bodies, so a model can see the shape of code that
+// doesn't fit in its context in full.
+package repomap
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+// maxValueLength is the longest const or var initializer kept; longer ones
+// (tables, function literals) are shown as ...
+const maxValueLength = 80
+
+// printConfig formats declarations the way gofmt does
+var printConfig = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// Package is the outline of one Go package
+type Package struct {
+	Dir     string   `json:"dir"` // relative to the codebase, slash-separated
+	Name    string   `json:"name"`
+	Files   []string `json:"files"`
+	Outline string   `json:"outline"`
+}
+
+// Outline outlines rel, relative to baseDir: a single .go file, or every
+// Go package at or below a directory. Test files, testdata and vendor
+// directories and ignored files are left out, exclude adding patterns as
+// for utils.WalkOptions.Exclude.
+func Outline(baseDir, rel string, exclude []string) ([]Package, error) {
+	target, err := utils.SafeJoin(baseDir, rel)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		if !isGoSource(target) {
+			return nil, fmt.Errorf("%s is not a Go source file", rel)
+		}
+		return outlineFiles(absBase, []string{target}), nil
+	}
+
+	tree := utils.WalkTree(target, utils.WalkOptions{
+		MaxDepth: -1,
+		Exclude:  exclude,
+		Visit: func(path string, entry fs.DirEntry) bool {
+			return isGoSource(path) && !skippedDir(target, path)
+		},
+	})
+	return outlineFiles(absBase, tree.Files()), nil
+}
+
+// Build outlines the Go packages in dirs, relative to baseDir, without
+// descending into subdirectories. Files in exclude, relative paths that
+// are already available in full, are left out.
+func Build(baseDir string, dirs []string, exclude map[string]bool) []Package {
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		abs, err := utils.SafeJoin(absBase, dir)
+		if err != nil {
+			continue
+		}
+		entries, err := os.ReadDir(abs)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			file := filepath.Join(abs, entry.Name())
+			if entry.Type().IsRegular() && isGoSource(file) && !exclude[relPath(absBase, file)] {
+				files = append(files, file)
+			}
+		}
+	}
+	return outlineFiles(absBase, files)
+}
+
+// Render joins package outlines into one text
+func Render(pkgs []Package) string {
+	outlines := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		outlines = append(outlines, pkg.Outline)
+	}
+	return strings.Join(outlines, "\n")
+}
+
+// outlineFiles parses files, absolute paths, and outlines them grouped by
+// directory and package name
+func outlineFiles(absBase string, files []string) []Package {
+	type key struct{ dir, name string }
+	type parsed struct {
+		rel  string
+		file *ast.File
+	}
+
+	fset := token.NewFileSet()
+	groups := make(map[key][]parsed)
+	for _, file := range files {
+		// A file with syntax errors still yields the declarations before
+		// the error
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if f == nil || f.Name == nil {
+			utils.Log.Debug("Skipping %s in outline: %v", file, err)
+			continue
+		}
+		rel := relPath(absBase, file)
+		k := key{dir: path.Dir(rel), name: f.Name.Name}
+		groups[k] = append(groups[k], parsed{rel: rel, file: f})
+	}
+
+	pkgs := make([]Package, 0, len(groups))
+	for k, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].rel < group[j].rel })
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "package %s // %s\n", k.name, k.dir)
+		for _, p := range group {
+			if p.file.Doc != nil {
+				b.WriteString("\n")
+				writeDoc(&b, p.file.Doc)
+				break
+			}
+		}
+
+		pkg := Package{Dir: k.dir, Name: k.name}
+		for _, p := range group {
+			pkg.Files = append(pkg.Files, p.rel)
+			fmt.Fprintf(&b, "\n// %s\n", path.Base(p.rel))
+			writeDecls(&b, fset, p.file)
+		}
+		pkg.Outline = b.String()
+		pkgs = append(pkgs, pkg)
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Dir != pkgs[j].Dir {
+			return pkgs[i].Dir < pkgs[j].Dir
+		}
+		return pkgs[i].Name < pkgs[j].Name
+	})
+	return pkgs
+}
+
+// writeDecls writes the top-level declarations of a file, imports left out
+func writeDecls(b *strings.Builder, fset *token.FileSet, file *ast.File) {
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			fn := *d
+			fn.Doc, fn.Body = nil, nil
+			writeDoc(b, d.Doc)
+			writeNode(b, fset, &fn)
+
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			gen := *d
+			gen.Doc = nil
+			if d.Tok == token.CONST || d.Tok == token.VAR {
+				gen.Specs = shortenValues(fset, d.Specs)
+			}
+			writeDoc(b, d.Doc)
+			writeNode(b, fset, &gen)
+		}
+	}
+}
+
+// shortenValues replaces long initializers with ..., leaving the parsed
+// specs untouched
+func shortenValues(fset *token.FileSet, specs []ast.Spec) []ast.Spec {
+	out := make([]ast.Spec, len(specs))
+	for i, spec := range specs {
+		out[i] = spec
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok || len(vs.Values) == 0 {
+			continue
+		}
+
+		var buf bytes.Buffer
+		for _, value := range vs.Values {
+			printConfig.Fprint(&buf, fset, value)
+		}
+		if buf.Len() > maxValueLength || bytes.ContainsRune(buf.Bytes(), '\n') {
+			short := *vs
+			short.Values = []ast.Expr{ast.NewIdent("...")}
+			out[i] = &short
+		}
+	}
+	return out
+}
+
+func writeDoc(b *strings.Builder, doc *ast.CommentGroup) {
+	if doc == nil {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(doc.Text(), "\n"), "\n") {
+		if line == "" {
+			b.WriteString("//\n")
+		} else {
+			b.WriteString("// " + line + "\n")
+		}
+	}
+}
+
+func writeNode(b *strings.Builder, fset *token.FileSet, node ast.Node) {
+	var buf bytes.Buffer
+	if err := printConfig.Fprint(&buf, fset, node); err != nil {
+		return
+	}
+	b.Write(buf.Bytes())
+	b.WriteString("\n")
+}
+
+func isGoSource(path string) bool {
+	return strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go")
+}
+
+// skippedDir reports whether path is inside a directory the go tool
+// ignores or that holds dependencies
+func skippedDir(root, path string) bool {
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if part == "testdata" || part == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
+func relPath(absBase, path string) string {
+	rel, err := filepath.Rel(absBase, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
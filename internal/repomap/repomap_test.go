@@ -0,0 +1,180 @@
+package repomap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixture is a small codebase: a package with a doc file, a second package
+// below it, a file with a syntax error and files outlines leave out
+var fixture = map[string]string{
+	"shapes/doc.go": `// Package shapes measures plane figures.
+package shapes
+`,
+	"shapes/shape.go": `package shapes
+
+import "math"
+
+// Pi is re-exported for callers
+const Pi = math.Pi
+
+// names is too long to be worth showing
+var names = map[string]string{"circle": "a round shape", "square": "a shape with four equal sides"}
+
+var count, limit = 0, 10
+
+// Shape is a plane figure.
+//
+// Every shape has an area.
+type Shape interface {
+	Area() float64
+}
+
+// Circle is a Shape
+type Circle struct {
+	Radius float64 // in metres
+}
+
+// Area returns the circle's area
+func (c Circle) Area() float64 {
+	return Pi * c.Radius * c.Radius
+}
+
+func newCircle(r float64) *Circle { return &Circle{Radius: r} }
+`,
+	"shapes/shape_test.go":     "package shapes\n\nfunc TestArea() {}\n",
+	"shapes/testdata/fake.go":  "package fake\n",
+	"shapes/vendor/dep/dep.go": "package dep\n",
+	"shapes/gen/gen.go":        "package gen\n\nfunc Generated() {}\n",
+	"shapes/poly/poly.go":      "package poly\n\n// Sides counts the sides\nfunc Sides(n int) int { return n }\n",
+	"broken/broken.go":         "package broken\n\nfunc Good() {}\n\nfunc Bad( {\n",
+	"README.md":                "# shapes\n",
+}
+
+func writeFixture(t *testing.T) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	dir := t.TempDir()
+	for name, content := range fixture {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const shapesOutline = `package shapes // shapes
+
+// Package shapes measures plane figures.
+
+// doc.go
+
+// shape.go
+// Pi is re-exported for callers
+const Pi = math.Pi
+// names is too long to be worth showing
+var names = ...
+var count, limit = 0, 10
+// Shape is a plane figure.
+//
+// Every shape has an area.
+type Shape interface {
+	Area() float64
+}
+// Circle is a Shape
+type Circle struct {
+	Radius float64 // in metres
+}
+// Area returns the circle's area
+func (c Circle) Area() float64
+func newCircle(r float64) *Circle
+`
+
+func TestOutline(t *testing.T) {
+	dir := writeFixture(t)
+
+	pkgs, err := Outline(dir, ".", []string{"gen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dirs []string
+	for _, pkg := range pkgs {
+		dirs = append(dirs, pkg.Dir+" "+pkg.Name)
+	}
+	if want := []string{"broken broken", "shapes shapes", "shapes/poly poly"}; !reflect.DeepEqual(dirs, want) {
+		t.Fatalf("packages = %q, want %q", dirs, want)
+	}
+
+	shapes := pkgs[1]
+	if want := []string{"shapes/doc.go", "shapes/shape.go"}; !reflect.DeepEqual(shapes.Files, want) {
+		t.Errorf("Files = %q, want %q", shapes.Files, want)
+	}
+	if shapes.Outline != shapesOutline {
+		t.Errorf("Outline =\n%s\nwant\n%s", shapes.Outline, shapesOutline)
+	}
+
+	// Declarations before a syntax error are kept
+	if !strings.Contains(pkgs[0].Outline, "func Good()\n") {
+		t.Errorf("outline of a file with errors =\n%s", pkgs[0].Outline)
+	}
+	if want := pkgs[0].Outline + "\n" + shapes.Outline + "\n" + pkgs[2].Outline; Render(pkgs) != want {
+		t.Errorf("Render =\n%s", Render(pkgs))
+	}
+
+	// Without the exclude the generated package is outlined
+	pkgs, err = Outline(dir, "shapes", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs = dirs[:0]
+	for _, pkg := range pkgs {
+		dirs = append(dirs, pkg.Dir)
+	}
+	if want := []string{"shapes", "shapes/gen", "shapes/poly"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("packages under shapes = %q, want %q", dirs, want)
+	}
+}
+
+func TestOutlineFile(t *testing.T) {
+	dir := writeFixture(t)
+
+	pkgs, err := Outline(dir, "shapes/poly/poly.go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package poly // shapes/poly\n\n// poly.go\n// Sides counts the sides\nfunc Sides(n int) int\n"
+	if len(pkgs) != 1 || pkgs[0].Outline != want {
+		t.Errorf("Outline = %+v, want\n%s", pkgs, want)
+	}
+
+	if _, err := Outline(dir, "README.md", nil); err == nil || !strings.Contains(err.Error(), "not a Go source file") {
+		t.Errorf("Outline of a Markdown file = %v", err)
+	}
+	if _, err := Outline(dir, "missing", nil); !os.IsNotExist(err) {
+		t.Errorf("Outline of a missing path = %v, want not exist", err)
+	}
+	if _, err := Outline(dir, "../outside", nil); err == nil {
+		t.Error("Outline outside the codebase succeeded")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := writeFixture(t)
+
+	// Subdirectories aren't searched and attached files are left out
+	pkgs := Build(dir, []string{"shapes", "missing", "../outside"}, map[string]bool{"shapes/shape.go": true})
+	if len(pkgs) != 1 || !reflect.DeepEqual(pkgs[0].Files, []string{"shapes/doc.go"}) {
+		t.Fatalf("Build = %+v", pkgs)
+	}
+	if strings.Contains(pkgs[0].Outline, "Circle") {
+		t.Errorf("outline includes an excluded file:\n%s", pkgs[0].Outline)
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gongzhen/codewhisper-go/internal/agent"
+	"github.com/gongzhen/codewhisper-go/internal/conversations"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gorilla/mux"
+)
+
+// conversationBody is what clients send to create or replace a
+// conversation, or to append messages to one. Version, when replacing, is
+// the version the client last read.
+type conversationBody struct {
+	ID       string                  `json:"id,omitempty"`
+	Title    string                  `json:"title"`
+	Messages []conversations.Message `json:"messages"`
+	Version  int                     `json:"version,omitempty"`
+}
+
+// openConversations opens the conversation store in dir. The server still
+// runs without it, keeping history in the browser only.
+func openConversations(dir string) *conversations.Store {
+	store, err := conversations.Open(dir)
+	if err != nil {
+		utils.Log.Warning("Conversation store disabled: %v", err)
+		return nil
+	}
+	return store
+}
+
+// conversationStore returns the store, answering 503 when there is none
+func (s *Server) conversationStore(w http.ResponseWriter) *conversations.Store {
+	if s.conversations == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"detail": "Conversation store is not available"})
+	}
+	return s.conversations
+}
+
+func (s *Server) handleListConversations(w http.ResponseWriter, r *http.Request) {
+	store := s.conversationStore(w)
+	if store == nil {
+		return
+	}
+
+	summaries, err := store.List()
+	if err != nil {
+		utils.Log.Error("Failed to list conversations: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"detail": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *Server) handleCreateConversation(w http.ResponseWriter, r *http.Request) {
+	store := s.conversationStore(w)
+	if store == nil {
+		return
+	}
+
+	var body conversationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "Invalid request"})
+		return
+	}
+
+	c := &conversations.Conversation{ID: body.ID, Title: body.Title, Messages: body.Messages}
+	if err := store.Create(c); err != nil {
+		writeConversationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func (s *Server) handleGetConversation(w http.ResponseWriter, r *http.Request) {
+	store := s.conversationStore(w)
+	if store == nil {
+		return
+	}
+
+	c, err := store.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeConversationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// handleSaveConversation replaces a conversation, creating it if needed,
+// so clients can push conversations they started locally. A request naming
+// a version that is no longer current gets 409 Conflict.
+func (s *Server) handleSaveConversation(w http.ResponseWriter, r *http.Request) {
+	store := s.conversationStore(w)
+	if store == nil {
+		return
+	}
+
+	var body conversationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "Invalid request"})
+		return
+	}
+
+	c := &conversations.Conversation{ID: mux.Vars(r)["id"], Title: body.Title, Messages: body.Messages, Version: body.Version}
+	if err := store.Save(c); err != nil {
+		writeConversationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) handleAppendMessages(w http.ResponseWriter, r *http.Request) {
+	store := s.conversationStore(w)
+	if store == nil {
+		return
+	}
+
+	var body conversationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Messages) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "Messages are required"})
+		return
+	}
+
+	c, err := store.Append(mux.Vars(r)["id"], body.Messages...)
+	if err != nil {
+		writeConversationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) handleDeleteConversation(w http.ResponseWriter, r *http.Request) {
+	store := s.conversationStore(w)
+	if store == nil {
+		return
+	}
+
+	if err := store.Delete(mux.Vars(r)["id"]); err != nil {
+		writeConversationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func writeConversationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, conversations.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": err.Error()})
+	case errors.Is(err, conversations.ErrExists), errors.Is(err, conversations.ErrConflict):
+		writeJSON(w, http.StatusConflict, map[string]string{"detail": err.Error()})
+	case errors.Is(err, conversations.ErrInvalidID):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+	default:
+		// The store couldn't be read or written, or holds a corrupt file
+		utils.Log.Error("Conversation store error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"detail": err.Error()})
+	}
+}
+
+// loadHistory fills in the history of a chat request that references a
+// stored conversation instead of carrying its history
+func (s *Server) loadHistory(req *agent.ChatRequest) {
+	id := req.Input.ConversationID
+	if s.conversations == nil || id == "" || len(req.Input.ChatHistory) > 0 {
+		return
+	}
+
+	c, err := s.conversations.Get(id)
+	if err != nil {
+		if !errors.Is(err, conversations.ErrNotFound) {
+			utils.Log.Warning("Failed to load conversation %s: %v", id, err)
+		}
+		return
+	}
+	req.Input.ChatHistory = c.History()
+	utils.Log.Info("Loaded %d exchanges of conversation %s", len(req.Input.ChatHistory), id)
+}
+
+// recordExchange appends a finished question and answer to the stored
+// conversation the request references
+func (s *Server) recordExchange(req agent.ChatRequest, answer string) {
+	id := req.Input.ConversationID
+	if s.conversations == nil || id == "" || answer == "" {
+		return
+	}
+
+	_, err := s.conversations.Append(id,
+		conversations.Message{Role: conversations.RoleHuman, Content: req.Input.Question},
+		conversations.Message{Role: conversations.RoleAssistant, Content: answer},
+	)
+	if err != nil {
+		utils.Log.Warning("Failed to save conversation %s: %v", id, err)
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConversationErrors(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	dir := filepath.Join(os.Getenv("HOME"), ".codewhisper", "conversations")
+	if err := os.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{"create", "POST", "/api/conversations", `{"id":"abc","title":"First"}`, http.StatusCreated},
+		{"create taken ID", "POST", "/api/conversations", `{"id":"abc"}`, http.StatusConflict},
+		{"create invalid ID", "POST", "/api/conversations", `{"id":"../abc"}`, http.StatusBadRequest},
+		{"create malformed body", "POST", "/api/conversations", `{`, http.StatusBadRequest},
+		{"get", "GET", "/api/conversations/abc", "", http.StatusOK},
+		{"get missing", "GET", "/api/conversations/missing", "", http.StatusNotFound},
+		{"save", "PUT", "/api/conversations/abc", `{"title":"Renamed","version":1}`, http.StatusOK},
+		{"save stale version", "PUT", "/api/conversations/abc", `{"title":"Stale","version":1}`, http.StatusConflict},
+		{"save invalid ID", "PUT", "/api/conversations/a.b", `{"title":"x"}`, http.StatusBadRequest},
+		{"append invalid ID", "POST", "/api/conversations/a.b/messages", `{"messages":[{"role":"human","content":"hi"}]}`, http.StatusBadRequest},
+		// A file the store can't read is a server error, not the client's
+		{"get corrupt", "GET", "/api/conversations/corrupt", "", http.StatusInternalServerError},
+		{"save over corrupt", "PUT", "/api/conversations/corrupt", `{"title":"x","version":1}`, http.StatusInternalServerError},
+		{"append to corrupt", "POST", "/api/conversations/corrupt/messages", `{"messages":[{"role":"human","content":"hi"}]}`, http.StatusInternalServerError},
+		{"delete", "DELETE", "/api/conversations/abc", "", http.StatusOK},
+		{"delete missing", "DELETE", "/api/conversations/abc", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		var resp map[string]interface{}
+		if status := request(t, s, tt.method, tt.url, tt.body, &resp); status != tt.status {
+			t.Errorf("%s: %s %s = %d %v, want %d", tt.name, tt.method, tt.url, status, resp, tt.status)
+		}
+	}
+}
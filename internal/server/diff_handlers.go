@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gongzhen/codewhisper-go/internal/diff"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+// ApplyChangesRequest is the body sent by the diff view's "Apply Changes" button
+type ApplyChangesRequest struct {
+	Diff     string  `json:"diff"`
+	FilePath string  `json:"filePath"`
+	Content  *string `json:"content,omitempty"`
+	Validate bool    `json:"validate,omitempty"`
+}
+
+// ValidateDiffRequest is the body of a dry-run validation request
+type ValidateDiffRequest struct {
+	Diff          string  `json:"diff"`
+	TargetFile    string  `json:"targetFile"`
+	TargetContent *string `json:"targetContent,omitempty"`
+}
+
+func (s *Server) handleApplyChanges(w http.ResponseWriter, r *http.Request) {
+	var req ApplyChangesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "Invalid request"})
+		return
+	}
+
+	if strings.TrimSpace(req.Diff) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "Diff is required"})
+		return
+	}
+
+	patches, err := diff.Parse(req.Diff)
+	if err != nil {
+		utils.Log.Warning("Failed to parse diff: %v", err)
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"status": "error",
+			"detail": map[string]string{"message": "Invalid diff: " + err.Error()},
+		})
+		return
+	}
+
+	targetDir := s.config.Get().Target
+	opts := diff.Options{
+		DryRun:      req.Validate,
+		DefaultPath: req.FilePath,
+	}
+	if req.Validate {
+		// Caller-supplied content is only used for validation, never written
+		opts.Content = req.Content
+	}
+
+	utils.Log.Info("Applying diff to %d file(s) (dry run: %v)", len(patches), opts.DryRun)
+
+	result, err := diff.Apply(targetDir, patches, opts)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"status": "error",
+			"detail": map[string]string{"message": err.Error()},
+		})
+		return
+	}
+
+	summary := result.Summary()
+	utils.Log.Info("Apply changes result: %s (%s)", result.Status, summary)
+
+	details := map[string]interface{}{
+		"summary": summary,
+		"files":   result.Files,
+		"hunks":   result.Hunks(),
+	}
+
+	switch result.Status {
+	case diff.ResultSuccess:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":  "success",
+			"message": "Changes applied successfully",
+			"details": details,
+		})
+	case diff.ResultPartial:
+		writeJSON(w, http.StatusMultiStatus, map[string]interface{}{
+			"status":  "partial",
+			"message": "Some changes could not be applied",
+			"details": details,
+		})
+	default:
+		details["message"] = "Failed to apply changes: " + firstFileError(result)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"status": "error",
+			"detail": details,
+		})
+	}
+}
+
+func (s *Server) handleValidateDiff(w http.ResponseWriter, r *http.Request) {
+	var req ValidateDiffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "Invalid request"})
+		return
+	}
+
+	if strings.TrimSpace(req.Diff) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "Diff is required"})
+		return
+	}
+
+	patches, err := diff.Parse(req.Diff)
+	if err != nil {
+		// An unparseable diff is a validation result, not a request error
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"wouldApply":        false,
+			"wouldApplyCleanly": false,
+			"result":            diff.HunkConflict,
+			"summary":           "Invalid diff: " + err.Error(),
+		})
+		return
+	}
+
+	targetDir := s.config.Get().Target
+	validation, err := diff.Validate(targetDir, patches, diff.Options{
+		DefaultPath: req.TargetFile,
+		Content:     req.TargetContent,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+
+	utils.Log.Info("Validated diff: %s", validation.Summary)
+	writeJSON(w, http.StatusOK, validation)
+}
+
+// firstFileError returns the most relevant failure reason of a result
+func firstFileError(result *diff.Result) string {
+	for _, f := range result.Files {
+		if f.Error != "" {
+			return f.Error
+		}
+		for _, h := range f.Hunks {
+			if h.Status == diff.StatusFailed && h.Reason != "" {
+				return h.Reason
+			}
+		}
+	}
+	return "no hunks could be applied"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/tokenizer"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+// fileEntry is the cached state of one file in the folder index
+type fileEntry struct {
+	modTime time.Time
+	size    int64
+	tokens  int
+	skip    bool   // binary or image, left out of the tree
+	gen     uint64 // last build that saw the file
+}
+
+// folderIndex caches token counts keyed by path, modification time and
+// size, so rebuilding the folder tree only reads files that changed
+type folderIndex struct {
+	// build serializes tree builds, mu guards the fields below
+	build sync.Mutex
+	mu    sync.Mutex
+
+	files     map[string]*fileEntry
+	tokenizer string
+	gen       uint64
+	hits      int
+	misses    int
+}
+
+func newFolderIndex() *folderIndex {
+	return &folderIndex{files: make(map[string]*fileEntry)}
+}
+
+// begin starts a build. Every cached count is dropped when refresh is set or
+// when the tokenizer changed since the counts were taken.
+func (idx *folderIndex) begin(refresh bool) {
+	idx.build.Lock()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	name := tokenizer.Default().Name()
+	if refresh || name != idx.tokenizer {
+		idx.files = make(map[string]*fileEntry)
+		idx.tokenizer = name
+	}
+	idx.gen++
+	idx.hits, idx.misses = 0, 0
+}
+
+// lookup returns a file's token count and whether it belongs in the tree,
+// reading the file only when its size or modification time changed
+func (idx *folderIndex) lookup(path string, info fs.FileInfo) (int, bool) {
+	idx.mu.Lock()
+	entry, ok := idx.files[path]
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		entry.gen = idx.gen
+		idx.hits++
+		idx.mu.Unlock()
+		return entry.tokens, !entry.skip
+	}
+	idx.mu.Unlock()
+
+	entry = &fileEntry{modTime: info.ModTime(), size: info.Size()}
+	if utils.IsBinaryFile(path) || utils.IsImageFile(path) {
+		entry.skip = true
+	} else {
+		entry.tokens = utils.CountTokensInFile(path)
+	}
+
+	idx.mu.Lock()
+	entry.gen = idx.gen
+	idx.files[path] = entry
+	idx.misses++
+	idx.mu.Unlock()
+
+	return entry.tokens, !entry.skip
+}
+
+// tokens returns the cached token count of a file
+func (idx *folderIndex) tokens(path string) int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if entry, ok := idx.files[path]; ok {
+		return entry.tokens
+	}
+	return 0
+}
+
+// finish ends a build, dropping files it didn't see because they were
+// deleted or are now ignored
+func (idx *folderIndex) finish() {
+	defer idx.build.Unlock()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	removed := 0
+	for path, entry := range idx.files {
+		if entry.gen != idx.gen {
+			delete(idx.files, path)
+			removed++
+		}
+	}
+	utils.Log.Debug("Folder index: %d files cached, %d rescanned, %d removed", idx.hits, idx.misses, removed)
+}
+
+// update recounts a file the watcher saw change, returning its token count
+// and whether it belongs in the tree
+func (idx *folderIndex) update(path string) (int, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		idx.remove(path)
+		return 0, false
+	}
+	return idx.lookup(path, info)
+}
+
+// remove drops path and, if it was a directory, everything under it
+func (idx *folderIndex) remove(path string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	prefix := path + string(filepath.Separator)
+	for p := range idx.files {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(idx.files, p)
+		}
+	}
+}
+
+// reset drops every cached count
+func (idx *folderIndex) reset() {
+	idx.mu.Lock()
+	idx.files = make(map[string]*fileEntry)
+	idx.mu.Unlock()
+}
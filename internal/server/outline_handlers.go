@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/gongzhen/codewhisper-go/internal/repomap"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+// handleOutline returns the Go outline of a file or of the packages under a
+// directory: /api/outline?path=internal/agent. An empty path outlines the
+// whole codebase.
+func (s *Server) handleOutline(w http.ResponseWriter, r *http.Request) {
+	rel := r.URL.Query().Get("path")
+	if rel == "" {
+		rel = "."
+	}
+
+	cfg := s.config.Get()
+	pkgs, err := repomap.Outline(cfg.Target, rel, cfg.Exclude)
+	if err != nil {
+		status := http.StatusBadRequest
+		if os.IsNotExist(err) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, map[string]string{"detail": err.Error()})
+		return
+	}
+
+	outline := repomap.Render(pkgs)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"path":        rel,
+		"packages":    pkgs,
+		"outline":     outline,
+		"token_count": utils.CountTokens(outline),
+	})
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandleOutline(t *testing.T) {
+	s, _ := newTestServer(t, map[string]string{
+		"app/app.go":        "package app\n\n// Run starts the app\nfunc Run() error {\n\treturn nil\n}\n",
+		"app/util/util.go":  "package util\n\nfunc Helper() {}\n",
+		"app/app_test.go":   "package app\n\nfunc TestRun() {}\n",
+		"notes.txt":         "not Go\n",
+		"vendor/dep/dep.go": "package dep\n",
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		packages []string
+		outline  string
+	}{
+		{name: "codebase", status: http.StatusOK, packages: []string{"app", "app/util"}, outline: "// Run starts the app\nfunc Run() error\n"},
+		{name: "directory", path: "app/util", status: http.StatusOK, packages: []string{"app/util"}, outline: "func Helper()\n"},
+		{name: "file", path: "app/app.go", status: http.StatusOK, packages: []string{"app"}, outline: "package app // app\n"},
+		{name: "not Go", path: "notes.txt", status: http.StatusBadRequest},
+		{name: "missing", path: "app/missing.go", status: http.StatusNotFound},
+		{name: "outside the codebase", path: "../etc", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Packages []struct {
+					Dir   string   `json:"dir"`
+					Files []string `json:"files"`
+				} `json:"packages"`
+				Outline    string `json:"outline"`
+				TokenCount int    `json:"token_count"`
+				Detail     string `json:"detail"`
+			}
+			status := request(t, s, "GET", "/api/outline?path="+tt.path, "", &resp)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d: %+v", status, tt.status, resp)
+			}
+			if status != http.StatusOK {
+				if resp.Detail == "" {
+					t.Error("error response has no detail")
+				}
+				return
+			}
+
+			var dirs []string
+			for _, pkg := range resp.Packages {
+				dirs = append(dirs, pkg.Dir)
+				for _, file := range pkg.Files {
+					if strings.HasSuffix(file, "_test.go") {
+						t.Errorf("outlined test file %s", file)
+					}
+				}
+			}
+			if strings.Join(dirs, ",") != strings.Join(tt.packages, ",") {
+				t.Errorf("packages = %v, want %v", dirs, tt.packages)
+			}
+			if !strings.Contains(resp.Outline, tt.outline) || resp.TokenCount == 0 {
+				t.Errorf("outline (%d tokens) =\n%s\nwant it to contain\n%s", resp.TokenCount, resp.Outline, tt.outline)
+			}
+		})
+	}
+}
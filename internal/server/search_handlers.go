@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gongzhen/codewhisper-go/internal/index"
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+// maxSearchResults caps the limit a client may ask for
+const maxSearchResults = 1000
+
+// codeIndex returns the index of the configured codebase
+func (s *Server) codeIndex() *index.Index {
+	cfg := s.config.Get()
+	return index.For(cfg.Target, index.Options{Dir: cfg.IndexDir, Exclude: cfg.Exclude})
+}
+
+// warmIndex brings the code index up to date in the background so the
+// first search or question doesn't wait for it
+func (s *Server) warmIndex() {
+	ix := s.codeIndex()
+	go func() {
+		if _, err := ix.Update(); err != nil {
+			utils.Log.Warning("Failed to build code index: %v", err)
+		}
+	}()
+}
+
+// handleSearch searches the codebase:
+// /api/search?q=...&mode=literal|regex|symbol&case=true&path=dir&limit=100
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := index.Query{
+		Pattern:       query.Get("q"),
+		Mode:          strings.ToLower(query.Get("mode")),
+		CaseSensitive: query.Get("case") == "true",
+		Path:          query.Get("path"),
+	}
+	if q.Pattern == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "Query parameter q is required"})
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "limit must be a positive number"})
+			return
+		}
+		q.Limit = min(n, maxSearchResults)
+	}
+
+	ix := s.codeIndex()
+	if err := ix.Refresh(); err != nil {
+		utils.Log.Warning("Code index may be stale: %v", err)
+	}
+
+	result, err := ix.Search(r.Context(), q)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	utils.Log.Debug("Search %q (%s): %d matches in %d files", q.Pattern, q.Mode, len(result.Matches), result.FilesSearched)
+	writeJSON(w, http.StatusOK, result)
+}
@@ -6,14 +6,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gongzhen/codewhisper-go/internal/agent"
+	"github.com/gongzhen/codewhisper-go/internal/conversations"
+	"github.com/gongzhen/codewhisper-go/internal/models"
+	"github.com/gongzhen/codewhisper-go/internal/tokenizer"
 	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gongzhen/codewhisper-go/internal/watcher"
 	"github.com/gongzhen/codewhisper-go/pkg/config"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -25,13 +31,33 @@ type Server struct {
 	httpServer *http.Server
 	port       int
 	agent      *agent.Agent
+	agentMu    sync.Mutex
+	folders    *folderIndex
+	config     *config.Store
+
+	conversations *conversations.Store
+
+	watcher      *watcher.Watcher
+	folderEvents *folderEvents
 }
 
 // NewServer creates a new server instance
-func NewServer(port int) *Server {
+func NewServer(port int, cfg *config.Store) *Server {
 	s := &Server{
-		router: mux.NewRouter(),
-		port:   port,
+		router:  mux.NewRouter(),
+		port:    port,
+		folders: newFolderIndex(),
+		config:  cfg,
+
+		folderEvents:  newFolderEvents(),
+		conversations: openConversations(cfg.Get().ConversationDir),
+	}
+
+	// Count tokens for the configured model until the agent selects its own
+	endpoint, model := s.currentModel()
+	modelID := models.ResolveModelID(endpoint, model)
+	if err := tokenizer.SetDefault(tokenizer.ForModel(endpoint, modelID)); err != nil {
+		utils.Log.Warning("Using default tokenizer: %v", err)
 	}
 
 	// Setup routes
@@ -62,11 +88,16 @@ func NewServer(port int) *Server {
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	utils.Log.Info("Server starting on http://localhost:%d", s.port)
+	s.startWatcher()
+	s.warmIndex()
 	return s.httpServer.ListenAndServe()
 }
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.watcher != nil {
+		s.watcher.Close()
+	}
 	return s.httpServer.Shutdown(ctx)
 }
 
@@ -75,6 +106,15 @@ func (s *Server) setupRoutes() {
 	// API routes that the React frontend expects
 	api := s.router.PathPrefix("/api").Subrouter()
 	api.HandleFunc("/folders", s.handleGetFolders).Methods("GET")
+	api.HandleFunc("/folders/events", s.handleFolderEvents).Methods("GET")
+	api.HandleFunc("/search", s.handleSearch).Methods("GET")
+	api.HandleFunc("/outline", s.handleOutline).Methods("GET")
+	api.HandleFunc("/conversations", s.handleListConversations).Methods("GET")
+	api.HandleFunc("/conversations", s.handleCreateConversation).Methods("POST")
+	api.HandleFunc("/conversations/{id}", s.handleGetConversation).Methods("GET")
+	api.HandleFunc("/conversations/{id}", s.handleSaveConversation).Methods("PUT")
+	api.HandleFunc("/conversations/{id}", s.handleDeleteConversation).Methods("DELETE")
+	api.HandleFunc("/conversations/{id}/messages", s.handleAppendMessages).Methods("POST")
 	api.HandleFunc("/current-model", s.handleGetCurrentModel).Methods("GET")
 	api.HandleFunc("/model-id", s.handleGetModelID).Methods("GET")
 	api.HandleFunc("/available-models", s.handleGetAvailableModels).Methods("GET")
@@ -83,6 +123,8 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/set-model", s.handleSetModel).Methods("POST")
 	api.HandleFunc("/model-settings", s.handleModelSettings).Methods("GET", "POST")
 	api.HandleFunc("/model-capabilities", s.handleModelCapabilities).Methods("GET")
+	api.HandleFunc("/apply-changes", s.handleApplyChanges).Methods("POST")
+	api.HandleFunc("/validate-diff", s.handleValidateDiff).Methods("POST")
 
     // ▼▼▼ ADD THIS NEW ROUTE HERE ▼▼▼
     api.HandleFunc("/file-content", s.handleGetFileContent).Methods("GET")	
@@ -127,8 +169,9 @@ type FolderStructure struct {
 }
 
 type ModelInfo struct {
-	ModelID  string `json:"model_id"`
-	Endpoint string `json:"endpoint"`
+	ModelID  string                    `json:"model_id"`
+	Endpoint string                    `json:"endpoint"`
+	Settings models.GenerationSettings `json:"settings"`
 }
 
 type ErrorResponse struct {
@@ -148,7 +191,7 @@ func (s *Server) handleGetFileContent(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    targetDir := config.GetEnv(config.EnvUserCodebaseDir, ".")
+    targetDir := s.config.Get().Target
     fullPath := filepath.Join(targetDir, filePath)
 
     absTargetDir, _ := filepath.Abs(targetDir)
@@ -228,23 +271,40 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleGetFolders(w http.ResponseWriter, r *http.Request) {
-	userCodebaseDir := config.GetEnv(config.EnvUserCodebaseDir, ".")
-	maxDepth := config.GetEnvInt(config.EnvMaxDepth, 15)
-
-	// Get ignored patterns
-	ignoredPatterns := utils.GetIgnoredPatterns(userCodebaseDir)
+	cfg := s.config.Get()
+	userCodebaseDir, maxDepth := cfg.Target, cfg.MaxDepth
+
+	// Unchanged files keep their cached token counts; ?refresh=true recounts everything
+	s.folders.begin(r.URL.Query().Get("refresh") == "true")
+	defer s.folders.finish()
+
+	// Walk once, counting files in parallel as they are found
+	tree := utils.WalkTree(userCodebaseDir, utils.WalkOptions{
+		MaxDepth: maxDepth,
+		Exclude:  cfg.Exclude,
+		Visit: func(path string, entry fs.DirEntry) bool {
+			info, err := entry.Info()
+			if err != nil {
+				return false
+			}
+			_, ok := s.folders.lookup(path, info)
+			return ok
+		},
+	})
 
 	// Build folder structure
-	structure := s.getFolderStructure(userCodebaseDir, ignoredPatterns, maxDepth)
+	structure := s.getFolderStructure(tree)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(structure)
 }
 
 func (s *Server) handleGetCurrentModel(w http.ResponseWriter, r *http.Request) {
+	endpoint, modelID := s.currentModel()
 	modelInfo := ModelInfo{
-		ModelID:  config.GetEnv(config.EnvModel, "sonnet3.5-v2"),
-		Endpoint: config.GetEnv(config.EnvEndpoint, "bedrock"),
+		ModelID:  modelID,
+		Endpoint: endpoint,
+		Settings: models.GenerationSettings(s.config.Get().Generation),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -252,24 +312,59 @@ func (s *Server) handleGetCurrentModel(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleGetModelID(w http.ResponseWriter, r *http.Request) {
-	modelID := config.GetEnv(config.EnvModel, "sonnet3.5-v2")
+	_, modelID := s.currentModel()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"model_id": modelID})
 }
 
 func (s *Server) handleGetAvailableModels(w http.ResponseWriter, r *http.Request) {
-	// Simplified for now - return bedrock models
-	models := []map[string]string{
-		{"id": "sonnet3.5-v2", "name": "Claude 3.5 Sonnet v2"},
-		{"id": "sonnet3.5", "name": "Claude 3.5 Sonnet"},
-		{"id": "opus", "name": "Claude 3 Opus"},
-		{"id": "sonnet", "name": "Claude 3 Sonnet"},
-		{"id": "haiku", "name": "Claude 3 Haiku"},
+	endpoint := s.config.Get().Endpoint
+
+	a, err := s.getAgent()
+	if err != nil {
+		// Without a working provider, show what we know offline
+		utils.Log.Warning("Listing built-in models, agent unavailable: %v", err)
+		if endpoint == "ollama" {
+			s.handleGetOllamaModels(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.StaticModels(endpoint))
+		return
+	}
+
+	specs, err := a.ModelManager().ListModels(r.Context())
+	if err != nil {
+		utils.Log.Warning("Serving fallback model list: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(specs)
+}
+
+// handleGetOllamaModels lists the models installed on the local Ollama server
+func (s *Server) handleGetOllamaModels(w http.ResponseWriter, r *http.Request) {
+	installed, err := models.ListOllamaModels(r.Context(), models.OllamaHost(s.config.Get().Providers.Ollama.APIBase))
+	if err != nil {
+		utils.Log.Error("Failed to list Ollama models: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result := make([]map[string]string, 0, len(installed))
+	for _, m := range installed {
+		name := m.Name
+		if m.Details.ParameterSize != "" {
+			name = fmt.Sprintf("%s (%s)", m.Name, m.Details.ParameterSize)
+		}
+		result = append(result, map[string]string{"id": m.Name, "name": name})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(models)
+	json.NewEncoder(w).Encode(result)
 }
 
 func (s *Server) handleTokenCount(w http.ResponseWriter, r *http.Request) {
@@ -287,7 +382,10 @@ func (s *Server) handleTokenCount(w http.ResponseWriter, r *http.Request) {
 	tokenCount := utils.CountTokens(req.Text)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"token_count": tokenCount})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token_count": tokenCount,
+		"tokenizer":   tokenizer.Default().Name(),
+	})
 }
 
 func (s *Server) handleDefaultIncludedFolders(w http.ResponseWriter, r *http.Request) {
@@ -298,6 +396,8 @@ func (s *Server) handleDefaultIncludedFolders(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// handleSetModel switches the agent to another endpoint or model. The new
+// provider is validated first; on failure the current one stays in use.
 func (s *Server) handleSetModel(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		ModelID  string `json:"model_id"`
@@ -305,46 +405,149 @@ func (s *Server) handleSetModel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid request"})
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "error": "Invalid request"})
+		return
+	}
+	if strings.TrimSpace(req.ModelID) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "error": "model_id is required"})
 		return
 	}
+	if req.Endpoint == "" {
+		req.Endpoint = s.config.Get().Endpoint
+	}
 
-	// Update environment variables
-	config.SetEnv(config.EnvModel, req.ModelID)
-	config.SetEnv(config.EnvEndpoint, req.Endpoint)
+	// Validation makes a network request, so it happens before the agent
+	// is locked and only the swap holds agentMu
+	provider, err := models.ValidatedProvider(s.config.Get(), req.Endpoint, req.ModelID)
+	if err != nil {
+		utils.Log.Error("Failed to switch to %s model %s: %v", req.Endpoint, req.ModelID, err)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"status": "error", "error": err.Error()})
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	s.agentMu.Lock()
+	if s.agent != nil {
+		s.agent.ModelManager().UseProvider(req.Endpoint, provider)
+	} else {
+		// The agent may have failed to start with the old settings, so
+		// build it directly around the requested model
+		s.agent = agent.NewAgentWithProvider(s.config, req.Endpoint, provider)
+	}
+	s.agentMu.Unlock()
+
+	// Remember the choice for the rest of the server and the next start
+	err = s.config.Update(func(c *config.Config) {
+		c.Endpoint, c.Model = req.Endpoint, req.ModelID
+	})
+	if err != nil {
+		utils.Log.Warning("Model choice won't be remembered: %v", err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "success",
+		"success":  true,
+		"model_id": req.ModelID,
+		"endpoint": req.Endpoint,
+	})
+}
+
+// ModelSettingsRequest is a partial settings update; omitted fields keep
+// their current value
+type ModelSettingsRequest struct {
+	Temperature     *float64  `json:"temperature"`
+	TopP            *float64  `json:"top_p"`
+	TopK            *int      `json:"top_k"`
+	MaxOutputTokens *int      `json:"max_output_tokens"`
+	StopSequences   *[]string `json:"stop_sequences"`
+	ThinkingMode    *bool     `json:"thinking_mode"`
+	ThinkingBudget  *int      `json:"thinking_budget"`
+}
+
+// apply merges the request into the given settings
+func (req ModelSettingsRequest) apply(settings models.GenerationSettings) models.GenerationSettings {
+	if req.Temperature != nil {
+		settings.Temperature = *req.Temperature
+	}
+	if req.TopP != nil {
+		settings.TopP = *req.TopP
+	}
+	if req.TopK != nil {
+		settings.TopK = *req.TopK
+	}
+	if req.MaxOutputTokens != nil {
+		settings.MaxOutputTokens = *req.MaxOutputTokens
+	}
+	if req.StopSequences != nil {
+		settings.StopSequences = *req.StopSequences
+	}
+	if req.ThinkingMode != nil {
+		settings.ThinkingMode = *req.ThinkingMode
+	}
+	if req.ThinkingBudget != nil {
+		settings.ThinkingBudget = *req.ThinkingBudget
+	}
+	return settings
 }
 
 func (s *Server) handleModelSettings(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		settings := map[string]interface{}{
-			"temperature":       config.GetEnv(config.EnvTemperature, "0.7"),
-			"max_output_tokens": config.GetEnvInt(config.EnvMaxOutputTokens, 4096),
-			"top_k":             config.GetEnvInt(config.EnvTopK, 40),
-			"thinking_mode":     config.GetEnvBool(config.EnvThinkingMode, false),
-		}
-
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(settings)
-	} else if r.Method == "POST" {
-		var settings map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+		json.NewEncoder(w).Encode(models.GenerationSettings(s.config.Get().Generation))
+		return
+	}
 
-		// Update settings in environment
-		if temp, ok := settings["temperature"].(float64); ok {
-			config.SetEnv(config.EnvTemperature, fmt.Sprintf("%f", temp))
-		}
-		// ... handle other settings
+	var req ModelSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "error": "Invalid request"})
+		return
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	settings := req.apply(models.GenerationSettings(s.config.Get().Generation))
+	spec := s.currentModelSpec(r.Context())
+	if err := settings.Validate(spec); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"status": "error", "error": err.Error()})
+		return
+	}
+
+	err := s.config.Update(func(c *config.Config) {
+		c.Generation = config.Generation(settings)
+	})
+	if err != nil {
+		utils.Log.Warning("Model settings won't be remembered: %v", err)
+	}
+	utils.Log.Info("Model settings updated for %s: temperature %.2f, top_k %d, max output %d, thinking %t",
+		spec.ID, settings.Temperature, settings.TopK, settings.MaxOutputTokens, settings.ThinkingMode)
+
+	response := map[string]interface{}{
+		"status":   "success",
+		"success":  true,
+		"settings": settings,
+	}
+	if ignored := settings.Ignored(spec); len(ignored) > 0 {
+		response["ignored"] = ignored
 	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// currentModelSpec returns the catalog entry for the configured model, using
+// the built-in limits when the agent isn't available
+func (s *Server) currentModelSpec(ctx context.Context) models.ModelSpec {
+	if a, err := s.getAgent(); err == nil {
+		return a.ModelManager().CurrentModelSpec(ctx)
+	}
+
+	endpoint, modelID := s.currentModel()
+	return models.LookupModel(endpoint, models.ResolveModelID(endpoint, modelID))
+}
+
+// currentModel returns the configured endpoint and model, or the
+// endpoint's default model when none is configured
+func (s *Server) currentModel() (string, string) {
+	cfg := s.config.Get()
+	if cfg.Model == "" {
+		return cfg.Endpoint, models.DefaultModel(cfg.Endpoint)
+	}
+	return cfg.Endpoint, cfg.Model
 }
 
 func (s *Server) handleStreamChatLog(w http.ResponseWriter, r *http.Request) {
@@ -378,14 +581,11 @@ func (s *Server) handleStreamChatLog(w http.ResponseWriter, r *http.Request) {
 
 	flusher.Flush()
 
-	if s.agent == nil {
-		var err error
-		s.agent, err = agent.NewAgent()
-		if err != nil {
-			fmt.Fprintf(w, "data: {\"error\": \"initialization_error\", \"detail\": \"Failed to initialize agent\"}\n\n")
-			flusher.Flush()
-			return
-		}
+	chatAgent, err := s.getAgent()
+	if err != nil {
+		fmt.Fprintf(w, "data: {\"error\": \"initialization_error\", \"detail\": \"Failed to initialize agent\"}\n\n")
+		flusher.Flush()
+		return
 	}
 
 	var req agent.ChatRequest
@@ -398,10 +598,11 @@ func (s *Server) handleStreamChatLog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.Log.Info("Processing stream request for question: %s", req.Input.Question)
+	s.loadHistory(&req)
 
 	agentCtx := r.Context()
 
-	eventChan, err := s.agent.StreamChat(agentCtx, req)
+	eventChan, err := chatAgent.StreamChat(agentCtx, req)
 	if err != nil {
 		fmt.Fprintf(w, "data: {\"error\": \"stream_error\", \"detail\": \"%s\"}\n\n", err.Error())
 		flusher.Flush()
@@ -409,12 +610,16 @@ func (s *Server) handleStreamChatLog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	messageCount := 0
+	var answer strings.Builder
 
 	for {
 		select {
 		case event, ok := <-eventChan:
 			if !ok {
 				utils.Log.Info("Event channel closed after %d messages", messageCount)
+				if agentCtx.Err() == nil {
+					s.recordExchange(req, answer.String())
+				}
 				return
 			}
 
@@ -429,8 +634,57 @@ func (s *Server) handleStreamChatLog(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			if len(event.SelectedFiles) > 0 {
+				msg := map[string]interface{}{
+					"ops": []map[string]interface{}{
+						{
+							"op":    "add",
+							"path":  "/selected_files",
+							"value": event.SelectedFiles,
+						},
+					},
+				}
+
+				data, _ := json.Marshal(msg)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				flusher.Flush()
+			}
+
+			if event.SummarizedExchanges > 0 {
+				msg := map[string]interface{}{
+					"ops": []map[string]interface{}{
+						{
+							"op":    "add",
+							"path":  "/summarized_exchanges",
+							"value": event.SummarizedExchanges,
+						},
+					},
+				}
+
+				data, _ := json.Marshal(msg)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				flusher.Flush()
+			}
+
+			if len(event.TrimmedFiles) > 0 {
+				msg := map[string]interface{}{
+					"ops": []map[string]interface{}{
+						{
+							"op":    "add",
+							"path":  "/trimmed_files",
+							"value": event.TrimmedFiles,
+						},
+					},
+				}
+
+				data, _ := json.Marshal(msg)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				flusher.Flush()
+			}
+
 			if event.Content != "" {
 				messageCount++
+				answer.WriteString(event.Content)
 
 				msg := map[string]interface{}{
 					"ops": []map[string]interface{}{
@@ -464,57 +718,42 @@ func (s *Server) handleStreamChatLog(w http.ResponseWriter, r *http.Request) {
 
 // Helper methods
 
-func (s *Server) getFolderStructure(dir string, patterns []utils.PatternSource, maxDepth int) map[string]interface{} {
-	shouldIgnore := utils.ParseGitignorePatterns(patterns)
+// getAgent returns the shared agent, creating it on first use
+func (s *Server) getAgent() (*agent.Agent, error) {
+	s.agentMu.Lock()
+	defer s.agentMu.Unlock()
 
-	result := make(map[string]interface{})
-	s.buildFolderStructureRecursive(dir, dir, result, shouldIgnore, 0, maxDepth)
-
-	return result
-}
-
-func (s *Server) buildFolderStructureRecursive(baseDir, currentDir string, result map[string]interface{}, shouldIgnore utils.IgnoreMatcher, depth, maxDepth int) {
-	if depth > maxDepth {
-		return
-	}
-
-	entries, err := os.ReadDir(currentDir)
-	if err != nil {
-		return
-	}
-
-	for _, entry := range entries {
-		if strings.HasPrefix(entry.Name(), ".") {
-			continue
+	if s.agent == nil {
+		a, err := agent.NewAgent(s.config)
+		if err != nil {
+			utils.Log.Error("Failed to initialize agent: %v", err)
+			return nil, err
 		}
+		s.agent = a
+	}
+	return s.agent, nil
+}
 
-		fullPath := filepath.Join(currentDir, entry.Name())
-
-		if shouldIgnore(fullPath) {
-			continue
-		}
+// getFolderStructure converts a walked tree to the nested maps the
+// frontend expects, with token counts from the folder index
+func (s *Server) getFolderStructure(tree *utils.TreeNode) map[string]interface{} {
+	result := make(map[string]interface{})
 
-		if entry.IsDir() {
-			dirNode := map[string]interface{}{
-				"token_count": 0,
-				"children":    make(map[string]interface{}),
+	for _, child := range tree.Children {
+		if child.IsDir {
+			children := s.getFolderStructure(child)
+			result[child.Name] = map[string]interface{}{
+				"token_count": s.calculateDirTokenCount(children),
+				"children":    children,
 			}
-
-			s.buildFolderStructureRecursive(baseDir, fullPath, dirNode["children"].(map[string]interface{}), shouldIgnore, depth+1, maxDepth)
-
-			tokenCount := s.calculateDirTokenCount(dirNode["children"].(map[string]interface{}))
-			dirNode["token_count"] = tokenCount
-
-			result[entry.Name()] = dirNode
 		} else {
-			if !utils.IsBinaryFile(fullPath) && !utils.IsImageFile(fullPath) {
-				tokenCount := utils.CountTokensInFile(fullPath)
-				result[entry.Name()] = map[string]interface{}{
-					"token_count": tokenCount,
-				}
+			result[child.Name] = map[string]interface{}{
+				"token_count": s.folders.tokens(child.Path),
 			}
 		}
 	}
+
+	return result
 }
 
 func (s *Server) calculateDirTokenCount(children map[string]interface{}) int {
@@ -531,45 +770,64 @@ func (s *Server) calculateDirTokenCount(children map[string]interface{}) int {
 	return total
 }
 
+// handleModelCapabilities reports the limits of a model from the catalog.
+// It describes the current model unless ?endpoint= or ?model= pick another.
 func (s *Server) handleModelCapabilities(w http.ResponseWriter, r *http.Request) {
+	current, currentModel := s.currentModel()
 	endpoint := r.URL.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = current
+	}
+	modelID := r.URL.Query().Get("model")
+
+	var specs []models.ModelSpec
+	var spec models.ModelSpec
+	found := false
+
+	a, err := s.getAgent()
+	if err == nil && endpoint == current {
+		specs, _ = a.ModelManager().ListModels(r.Context())
+		if modelID == "" {
+			spec, found = a.ModelManager().CurrentModelSpec(r.Context()), true
+		}
+	} else {
+		specs = models.StaticModels(endpoint)
+	}
+
+	if modelID == "" {
+		modelID = currentModel
+	}
+	modelID = models.ResolveModelID(endpoint, modelID)
+	for _, candidate := range specs {
+		if !found && candidate.ID == modelID {
+			spec, found = candidate, true
+		}
+	}
+	if !found {
+		spec = models.LookupModel(endpoint, modelID)
+	}
 
 	capabilities := map[string]interface{}{
+		"model_id":             spec.ID,
+		"endpoint":             endpoint,
 		"supportsStreaming":    true,
 		"supportsSystemPrompt": true,
-		"maxTokens":            200000,
-		"supportsFunctions":    false,
-		"supportsVision":       false,
-	}
-
-	switch endpoint {
-	case "bedrock", "":
-		capabilities["models"] = []map[string]interface{}{
-			{"id": "sonnet3.5-v2", "name": "Claude 3.5 Sonnet v2", "maxTokens": 200000},
-			{"id": "sonnet3.5", "name": "Claude 3.5 Sonnet", "maxTokens": 200000},
-			{"id": "opus", "name": "Claude 3 Opus", "maxTokens": 200000},
-			{"id": "sonnet", "name": "Claude 3 Sonnet", "maxTokens": 200000},
-			{"id": "haiku", "name": "Claude 3 Haiku", "maxTokens": 200000},
-		}
-	case "openai":
-		capabilities["models"] = []map[string]interface{}{
-			{"id": "gpt-4", "name": "GPT-4", "maxTokens": 8192},
-			{"id": "gpt-3.5-turbo", "name": "GPT-3.5 Turbo", "maxTokens": 4096},
-		}
-	case "google":
-		capabilities["models"] = []map[string]interface{}{
-			{"id": "gemini-pro", "name": "Gemini Pro", "maxTokens": 32768},
-		}
-	case "deepseek":
-		capabilities["models"] = []map[string]interface{}{
-			{"id": "deepseek-coder", "name": "DeepSeek Coder", "maxTokens": 16384},
-		}
-	default:
-		capabilities["models"] = []map[string]interface{}{
-			{"id": "default", "name": "Default Model", "maxTokens": 4096},
-		}
+		"maxTokens":            spec.ContextWindow,
+		"supportsFunctions":    spec.SupportsTools,
+		"supportsVision":       spec.SupportsVision,
+		"context_window":       spec.ContextWindow,
+		"max_output_tokens":    spec.MaxOutputTokens,
+		"supports_thinking":    spec.SupportsThinking,
+		"temperature_range": map[string]float64{
+			"min": 0, "max": spec.MaxTemperature, "default": 0.7, "step": 0.1,
+		},
+		"top_k_range": nil,
+		"models":      specs,
+	}
+	if spec.SupportsTopK {
+		capabilities["top_k_range"] = map[string]int{"min": 1, "max": 500, "default": 40, "step": 1}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(capabilities)
-}
\ No newline at end of file
+}
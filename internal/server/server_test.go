@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gongzhen/codewhisper-go/pkg/config"
+)
+
+// newTestServer serves a codebase holding files, keyed by slash-separated
+// path, with an empty home directory
+func newTestServer(t *testing.T, files map[string]string) (*Server, string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv(config.EnvUserCodebaseDir, "")
+
+	target := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(target, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := config.Load(target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(0, store), target
+}
+
+// request sends a request to the server and decodes the JSON response
+// into out, when given
+func request(t *testing.T, s *Server, method, url, body string, out interface{}) int {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(method, url, reader))
+
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %v in %s", method, url, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+	"github.com/gongzhen/codewhisper-go/internal/watcher"
+)
+
+// folderChange describes one changed path. Path is relative to the codebase
+// directory and slash-separated, like the keys of /api/folders.
+type folderChange struct {
+	Path       string `json:"path"`
+	Op         string `json:"op"`
+	IsDir      bool   `json:"is_dir"`
+	TokenCount *int   `json:"token_count,omitempty"`
+}
+
+// folderEvent is sent to /api/folders/events subscribers. Type is "ready"
+// on connect, "changes" with a batch of changes, or "rescan" when the whole
+// tree should be fetched again.
+type folderEvent struct {
+	Type     string         `json:"type"`
+	Watching bool           `json:"watching,omitempty"`
+	Changes  []folderChange `json:"changes,omitempty"`
+}
+
+// subscriberBuffer is how many events a slow client may fall behind before
+// it is disconnected; it reconnects and refetches the tree
+const subscriberBuffer = 64
+
+// folderEvents fans watcher events out to SSE subscribers
+type folderEvents struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]struct{}
+}
+
+func newFolderEvents() *folderEvents {
+	return &folderEvents{subscribers: make(map[chan []byte]struct{})}
+}
+
+func (h *folderEvents) subscribe() chan []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan []byte, subscriberBuffer)
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (h *folderEvents) unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (h *folderEvents) publish(ev folderEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		utils.Log.Error("Failed to encode folder event: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- data:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// startWatcher watches the codebase directory and keeps the folder index
+// current. Watching is best effort; the UI still works without it.
+func (s *Server) startWatcher() {
+	cfg := s.config.Get()
+	dir := cfg.Target
+	tree := utils.WalkTree(dir, utils.WalkOptions{MaxDepth: -1, Exclude: cfg.Exclude})
+	w, err := watcher.New(tree, utils.ParseGitignorePatterns(tree.IgnorePatterns()))
+	if err != nil {
+		utils.Log.Warning("File watching disabled: %v", err)
+		return
+	}
+
+	s.watcher = w
+	go s.watchFolders(dir, w)
+	utils.Log.Info("Watching %s for changes", dir)
+}
+
+// watchFolders applies each batch of changes to the folder index and
+// publishes it. The code index is updated lazily on the next search.
+func (s *Server) watchFolders(dir string, w *watcher.Watcher) {
+	codeIndex := s.codeIndex()
+	for batch := range w.Events {
+		codeIndex.Invalidate()
+		rescan, ignoreChanged := false, false
+		changes := make([]folderChange, 0, len(batch))
+
+		for _, ev := range batch {
+			if ev.Op == watcher.Overflow {
+				rescan = true
+				continue
+			}
+			if filepath.Base(ev.Path) == ".gitignore" || ev.Path == filepath.Join(dir, ".git", "info", "exclude") {
+				// Which files are visible may have changed anywhere below
+				ignoreChanged = true
+				continue
+			}
+
+			rel, err := filepath.Rel(dir, ev.Path)
+			if err != nil {
+				continue
+			}
+			change := folderChange{Path: filepath.ToSlash(rel), Op: ev.Op.String(), IsDir: ev.IsDir}
+
+			switch {
+			case ev.Op == watcher.Removed:
+				s.folders.remove(ev.Path)
+			case !ev.IsDir:
+				tokens, ok := s.folders.update(ev.Path)
+				if !ok {
+					// Binary, image, or already gone again
+					continue
+				}
+				change.TokenCount = &tokens
+			}
+			changes = append(changes, change)
+		}
+
+		if ignoreChanged {
+			tree := utils.WalkTree(dir, utils.WalkOptions{MaxDepth: -1, Exclude: s.config.Get().Exclude})
+			w.SetIgnore(tree, utils.ParseGitignorePatterns(tree.IgnorePatterns()))
+			rescan = true
+		}
+		if rescan {
+			utils.Log.Info("Codebase changed, folder tree needs a rescan")
+			s.folderEvents.publish(folderEvent{Type: "rescan"})
+		} else if len(changes) > 0 {
+			utils.Log.Debug("Codebase changed: %d paths", len(changes))
+			s.folderEvents.publish(folderEvent{Type: "changes", Changes: changes})
+		}
+	}
+}
+
+// handleFolderEvents streams folder changes as server-sent events
+func (s *Server) handleFolderEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ch := s.folderEvents.subscribe()
+	defer s.folderEvents.unsubscribe(ch)
+
+	ready, _ := json.Marshal(folderEvent{Type: "ready", Watching: s.watcher != nil})
+	fmt.Fprintf(w, "data: %s\n\n", ready)
+	flusher.Flush()
+
+	// Comments keep proxies from closing an idle stream
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package tokenizer
+
+import "math"
+
+const noRank = math.MaxInt
+
+// maxPieceBytes bounds the quadratic merge loop. Longer pieces (minified
+// code, long runs of punctuation) are merged in chunks of this size.
+const maxPieceBytes = 4096
+
+// bytePairMerge splits piece into the token boundaries chosen by byte pair
+// encoding: repeatedly merge the adjacent pair whose concatenation has the
+// lowest rank. This is a port of tiktoken's _byte_pair_merge.
+func bytePairMerge(ranks map[string]int, piece string) []int {
+	type part struct {
+		start int
+		rank  int
+	}
+
+	rankOf := func(parts []part, i int) int {
+		if i+3 < len(parts) {
+			if rank, ok := ranks[piece[parts[i].start:parts[i+3].start]]; ok {
+				return rank
+			}
+		}
+		return noRank
+	}
+
+	parts := make([]part, 0, len(piece)+1)
+	minRank, minIndex := noRank, -1
+	for i := 0; i < len(piece)-1; i++ {
+		rank, ok := ranks[piece[i:i+2]]
+		if !ok {
+			rank = noRank
+		}
+		if rank < minRank {
+			minRank, minIndex = rank, i
+		}
+		parts = append(parts, part{start: i, rank: rank})
+	}
+	parts = append(parts, part{start: len(piece) - 1, rank: noRank}, part{start: len(piece), rank: noRank})
+
+	for minRank != noRank {
+		i := minIndex
+		if i > 0 {
+			parts[i-1].rank = rankOf(parts, i-1)
+		}
+		parts[i].rank = rankOf(parts, i)
+		parts = append(parts[:i+1], parts[i+2:]...)
+
+		minRank, minIndex = noRank, -1
+		for j := 0; j < len(parts)-1; j++ {
+			if parts[j].rank < minRank {
+				minRank, minIndex = parts[j].rank, j
+			}
+		}
+	}
+
+	bounds := make([]int, len(parts))
+	for i, p := range parts {
+		bounds[i] = p.start
+	}
+	return bounds
+}
+
+// encodePiece appends the token ranks of one pre-token to tokens
+func encodePiece(ranks map[string]int, piece string, tokens []int) []int {
+	if rank, ok := ranks[piece]; ok {
+		return append(tokens, rank)
+	}
+
+	for len(piece) > maxPieceBytes {
+		tokens = encodePiece(ranks, piece[:maxPieceBytes], tokens)
+		piece = piece[maxPieceBytes:]
+	}
+	if len(piece) == 1 {
+		return append(tokens, ranks[piece])
+	}
+
+	bounds := bytePairMerge(ranks, piece)
+	for i := 0; i+1 < len(bounds); i++ {
+		tokens = append(tokens, ranks[piece[bounds[i]:bounds[i+1]]])
+	}
+	return tokens
+}
+
+// countPiece returns how many tokens one pre-token encodes to
+func countPiece(ranks map[string]int, piece string) int {
+	if _, ok := ranks[piece]; ok || len(piece) == 1 {
+		return 1
+	}
+
+	count := 0
+	for len(piece) > maxPieceBytes {
+		count += countPiece(ranks, piece[:maxPieceBytes])
+		piece = piece[maxPieceBytes:]
+	}
+	if len(piece) == 1 {
+		return count + 1
+	}
+	return count + len(bytePairMerge(ranks, piece)) - 1
+}
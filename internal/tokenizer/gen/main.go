@@ -0,0 +1,119 @@
+// Command gen trains the embedded BPE vocabulary.
+//
+// Usage:
+//
+//	go run ./gen -o vocab/code.tiktoken.gz [corpus dirs...]
+//
+// With no directories it trains on the Go source tree in GOROOT, which
+// mixes code with plenty of English comments and documentation.
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gongzhen/codewhisper-go/internal/tokenizer"
+)
+
+// textExtensions are the files worth learning from
+var textExtensions = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true,
+	".java": true, ".c": true, ".h": true, ".cc": true, ".cpp": true, ".rs": true,
+	".rb": true, ".sh": true, ".s": true, ".html": true, ".css": true, ".json": true,
+	".yaml": true, ".yml": true, ".toml": true, ".xml": true, ".sql": true,
+	".md": true, ".txt": true, ".rst": true,
+}
+
+var skipDirs = map[string]bool{
+	".git": true, "node_modules": true, "vendor": true, "testdata": true, "__pycache__": true,
+}
+
+func main() {
+	out := flag.String("o", "vocab/code.tiktoken.gz", "output file (gzip-compressed tiktoken format)")
+	size := flag.Int("size", 50000, "vocabulary size including the 256 byte tokens")
+	minCount := flag.Int64("min", 2, "ignore pre-tokens seen fewer times than this")
+	maxFile := flag.Int64("max-file", 512*1024, "skip files larger than this many bytes")
+	encoding := flag.String("encoding", tokenizer.CL100K, "pre-tokenizer to train with")
+	flag.Parse()
+
+	dirs := flag.Args()
+	if len(dirs) == 0 {
+		dirs = []string{filepath.Join(runtime.GOROOT(), "src")}
+	}
+
+	trainer, err := tokenizer.NewTrainer(*encoding)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var files, total int64
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if skipDirs[d.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !textExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || info.Size() > *maxFile {
+				return nil
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil || !utf8.Valid(data) {
+				return nil
+			}
+			trainer.Add(string(data))
+			files++
+			total += int64(len(data))
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("read %d files (%d MB), %d distinct pre-tokens", files, total>>20, trainer.Pieces())
+
+	tokens := trainer.Train(*size, *minCount)
+	log.Printf("trained %d tokens", len(tokens))
+
+	if err := write(*out, tokens); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// write saves the vocabulary gzip-compressed
+func write(path string, tokens [][]byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if err := tokenizer.WriteVocab(zw, tokens); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,264 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// The pre-tokenizers below split text the way tiktoken's regular expressions
+// do. Go's regexp package has no lookahead, so each pattern is hand-written
+// with the same alternation order and backtracking behavior.
+//
+// cl100k_base:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// o200k_base:
+//
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+
+// splitFunc calls emit with each pre-token of text, in order
+type splitFunc func(text string, emit func(piece string))
+
+// runeAt decodes the rune at byte offset i, returning utf8.RuneError and 0
+// at the end of text
+func runeAt(text string, i int) (rune, int) {
+	if i >= len(text) {
+		return utf8.RuneError, 0
+	}
+	return utf8.DecodeRuneInString(text[i:])
+}
+
+func isNewline(r rune) bool { return r == '\r' || r == '\n' }
+
+// isPrefixRune matches [^\r\n\p{L}\p{N}]
+func isPrefixRune(r rune) bool {
+	return !isNewline(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// isPunct matches [^\s\p{L}\p{N}]
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// isUpperish matches [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]
+func isUpperish(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// isLowerish matches [\p{Ll}\p{Lm}\p{Lo}\p{M}]
+func isLowerish(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// span returns the end of the run of runes matching class that starts at i
+func span(text string, i int, class func(rune) bool) int {
+	for i < len(text) {
+		r, size := runeAt(text, i)
+		if !class(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// contraction matches (?i:'s|'t|'re|'ve|'m|'ll|'d) at i and returns its end,
+// or i when there is none
+func contraction(text string, i int) int {
+	if i >= len(text) || text[i] != '\'' {
+		return i
+	}
+	lower := func(j int) byte {
+		if j >= len(text) {
+			return 0
+		}
+		c := text[j]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		return c
+	}
+	switch lower(i + 1) {
+	case 's', 't', 'm', 'd':
+		return i + 2
+	case 'r', 'v':
+		if lower(i+2) == 'e' {
+			return i + 3
+		}
+	case 'l':
+		if lower(i+2) == 'l' {
+			return i + 3
+		}
+	}
+	return i
+}
+
+// digits matches \p{N}{1,3}
+func digits(text string, i int) int {
+	end := i
+	for n := 0; n < 3; n++ {
+		r, size := runeAt(text, end)
+		if size == 0 || !unicode.IsNumber(r) {
+			break
+		}
+		end += size
+	}
+	return end
+}
+
+// punctuation matches ` ?[^\s\p{L}\p{N}]+` followed by any runes in trail
+func punctuation(text string, i int, trail func(rune) bool) int {
+	start := i
+	if text[i] == ' ' {
+		if r, _ := runeAt(text, i+1); isPunct(r) {
+			start = i + 1
+		}
+	}
+	end := span(text, start, isPunct)
+	if end == start {
+		return i
+	}
+	return span(text, end, trail)
+}
+
+// whitespace matches \s*[\r\n]+|\s+(?!\S)|\s+ at i, which must be a space
+func whitespace(text string, i int) int {
+	end := span(text, i, unicode.IsSpace)
+
+	// \s*[\r\n]+ backtracks to the last newline in the run
+	lastNewline := -1
+	for j := i; j < end; {
+		r, size := runeAt(text, j)
+		if isNewline(r) {
+			lastNewline = j + size
+		}
+		j += size
+	}
+	if lastNewline != -1 {
+		return lastNewline
+	}
+
+	// \s+(?!\S) leaves the last space to prefix the next word
+	if end < len(text) {
+		_, size := utf8.DecodeLastRuneInString(text[i:end])
+		if end-size > i {
+			return end - size
+		}
+	}
+	return end
+}
+
+// splitCL100K pre-tokenizes text with the cl100k_base pattern
+func splitCL100K(text string, emit func(string)) {
+	for i := 0; i < len(text); {
+		end := nextCL100K(text, i)
+		emit(text[i:end])
+		i = end
+	}
+}
+
+func nextCL100K(text string, i int) int {
+	if end := contraction(text, i); end > i {
+		return end
+	}
+
+	r, size := runeAt(text, i)
+
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	if isPrefixRune(r) {
+		if next, _ := runeAt(text, i+size); unicode.IsLetter(next) {
+			return span(text, i+size, unicode.IsLetter)
+		}
+	}
+	if unicode.IsLetter(r) {
+		return span(text, i, unicode.IsLetter)
+	}
+
+	if unicode.IsNumber(r) {
+		return digits(text, i)
+	}
+
+	if end := punctuation(text, i, isNewline); end > i {
+		return end
+	}
+
+	if unicode.IsSpace(r) {
+		return whitespace(text, i)
+	}
+
+	// Unreachable for valid classes, but never stall on odd input
+	return i + size
+}
+
+// splitO200K pre-tokenizes text with the o200k_base pattern, which also
+// splits words at case changes
+func splitO200K(text string, emit func(string)) {
+	for i := 0; i < len(text); {
+		end := nextO200K(text, i)
+		emit(text[i:end])
+		i = end
+	}
+}
+
+func nextO200K(text string, i int) int {
+	r, size := runeAt(text, i)
+
+	// Both word alternatives may start with one non-letter prefix rune
+	starts := []int{i}
+	if isPrefixRune(r) {
+		starts = []int{i + size, i}
+	}
+
+	// [^\r\n\p{L}\p{N}]?[upper]*[lower]+(contraction)?
+	for _, start := range starts {
+		if end := upperThenLower(text, start); end > start {
+			return contraction(text, end)
+		}
+	}
+
+	// [^\r\n\p{L}\p{N}]?[upper]+[lower]*(contraction)?
+	for _, start := range starts {
+		if end := span(text, start, isUpperish); end > start {
+			return contraction(text, span(text, end, isLowerish))
+		}
+	}
+
+	if unicode.IsNumber(r) {
+		return digits(text, i)
+	}
+
+	if end := punctuation(text, i, func(r rune) bool { return isNewline(r) || r == '/' }); end > i {
+		return end
+	}
+
+	if unicode.IsSpace(r) {
+		return whitespace(text, i)
+	}
+
+	return i + size
+}
+
+// upperThenLower matches [upper]*[lower]+ at i, backtracking the greedy
+// upper run until at least one lower rune follows. It returns i on failure.
+func upperThenLower(text string, i int) int {
+	var bounds []int
+	for j := i; ; {
+		bounds = append(bounds, j)
+		r, size := runeAt(text, j)
+		if size == 0 || !isUpperish(r) {
+			break
+		}
+		j += size
+	}
+
+	for k := len(bounds) - 1; k >= 0; k-- {
+		if end := span(text, bounds[k], isLowerish); end > bounds[k] {
+			return end
+		}
+	}
+	return i
+}
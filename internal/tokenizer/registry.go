@@ -0,0 +1,215 @@
+package tokenizer
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//go:generate go run ./gen -o vocab/code.tiktoken.gz
+
+// Encoding names. CL100K and O200K are tiktoken's and need their
+// vocabulary files on disk (see Configure); Code is always available.
+const (
+	CL100K = "cl100k_base"
+	O200K  = "o200k_base"
+	// Code is the embedded vocabulary. Its counts approximate cl100k_base's
+	// for source code but are not the same.
+	Code = "code"
+)
+
+// embeddedVocab is a byte-level BPE vocabulary trained by ./gen on source
+// code and English text with the cl100k_base pre-tokenizer, so counting
+// works offline with nothing installed. OpenAI's own vocabularies aren't
+// bundled.
+//
+//go:embed vocab/code.tiktoken.gz
+var embeddedVocab []byte
+
+var splitters = map[string]splitFunc{
+	CL100K: splitCL100K,
+	O200K:  splitO200K,
+	Code:   splitCL100K,
+}
+
+var (
+	mu      sync.Mutex
+	loaded  = make(map[string]*Tokenizer)
+	current atomic.Pointer[Tokenizer]
+
+	// Set by Configure, guarded by mu
+	configuredDir string
+	override      string
+
+	embeddedOnce  sync.Once
+	embeddedRanks map[string]int
+	embeddedErr   error
+)
+
+// Configure sets the directory tiktoken vocabulary files such as
+// cl100k_base.tiktoken are read from, empty for ~/.codewhisper/tokenizers,
+// and the encoding ForModel returns for every model, empty to choose by
+// model. Tokenizers already loaded are dropped.
+func Configure(dir, encoding string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	configuredDir, override = dir, encoding
+	loaded = make(map[string]*Tokenizer)
+	current.Store(nil)
+}
+
+// vocabDir is where vocabulary files are looked up. The caller holds mu.
+func vocabDir() string {
+	if configuredDir != "" {
+		return configuredDir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".codewhisper", "tokenizers")
+}
+
+// Get returns the tokenizer for an encoding. OpenAI's encodings are read
+// from <name>.tiktoken in the vocabulary directory, and fail when it isn't
+// there.
+func Get(name string) (*Tokenizer, error) {
+	split, ok := splitters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tokenizer encoding: %s", name)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if t, ok := loaded[name]; ok {
+		return t, nil
+	}
+
+	load := loadVocabFile
+	if name == Code {
+		load = func(string) (map[string]int, error) { return loadEmbedded() }
+	}
+	ranks, err := load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tokenizer{name: name, ranks: ranks, split: split}
+	loaded[name] = t
+	return t, nil
+}
+
+// loadVocabFile reads <name>.tiktoken from the vocabulary directory
+func loadVocabFile(name string) (map[string]int, error) {
+	dir := vocabDir()
+	if dir == "" {
+		return nil, os.ErrNotExist
+	}
+
+	path := filepath.Join(dir, name+".tiktoken")
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("no %s vocabulary: %w", name, err)
+	}
+	defer f.Close()
+
+	ranks, err := parseRanks(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return ranks, nil
+}
+
+// loadEmbedded decompresses the embedded vocabulary once
+func loadEmbedded() (map[string]int, error) {
+	embeddedOnce.Do(func() {
+		zr, err := gzip.NewReader(bytes.NewReader(embeddedVocab))
+		if err != nil {
+			embeddedErr = fmt.Errorf("embedded vocabulary is corrupt: %w", err)
+			return
+		}
+		defer zr.Close()
+		embeddedRanks, embeddedErr = parseRanks(zr)
+	})
+	return embeddedRanks, embeddedErr
+}
+
+// Default returns the tokenizer used by Count: cl100k_base if its
+// vocabulary is on disk, else the embedded one, unless changed with
+// SetDefault
+func Default() *Tokenizer {
+	if t := current.Load(); t != nil {
+		return t
+	}
+
+	t, err := Get(Available(CL100K))
+	if err != nil {
+		t = fallback()
+	}
+	current.CompareAndSwap(nil, t)
+	return current.Load()
+}
+
+// fallback returns a tokenizer that works whatever is on disk: the embedded
+// vocabulary, or one token per byte if even that can't be read
+func fallback() *Tokenizer {
+	ranks, err := loadEmbedded()
+	if err != nil {
+		ranks = map[string]int{}
+	}
+	return &Tokenizer{name: Code, ranks: ranks, split: splitCL100K}
+}
+
+// Available returns name if its vocabulary can be loaded, and Code
+// otherwise
+func Available(name string) string {
+	if _, err := Get(name); err != nil {
+		return Code
+	}
+	return name
+}
+
+// SetDefault makes the named encoding the one used by Count
+func SetDefault(name string) error {
+	t, err := Get(name)
+	if err != nil {
+		return err
+	}
+	current.Store(t)
+	return nil
+}
+
+// Count returns the number of tokens in text with the default tokenizer
+func Count(text string) int {
+	return Default().Count(text)
+}
+
+// ForModel returns the encoding to count tokens for a provider's model.
+// An encoding given to Configure overrides the choice. Providers without a
+// public tokenizer (Claude, Gemini) are counted with cl100k_base, which is
+// close for code. Without the encoding's vocabulary on disk, it is Code.
+func ForModel(endpoint, modelID string) string {
+	mu.Lock()
+	name := override
+	mu.Unlock()
+	if name != "" {
+		return name
+	}
+
+	if endpoint == "openai" {
+		for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4"} {
+			if strings.HasPrefix(modelID, prefix) {
+				return Available(O200K)
+			}
+		}
+	}
+	return Available(CL100K)
+}
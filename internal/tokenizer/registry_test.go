@@ -0,0 +1,94 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useVocabDir points the registry at dir for the rest of the test
+func useVocabDir(t *testing.T, dir string) {
+	t.Helper()
+	Configure(dir, "")
+	t.Cleanup(func() { Configure("", "") })
+}
+
+// writeVocab writes a vocabulary of the 256 bytes plus merged tokens
+func writeVocab(t *testing.T, path string, merged ...string) {
+	t.Helper()
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, token := range merged {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), 256+i)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmbeddedVocabularyIsNamedCode(t *testing.T) {
+	useVocabDir(t, t.TempDir())
+
+	for _, name := range []string{CL100K, O200K} {
+		if _, err := Get(name); err == nil {
+			t.Errorf("Get(%s) succeeded without its vocabulary", name)
+		}
+	}
+	for _, model := range [][2]string{{"openai", "gpt-4o"}, {"openai", "gpt-4-turbo"}, {"anthropic", "claude-3-5-sonnet-20241022"}} {
+		if got := ForModel(model[0], model[1]); got != Code {
+			t.Errorf("ForModel(%s, %s) = %s, want %s", model[0], model[1], got, Code)
+		}
+	}
+
+	if got := Default().Name(); got != Code {
+		t.Errorf("Default().Name() = %s, want %s", got, Code)
+	}
+	if n := Count("func main() {}"); n <= 0 || n >= len("func main() {}") {
+		t.Errorf("Count = %d, want merged tokens", n)
+	}
+}
+
+func TestVocabularyOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	useVocabDir(t, dir)
+	writeVocab(t, filepath.Join(dir, CL100K+".tiktoken"), "he", "ll", "hell", "hello")
+
+	if got := ForModel("anthropic", "claude-3-5-sonnet-20241022"); got != CL100K {
+		t.Errorf("ForModel(anthropic) = %s, want %s", got, CL100K)
+	}
+	// o200k_base isn't on disk
+	if got := ForModel("openai", "gpt-4o"); got != Code {
+		t.Errorf("ForModel(openai, gpt-4o) = %s, want %s", got, Code)
+	}
+
+	tk, err := Get(CL100K)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tk.Name() != CL100K {
+		t.Errorf("Name() = %s, want %s", tk.Name(), CL100K)
+	}
+	if got := tk.Encode("hello"); len(got) != 1 || got[0] != 259 {
+		t.Errorf("Encode(hello) = %v, want [259]", got)
+	}
+
+	if err := SetDefault(CL100K); err != nil || Default() != tk {
+		t.Errorf("SetDefault(%s) = %v", CL100K, err)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	useVocabDir(t, t.TempDir())
+	Configure(t.TempDir(), Code)
+	if got := ForModel("openai", "gpt-4o"); got != Code {
+		t.Errorf("ForModel = %s, want %s", got, Code)
+	}
+	if _, err := Get("p50k_base"); err == nil {
+		t.Error("Get of an unknown encoding succeeded")
+	}
+}
@@ -0,0 +1,82 @@
+// Package tokenizer counts tokens offline with byte pair encoding, using the
+// same pre-tokenization and merge rules as OpenAI's tiktoken.
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Tokenizer is a byte pair encoding with its pre-tokenizer
+type Tokenizer struct {
+	name  string
+	ranks map[string]int
+	split splitFunc
+}
+
+// Name returns the encoding name
+func (t *Tokenizer) Name() string {
+	return t.name
+}
+
+// Count returns the number of tokens text encodes to
+func (t *Tokenizer) Count(text string) int {
+	count := 0
+	t.split(text, func(piece string) {
+		count += countPiece(t.ranks, piece)
+	})
+	return count
+}
+
+// Encode returns the token ranks of text
+func (t *Tokenizer) Encode(text string) []int {
+	var tokens []int
+	t.split(text, func(piece string) {
+		tokens = encodePiece(t.ranks, piece, tokens)
+	})
+	return tokens
+}
+
+// parseRanks reads a vocabulary in tiktoken's format: one base64 token and
+// its rank per line. Every single byte must have a rank so any input encodes.
+func parseRanks(r io.Reader) (map[string]int, error) {
+	ranks := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected token and rank", lineNum)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid token: %w", lineNum, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rank: %w", lineNum, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("vocabulary has no token for byte 0x%02x", b)
+		}
+	}
+	return ranks, nil
+}
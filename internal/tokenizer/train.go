@@ -0,0 +1,208 @@
+package tokenizer
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Trainer learns a byte pair encoding from pre-token frequencies. Feed it
+// text with Add, then call Train.
+type Trainer struct {
+	split  splitFunc
+	counts map[string]int64
+}
+
+// NewTrainer creates a trainer that pre-tokenizes with the given encoding
+func NewTrainer(encoding string) (*Trainer, error) {
+	split, ok := splitters[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unknown tokenizer encoding: %s", encoding)
+	}
+	return &Trainer{split: split, counts: make(map[string]int64)}, nil
+}
+
+// Add counts the pre-tokens of text
+func (t *Trainer) Add(text string) {
+	t.split(text, func(piece string) {
+		t.counts[piece]++
+	})
+}
+
+// Pieces returns how many distinct pre-tokens have been seen
+func (t *Trainer) Pieces() int {
+	return len(t.counts)
+}
+
+type symbolPair [2]int32
+
+type pairItem struct {
+	pair  symbolPair
+	count int64
+}
+
+// pairHeap orders pairs by count, breaking ties by pair for reproducible output
+type pairHeap []pairItem
+
+func (h pairHeap) Len() int { return len(h) }
+func (h pairHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count > h[j].count
+	}
+	if h[i].pair[0] != h[j].pair[0] {
+		return h[i].pair[0] < h[j].pair[0]
+	}
+	return h[i].pair[1] < h[j].pair[1]
+}
+func (h pairHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *pairHeap) Push(x any)   { *h = append(*h, x.(pairItem)) }
+func (h *pairHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// Train returns vocabSize tokens in rank order: the 256 single bytes, then
+// one token per merge. Pre-tokens seen fewer than minCount times are ignored.
+func (t *Trainer) Train(vocabSize int, minCount int64) [][]byte {
+	tokens := make([][]byte, 0, vocabSize)
+	ids := make(map[string]int32, vocabSize)
+	for b := 0; b < 256; b++ {
+		tokens = append(tokens, []byte{byte(b)})
+		ids[string([]byte{byte(b)})] = int32(b)
+	}
+
+	// Sort pieces so training doesn't depend on map order
+	pieces := make([]string, 0, len(t.counts))
+	for piece, count := range t.counts {
+		if count >= minCount && len(piece) > 1 {
+			pieces = append(pieces, piece)
+		}
+	}
+	sort.Strings(pieces)
+
+	words := make([][]int32, len(pieces))
+	freqs := make([]int64, len(pieces))
+	pairCounts := make(map[symbolPair]int64)
+	where := make(map[symbolPair][]int32)
+	for w, piece := range pieces {
+		symbols := make([]int32, len(piece))
+		for i := 0; i < len(piece); i++ {
+			symbols[i] = int32(piece[i])
+		}
+		words[w] = symbols
+		freqs[w] = t.counts[piece]
+		for i := 0; i+1 < len(symbols); i++ {
+			pair := symbolPair{symbols[i], symbols[i+1]}
+			pairCounts[pair] += freqs[w]
+			where[pair] = append(where[pair], int32(w))
+		}
+	}
+
+	h := make(pairHeap, 0, len(pairCounts))
+	for pair, count := range pairCounts {
+		h = append(h, pairItem{pair: pair, count: count})
+	}
+	heap.Init(&h)
+
+	// seen marks words already rewritten for the current merge, since where
+	// lists may repeat a word
+	seen := make([]int, len(words))
+	for merge := 1; len(tokens) < vocabSize && h.Len() > 0; merge++ {
+		item := heap.Pop(&h).(pairItem)
+		if current := pairCounts[item.pair]; current != item.count {
+			// Stale entry; requeue with the live count
+			if current > 0 {
+				heap.Push(&h, pairItem{pair: item.pair, count: current})
+			}
+			merge--
+			continue
+		}
+		if item.count <= 0 {
+			break
+		}
+
+		a, b := item.pair[0], item.pair[1]
+		merged := append(append([]byte{}, tokens[a]...), tokens[b]...)
+		id, exists := ids[string(merged)]
+		if !exists {
+			id = int32(len(tokens))
+			tokens = append(tokens, merged)
+			ids[string(merged)] = id
+		}
+
+		touched := make(map[symbolPair]bool)
+		for _, w := range where[item.pair] {
+			if seen[w] == merge {
+				continue
+			}
+			seen[w] = merge
+
+			symbols, freq := words[w], freqs[w]
+			out := symbols[:0:0]
+			justMerged := false
+			for i := 0; i < len(symbols); i++ {
+				if i+1 < len(symbols) && symbols[i] == a && symbols[i+1] == b {
+					if len(out) > 0 {
+						prev := out[len(out)-1]
+						// After a merge the left pair was already removed as
+						// that merge's right neighbor
+						if !justMerged {
+							pairCounts[symbolPair{prev, a}] -= freq
+							touched[symbolPair{prev, a}] = true
+						}
+						pairCounts[symbolPair{prev, id}] += freq
+						where[symbolPair{prev, id}] = append(where[symbolPair{prev, id}], w)
+						touched[symbolPair{prev, id}] = true
+					}
+					if i+2 < len(symbols) {
+						// The pair with the following symbol is added back when
+						// that symbol is appended
+						pairCounts[symbolPair{b, symbols[i+2]}] -= freq
+						touched[symbolPair{b, symbols[i+2]}] = true
+					}
+					pairCounts[item.pair] -= freq
+					out = append(out, id)
+					justMerged = true
+					i++
+					continue
+				}
+				if justMerged {
+					pairCounts[symbolPair{id, symbols[i]}] += freq
+					where[symbolPair{id, symbols[i]}] = append(where[symbolPair{id, symbols[i]}], w)
+					touched[symbolPair{id, symbols[i]}] = true
+				}
+				out = append(out, symbols[i])
+				justMerged = false
+			}
+			words[w] = out
+		}
+		delete(where, item.pair)
+		delete(pairCounts, item.pair)
+
+		for pair := range touched {
+			if count := pairCounts[pair]; count > 0 {
+				heap.Push(&h, pairItem{pair: pair, count: count})
+			} else {
+				delete(pairCounts, pair)
+			}
+		}
+	}
+
+	return tokens
+}
+
+// WriteVocab writes tokens in tiktoken's format, ranked by position
+func WriteVocab(w io.Writer, tokens [][]byte) error {
+	bw := bufio.NewWriter(w)
+	for rank, token := range tokens {
+		if _, err := fmt.Fprintf(bw, "%s %d\n", base64.StdEncoding.EncodeToString(token), rank); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
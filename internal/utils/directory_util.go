@@ -1,111 +1,67 @@
 package utils
 
 import (
-	"os"
+	"io/fs"
 	"path/filepath"
 	"strings"
-
-	"github.com/gongzhen/codewhisper-go/pkg/config"
 )
 
-// GetIgnoredPatterns returns all patterns that should be ignored
-func GetIgnoredPatterns(directory string) []PatternSource {
-    patterns := []PatternSource{
+// GetIgnoredPatterns returns all patterns that should be ignored, lowest
+// precedence first as the matcher expects: built-in defaults, the user's
+// core.excludesFile, .git/info/exclude, the .gitignore files, then --exclude.
+// .gitignore files inside ignored directories don't apply and aren't read.
+// exclude is as for WalkOptions.Exclude.
+func GetIgnoredPatterns(directory string, exclude []string) []PatternSource {
+    return WalkTree(directory, WalkOptions{MaxDepth: -1, Exclude: exclude}).IgnorePatterns()
+}
+
+// baseIgnorePatterns returns the patterns that don't come from .gitignore
+// files: those below them and those overriding them
+func baseIgnorePatterns(directory string, exclude []string) (low, high []PatternSource) {
+    low = []PatternSource{
         {Pattern: "poetry.lock", BaseDir: directory},
         {Pattern: "package-lock.json", BaseDir: directory},
         {Pattern: ".DS_Store", BaseDir: directory},
         {Pattern: ".git", BaseDir: directory},
     }
     
-    // Add additional patterns from environment
-    additionalExclude := config.GetEnv(config.EnvAdditionalExcludeDirs, "")
-    if additionalExclude != "" {
-        excludeList := strings.Split(additionalExclude, ",")
-        for _, pattern := range excludeList {
-            pattern = strings.TrimSpace(pattern)
-            if pattern != "" {
-                patterns = append(patterns, PatternSource{
-                    Pattern: pattern,
-                    BaseDir: directory,
-                })
-            }
-        }
-    }
-    
-    // Recursively read .gitignore files
-    patterns = append(patterns, getGitignorePatternsRecursive(directory)...)
-    
-    return patterns
-}
-
-// getGitignorePatternsRecursive recursively finds and reads .gitignore files
-func getGitignorePatternsRecursive(dir string) []PatternSource {
-    var allPatterns []PatternSource
-    
-    // Read .gitignore in current directory
-    gitignorePath := filepath.Join(dir, ".gitignore")
-    if patterns, err := ReadGitignoreFile(gitignorePath); err == nil {
-        allPatterns = append(allPatterns, patterns...)
-    }
-    
-    // Walk subdirectories
-    entries, err := os.ReadDir(dir)
-    if err != nil {
-        return allPatterns
-    }
+    low = append(low, gitExcludePatterns(directory)...)
     
-    for _, entry := range entries {
-        if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
-            subdir := filepath.Join(dir, entry.Name())
-            allPatterns = append(allPatterns, getGitignorePatternsRecursive(subdir)...)
+    // Like git's command-line excludes, the configured ones override
+    // everything else
+    for _, pattern := range exclude {
+        pattern = strings.TrimSpace(pattern)
+        if pattern != "" {
+            high = append(high, PatternSource{
+                Pattern: pattern,
+                BaseDir: directory,
+            })
         }
     }
     
-    return allPatterns
+    return low, high
 }
 
 // GetCompleteFileList returns all files in the given directories, respecting ignore patterns
-func GetCompleteFileList(baseDir string, ignoredPatterns []PatternSource, includedDirs []string) map[string]struct{} {
-    shouldIgnore := ParseGitignorePatterns(ignoredPatterns)
+func GetCompleteFileList(baseDir string, includedDirs, exclude []string) map[string]struct{} {
     fileMap := make(map[string]struct{})
     
-    for _, relDir := range includedDirs {
-        startPath := filepath.Join(baseDir, relDir)
-        
-        err := filepath.Walk(startPath, func(path string, info os.FileInfo, err error) error {
-            if err != nil {
-                return nil // Skip errors
-            }
-            
-            // Skip hidden files and directories
-            if strings.HasPrefix(filepath.Base(path), ".") {
-                if info.IsDir() {
-                    return filepath.SkipDir
-                }
-                return nil
-            }
-            
-            // Check if should be ignored
-            if shouldIgnore(path) {
-                if info.IsDir() {
-                    return filepath.SkipDir
-                }
-                return nil
-            }
-            
+    tree := WalkTree(baseDir, WalkOptions{
+        MaxDepth: -1,
+        Exclude:  exclude,
+        Visit: func(path string, entry fs.DirEntry) bool {
             // Skip image files
-            if !info.IsDir() && IsImageFile(path) {
-                return nil
+            return !IsImageFile(path)
+        },
+    })
+    
+    for _, path := range tree.Files() {
+        for _, relDir := range includedDirs {
+            startPath := filepath.Join(baseDir, relDir)
+            if path == startPath || strings.HasPrefix(path, startPath+string(filepath.Separator)) {
+                fileMap[path] = struct{}{}
+                break
             }
-            
-            // Add to map
-            fileMap[path] = struct{}{}
-            
-            return nil
-        })
-        
-        if err != nil {
-            Log.Warning("Error walking directory %s: %v", startPath, err)
         }
     }
     
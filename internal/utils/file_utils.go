@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -85,4 +86,57 @@ func IsImageFile(filePath string) bool {
         }
     }
     return false
-}
\ No newline at end of file
+}
+
+// SafeJoin joins relPath onto baseDir and returns an absolute path, rejecting
+// any path (including through symlinks) that would escape baseDir
+func SafeJoin(baseDir, relPath string) (string, error) {
+    absBase, err := filepath.Abs(baseDir)
+    if err != nil {
+        return "", fmt.Errorf("invalid base directory: %w", err)
+    }
+    
+    candidate := filepath.Clean(relPath)
+    if !filepath.IsAbs(candidate) {
+        candidate = filepath.Join(absBase, candidate)
+    }
+    
+    if !isWithin(absBase, candidate) {
+        return "", fmt.Errorf("path outside base directory: %s", relPath)
+    }
+    
+    // Resolve symlinks on the deepest existing ancestor, the rest may not exist yet
+    realBase, err := filepath.EvalSymlinks(absBase)
+    if err != nil {
+        return "", fmt.Errorf("invalid base directory: %w", err)
+    }
+    existing := candidate
+    for {
+        if _, err := os.Lstat(existing); err == nil {
+            break
+        }
+        parent := filepath.Dir(existing)
+        if parent == existing {
+            break
+        }
+        existing = parent
+    }
+    realExisting, err := filepath.EvalSymlinks(existing)
+    if err != nil {
+        return "", fmt.Errorf("cannot resolve path %s: %w", relPath, err)
+    }
+    if !isWithin(realBase, realExisting) {
+        return "", fmt.Errorf("path outside base directory: %s", relPath)
+    }
+    
+    return candidate, nil
+}
+
+// isWithin reports whether path is dir or inside it
+func isWithin(dir, path string) bool {
+    rel, err := filepath.Rel(dir, path)
+    if err != nil {
+        return false
+    }
+    return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"a.txt", true},
+		{"sub/a.txt", true},
+		{"sub/../a.txt", true},
+		{"new/dir/a.txt", true},
+		{filepath.Join(root, "abs.txt"), true},
+		{"../a.txt", false},
+		{"sub/../../a.txt", false},
+		{"..", false},
+		{filepath.Join(outside, "a.txt"), false},
+		{"link/a.txt", false},
+		{"link/new/a.txt", false},
+	}
+
+	for _, tt := range tests {
+		got, err := SafeJoin(root, tt.path)
+		if tt.ok && err != nil {
+			t.Errorf("SafeJoin(%q) = %v, want a path inside the root", tt.path, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("SafeJoin(%q) = %q, want an error", tt.path, got)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// findGitRepo returns the work tree root containing dir and the directory
+// holding its shared git files, or ok false outside a repository
+func findGitRepo(dir string) (root, commonDir string, ok bool) {
+    for d := normalizePath(dir); ; d = filepath.Dir(d) {
+        dotGit := filepath.Join(d, ".git")
+        if info, err := os.Stat(dotGit); err == nil {
+            gitDir := dotGit
+            if !info.IsDir() {
+                // Worktrees and submodules have a .git file pointing at the git directory
+                gitDir = readGitDirFile(dotGit, d)
+                if gitDir == "" {
+                    return "", "", false
+                }
+            }
+            return d, gitCommonDir(gitDir), true
+        }
+
+        if filepath.Dir(d) == d {
+            return "", "", false
+        }
+    }
+}
+
+// readGitDirFile reads the "gitdir: <path>" line of a .git file
+func readGitDirFile(path, workTree string) string {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return ""
+    }
+
+    line := strings.TrimSpace(string(data))
+    if !strings.HasPrefix(line, "gitdir:") {
+        return ""
+    }
+    gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+    if !filepath.IsAbs(gitDir) {
+        gitDir = filepath.Join(workTree, gitDir)
+    }
+    return gitDir
+}
+
+// gitCommonDir follows a worktree's commondir file to the main git
+// directory, where info/exclude and config live
+func gitCommonDir(gitDir string) string {
+    data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+    if err != nil {
+        return gitDir
+    }
+
+    common := strings.TrimSpace(string(data))
+    if !filepath.IsAbs(common) {
+        common = filepath.Join(gitDir, common)
+    }
+    return filepath.Clean(common)
+}
+
+// gitExcludePatterns returns the patterns git applies below every
+// .gitignore: the user's core.excludesFile, then the repository's
+// .git/info/exclude
+func gitExcludePatterns(directory string) []PatternSource {
+    root, commonDir, inRepo := findGitRepo(directory)
+    if !inRepo {
+        root = directory
+    }
+
+    var patterns []PatternSource
+    if path := gitExcludesFile(commonDir); path != "" {
+        if ps, err := readIgnoreFile(path, root); err == nil {
+            patterns = append(patterns, ps...)
+        }
+    }
+    if inRepo {
+        if ps, err := readIgnoreFile(filepath.Join(commonDir, "info", "exclude"), root); err == nil {
+            patterns = append(patterns, ps...)
+        }
+    }
+    return patterns
+}
+
+// gitExcludesFile returns the path of core.excludesFile. The repository's
+// config overrides the global ones; when unset, git's default
+// $XDG_CONFIG_HOME/git/ignore is used.
+func gitExcludesFile(commonDir string) string {
+    home, _ := os.UserHomeDir()
+    xdgConfig := os.Getenv("XDG_CONFIG_HOME")
+    if xdgConfig == "" && home != "" {
+        xdgConfig = filepath.Join(home, ".config")
+    }
+
+    var configs []string
+    if commonDir != "" {
+        configs = append(configs, filepath.Join(commonDir, "config"))
+    }
+    if home != "" {
+        configs = append(configs, filepath.Join(home, ".gitconfig"))
+    }
+    if xdgConfig != "" {
+        configs = append(configs, filepath.Join(xdgConfig, "git", "config"))
+    }
+
+    for _, cfg := range configs {
+        if value, ok := readGitConfigValue(cfg, "core", "excludesfile"); ok {
+            if value == "~" || strings.HasPrefix(value, "~/") {
+                value = filepath.Join(home, value[1:])
+            }
+            return value
+        }
+    }
+
+    if xdgConfig == "" {
+        return ""
+    }
+    return filepath.Join(xdgConfig, "git", "ignore")
+}
+
+// readGitConfigValue returns the last value of section.key in a git config
+// file. Section and key names are case-insensitive; includes and
+// subsections are not supported.
+func readGitConfigValue(path, section, key string) (string, bool) {
+    file, err := os.Open(path)
+    if err != nil {
+        return "", false
+    }
+    defer file.Close()
+
+    value, found := "", false
+    inSection := false
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || line[0] == '#' || line[0] == ';' {
+            continue
+        }
+
+        if line[0] == '[' {
+            end := strings.IndexByte(line, ']')
+            if end < 0 {
+                continue
+            }
+            inSection = strings.EqualFold(strings.TrimSpace(line[1:end]), section)
+            line = strings.TrimSpace(line[end+1:])
+            if line == "" {
+                continue
+            }
+        }
+        if !inSection {
+            continue
+        }
+
+        name, raw, hasValue := strings.Cut(line, "=")
+        if !hasValue || !strings.EqualFold(strings.TrimSpace(name), key) {
+            continue
+        }
+        value, found = parseGitConfigValue(raw), true
+    }
+
+    return value, found
+}
+
+// parseGitConfigValue unquotes a config value and strips trailing comments
+func parseGitConfigValue(raw string) string {
+    var b strings.Builder
+    quoted := false
+    for i := 0; i < len(raw); i++ {
+        c := raw[i]
+        switch {
+        case c == '"':
+            quoted = !quoted
+        case c == '\\' && i+1 < len(raw):
+            i++
+            switch raw[i] {
+            case 'n':
+                b.WriteByte('\n')
+            case 't':
+                b.WriteByte('\t')
+            default:
+                b.WriteByte(raw[i])
+            }
+        case (c == '#' || c == ';') && !quoted:
+            return strings.TrimSpace(b.String())
+        default:
+            b.WriteByte(c)
+        }
+    }
+    return strings.TrimSpace(b.String())
+}
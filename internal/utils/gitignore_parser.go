@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 // IgnorePattern represents a single gitignore pattern with its context
@@ -20,47 +21,97 @@ type IgnorePattern struct {
 // IgnoreMatcher is a function that checks if a path should be ignored
 type IgnoreMatcher func(path string) bool
 
-// ParseGitignorePatterns creates an ignore matcher from a list of patterns
+// ParseGitignorePatterns creates an ignore matcher from a list of patterns.
+// Patterns are evaluated the way git does: the last matching pattern wins,
+// and nothing inside an ignored directory can be re-included by a negation.
 func ParseGitignorePatterns(patterns []PatternSource) IgnoreMatcher {
-    rules := make([]*IgnorePattern, 0)
-    
+    rules := compilePatterns(patterns)
+
+    if len(rules) == 0 {
+        return func(path string) bool { return false }
+    }
+
+    m := &ignoreMatcher{rules: rules, dirs: make(map[string]bool)}
+    return m.ignored
+}
+
+// compilePatterns parses patterns, dropping comments and invalid ones
+func compilePatterns(patterns []PatternSource) []*IgnorePattern {
+    rules := make([]*IgnorePattern, 0, len(patterns))
     for _, ps := range patterns {
         rule := parsePattern(ps.Pattern, ps.BaseDir)
         if rule != nil {
             rules = append(rules, rule)
         }
     }
-    
-    // If no negation rules, we can use simple matching
-    hasNegation := false
-    for _, rule := range rules {
-        if rule.IsNegation {
-            hasNegation = true
-            break
-        }
+    return rules
+}
+
+// ignoreMatcher caches decisions for directories, since every path below a
+// directory needs them
+type ignoreMatcher struct {
+    rules []*IgnorePattern
+    mu    sync.Mutex
+    dirs  map[string]bool
+}
+
+func (m *ignoreMatcher) ignored(path string) bool {
+    path = normalizePath(path)
+    if m.dirIgnored(filepath.Dir(path)) {
+        return true
     }
-    
-    if !hasNegation {
-        return func(path string) bool {
-            for _, rule := range rules {
-                if rule.Match(path) {
-                    return true
-                }
-            }
-            return false
+
+    // Only stat when a directory-only pattern needs to know
+    checked, isDir := false, false
+    return m.decide(path, func() bool {
+        if !checked {
+            // Like git, a symlink to a directory is not a directory
+            info, err := os.Lstat(path)
+            isDir = err == nil && info.IsDir()
+            checked = true
         }
+        return isDir
+    })
+}
+
+// dirIgnored reports whether dir or any directory above it is ignored
+func (m *ignoreMatcher) dirIgnored(dir string) bool {
+    m.mu.Lock()
+    ignored, ok := m.dirs[dir]
+    m.mu.Unlock()
+    if ok {
+        return ignored
     }
-    
-    // With negation rules, we need to check in reverse order
-    return func(path string) bool {
-        // Later rules override earlier rules
-        for i := len(rules) - 1; i >= 0; i-- {
-            if rules[i].Match(path) {
-                return !rules[i].IsNegation
-            }
+
+    if parent := filepath.Dir(dir); parent != dir {
+        ignored = m.dirIgnored(parent)
+    }
+    if !ignored {
+        ignored = m.decide(dir, func() bool { return true })
+    }
+
+    m.mu.Lock()
+    m.dirs[dir] = ignored
+    m.mu.Unlock()
+    return ignored
+}
+
+// decide applies the last pattern that matches path itself
+func (m *ignoreMatcher) decide(path string, isDir func() bool) bool {
+    ignored, _ := lastMatch(m.rules, path, isDir)
+    return ignored
+}
+
+// lastMatch finds the last rule matching path itself. It reports whether
+// that rule ignores the path and whether any rule matched at all.
+func lastMatch(rules []*IgnorePattern, path string, isDir func() bool) (ignored, matched bool) {
+    for i := len(rules) - 1; i >= 0; i-- {
+        rule := rules[i]
+        if rule.matches(path) && (!rule.IsDirectory || isDir()) {
+            return !rule.IsNegation, true
         }
-        return false
     }
+    return false, false
 }
 
 // PatternSource represents a pattern and its source directory
@@ -71,92 +122,208 @@ type PatternSource struct {
 
 // parsePattern converts a gitignore pattern to an IgnorePattern
 func parsePattern(pattern, baseDir string) *IgnorePattern {
-    pattern = strings.TrimSpace(pattern)
-    
-    // Skip empty lines and comments
+    pattern = trimTrailingSpaces(strings.TrimRight(pattern, "\r"))
+
+    // Skip empty lines and comments; "\#" is a literal #
     if pattern == "" || strings.HasPrefix(pattern, "#") {
         return nil
     }
-    
+
     ip := &IgnorePattern{
         Pattern: pattern,
         BaseDir: normalizePath(baseDir),
     }
-    
-    // Handle negation
+
+    // Handle negation; "\!" is a literal !
     if strings.HasPrefix(pattern, "!") {
         ip.IsNegation = true
         pattern = pattern[1:]
     }
-    
+
     // Handle directory-only patterns
     if strings.HasSuffix(pattern, "/") {
         ip.IsDirectory = true
         pattern = strings.TrimSuffix(pattern, "/")
     }
-    
+
+    if pattern == "" {
+        return nil
+    }
+
     // Convert pattern to regex
-    regexStr := patternToRegex(pattern)
+    regexStr, ok := patternToRegex(pattern)
+    if !ok {
+        Log.Warning("Invalid gitignore pattern '%s'", ip.Pattern)
+        return nil
+    }
     regex, err := regexp.Compile(regexStr)
     if err != nil {
-        Log.Warning("Invalid gitignore pattern '%s': %v", pattern, err)
+        Log.Warning("Invalid gitignore pattern '%s': %v", ip.Pattern, err)
         return nil
     }
     ip.regex = regex
-    
+
     return ip
 }
 
-// Match checks if a path matches this ignore pattern
-func (ip *IgnorePattern) Match(path string) bool {
-    path = normalizePath(path)
-    
+// trimTrailingSpaces drops trailing spaces unless they are escaped with a
+// backslash
+func trimTrailingSpaces(pattern string) string {
+    for strings.HasSuffix(pattern, " ") && !strings.HasSuffix(pattern, "\\ ") {
+        pattern = pattern[:len(pattern)-1]
+    }
+    return pattern
+}
+
+// Match checks if a pattern matches the path itself. Whether a path is
+// ignored also depends on its parent directories; see ParseGitignorePatterns.
+func (ip *IgnorePattern) Match(path string, isDir bool) bool {
+    if ip.IsDirectory && !isDir {
+        return false
+    }
+    return ip.matches(normalizePath(path))
+}
+
+// matches tests an absolute path against the pattern, ignoring IsDirectory
+func (ip *IgnorePattern) matches(path string) bool {
     // Get relative path from base directory
     relPath := path
     if ip.BaseDir != "" {
-        rel, err := filepath.Rel(ip.BaseDir, path)
-        if err != nil || strings.HasPrefix(rel, "..") {
+        prefix := ip.BaseDir
+        if !strings.HasSuffix(prefix, string(os.PathSeparator)) {
+            prefix += string(os.PathSeparator)
+        }
+        if !strings.HasPrefix(path, prefix) {
             // Path is outside base directory
             return false
         }
-        relPath = rel
+        relPath = path[len(prefix):]
     }
-    
+
     // Normalize path separators for matching
-    relPath = strings.ReplaceAll(relPath, string(os.PathSeparator), "/")
-    
+    relPath = filepath.ToSlash(relPath)
+
     return ip.regex.MatchString(relPath)
 }
 
-// patternToRegex converts a gitignore pattern to a regular expression
-func patternToRegex(pattern string) string {
-    // Remove leading slash (patterns are relative to their directory)
+// patternToRegex converts a gitignore pattern, without its negation and
+// trailing slash, to a regular expression matching relative paths. It fails
+// for patterns git treats as invalid, such as a trailing backslash.
+func patternToRegex(pattern string) (string, bool) {
+    // A slash at the start or in the middle anchors the pattern to its
+    // directory; otherwise it matches at any depth
     anchored := strings.Contains(pattern, "/")
-    if strings.HasPrefix(pattern, "/") {
-        pattern = pattern[1:]
-        anchored = true
-    }
-    
-    // Handle ** patterns
-    pattern = strings.ReplaceAll(pattern, "**/", "(.*/)?")
-    
-    // Escape special regex characters except * and ?
-    specialChars := []string{".", "+", "^", "$", "(", ")", "[", "]", "{", "}", "|"}
-    for _, char := range specialChars {
-        pattern = strings.ReplaceAll(pattern, char, "\\"+char)
-    }
-    
-    // Convert * and ? to regex equivalents
-    // * matches anything except /
-    pattern = strings.ReplaceAll(pattern, "*", "[^/]*")
-    // ? matches any single character except /
-    pattern = strings.ReplaceAll(pattern, "?", "[^/]")
-    
-    // Build final regex
-    if anchored {
-        return "^" + pattern + "(/.*)?$"
-    }
-    return "(^|/)" + pattern + "(/.*)?$"
+    pattern = strings.TrimPrefix(pattern, "/")
+
+    var b strings.Builder
+    b.WriteString("^")
+    if !anchored {
+        b.WriteString("(?:.*/)?")
+    }
+
+    p := []rune(pattern)
+    for i := 0; i < len(p); {
+        switch c := p[i]; c {
+        case '*':
+            j := i
+            for j < len(p) && p[j] == '*' {
+                j++
+            }
+            // "**" is special only as a whole path component
+            if j-i >= 2 && (i == 0 || p[i-1] == '/') && (j == len(p) || p[j] == '/') {
+                if j == len(p) {
+                    // Trailing "/**" matches everything inside
+                    b.WriteString(".*")
+                } else {
+                    // Leading "**/" and inner "/**/" match zero or more directories
+                    b.WriteString("(?:.*/)?")
+                    j++
+                }
+            } else {
+                b.WriteString("[^/]*")
+            }
+            i = j
+        case '?':
+            b.WriteString("[^/]")
+            i++
+        case '[':
+            class, next, ok := bracketToRegex(p, i)
+            if !ok {
+                // An unclosed bracket is literal
+                b.WriteString(`\[`)
+                i++
+                continue
+            }
+            b.WriteString(class)
+            i = next
+        case '\\':
+            if i+1 == len(p) {
+                return "", false
+            }
+            b.WriteString(regexp.QuoteMeta(string(p[i+1])))
+            i += 2
+        default:
+            b.WriteString(regexp.QuoteMeta(string(c)))
+            i++
+        }
+    }
+
+    b.WriteString("$")
+    return b.String(), true
+}
+
+// bracketToRegex converts the bracket expression starting at p[start] to a
+// regex character class, returning the index after its closing bracket.
+// Like git's, classes never match a slash.
+func bracketToRegex(p []rune, start int) (string, int, bool) {
+    i := start + 1
+    negate := false
+    if i < len(p) && (p[i] == '!' || p[i] == '^') {
+        negate = true
+        i++
+    }
+
+    var b strings.Builder
+    for first := true; i < len(p); first = false {
+        c := p[i]
+        switch {
+        case c == ']' && !first:
+            if negate {
+                return "[^/" + b.String() + "]", i + 1, true
+            }
+            if b.Len() == 0 {
+                return "", 0, false
+            }
+            return "[" + b.String() + "]", i + 1, true
+        case c == '[' && i+1 < len(p) && p[i+1] == ':':
+            // POSIX classes such as [:alpha:] mean the same to RE2
+            end := strings.Index(string(p[i:]), ":]")
+            if end < 0 {
+                return "", 0, false
+            }
+            name := []rune(string(p[i:])[:end+2])
+            b.WriteString(string(name))
+            i += len(name)
+            continue
+        case c == '\\' && i+1 < len(p):
+            i++
+            b.WriteString(classChar(p[i]))
+        case c == '-':
+            b.WriteRune(c)
+        case c != '/':
+            b.WriteString(classChar(c))
+        }
+        i++
+    }
+    return "", 0, false
+}
+
+// classChar escapes a literal rune for use inside a regex character class
+func classChar(c rune) string {
+    if strings.ContainsRune(`\]^-[`, c) {
+        return `\` + string(c)
+    }
+    return string(c)
 }
 
 // normalizePath normalizes a file path
@@ -173,25 +340,34 @@ func normalizePath(path string) string {
 
 // ReadGitignoreFile reads patterns from a .gitignore file
 func ReadGitignoreFile(filePath string) ([]PatternSource, error) {
+    return readIgnoreFile(filePath, filepath.Dir(filePath))
+}
+
+// readIgnoreFile reads patterns from a file in gitignore format whose
+// patterns are relative to baseDir
+func readIgnoreFile(filePath, baseDir string) ([]PatternSource, error) {
     file, err := os.Open(filePath)
     if err != nil {
         return nil, err
     }
     defer file.Close()
-    
+
     var patterns []PatternSource
-    baseDir := filepath.Dir(filePath)
-    
+
     scanner := bufio.NewScanner(file)
-    for scanner.Scan() {
-        line := strings.TrimSpace(scanner.Text())
-        if line != "" && !strings.HasPrefix(line, "#") {
+    for first := true; scanner.Scan(); first = false {
+        // Leading spaces are part of the pattern; parsePattern trims trailing ones
+        line := strings.TrimRight(scanner.Text(), "\r")
+        if first {
+            line = strings.TrimPrefix(line, "\ufeff")
+        }
+        if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "#") {
             patterns = append(patterns, PatternSource{
                 Pattern: line,
                 BaseDir: baseDir,
             })
         }
     }
-    
+
     return patterns, scanner.Err()
 }
@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPatternMatch(t *testing.T) {
+	base := t.TempDir()
+
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		// Wildcards
+		{"*.go", "main.go", false, true},
+		{"*.go", "cmd/main.go", false, true},
+		{"*.go", "main.go.txt", false, false},
+		{"?.go", "a.go", false, true},
+		{"?.go", "ab.go", false, false},
+		{"a*b", "axxb", false, true},
+		{"a*b", "ax/b", false, false},
+		{"a**b", "axxb", false, true},
+		{"a**b", "ax/b", false, false},
+
+		// Character classes
+		{"*.[oa]", "lib.o", false, true},
+		{"*.[oa]", "lib.a", false, true},
+		{"*.[oa]", "lib.c", false, false},
+		{"[a-c]x", "bx", false, true},
+		{"[a-c]x", "dx", false, false},
+		{"[!a]bc", "xbc", false, true},
+		{"[!a]bc", "abc", false, false},
+		{"[^a]bc", "abc", false, false},
+		{"[[:digit:]]*", "1abc", false, true},
+		{"[[:digit:]]*", "abc", false, false},
+		{"[]]x", "]x", false, true},
+		{"x[!a]y", "x/y", false, false},
+		{"[unclosed", "[unclosed", false, true},
+
+		// Leading "**/"
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"**/foo/bar", "foo/bar", false, true},
+		{"**/foo/bar", "x/y/foo/bar", false, true},
+		{"**/foo/bar", "foo/x/bar", false, false},
+
+		// Middle "/**/"
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "xa/b", false, false},
+		{"a/**/b", "z/a/b", false, false},
+
+		// Trailing "/**"
+		{"abc/**", "abc/x", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"abc/**", "abc", true, false},
+
+		// Escapes
+		{`\#file`, "#file", false, true},
+		{`\!important`, "!important", false, true},
+		{`\*`, "*", false, true},
+		{`\*`, "x", false, false},
+
+		// Trailing spaces are dropped unless escaped
+		{"foo  ", "foo", false, true},
+		{`foo\ `, "foo ", false, true},
+		{`foo\ `, "foo", false, false},
+
+		// Directory-only patterns
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"src/build/", "src/build", true, true},
+
+		// A slash at the start or middle anchors the pattern
+		{"/root.txt", "root.txt", false, true},
+		{"/root.txt", "sub/root.txt", false, false},
+		{"doc/frotz", "doc/frotz", false, true},
+		{"doc/frotz", "a/doc/frotz", false, false},
+		{"frotz", "a/b/frotz", false, true},
+		{"/*.c", "cat-file.c", false, true},
+		{"/*.c", "mozilla-sha1/sha1.c", false, false},
+	}
+
+	for _, tt := range tests {
+		rule := parsePattern(tt.pattern, base)
+		if rule == nil {
+			t.Errorf("parsePattern(%q) = nil", tt.pattern)
+			continue
+		}
+		if got := rule.Match(filepath.Join(base, tt.path), tt.isDir); got != tt.want {
+			t.Errorf("%q matching %q (dir %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		valid    bool
+		negation bool
+		dir      bool
+	}{
+		{"", false, false, false},
+		{"   ", false, false, false},
+		{"# comment", false, false, false},
+		{"!", false, false, false},
+		{"/", false, false, false},
+		{`trailing\`, false, false, false},
+		{"!keep.log", true, true, false},
+		{`\!keep.log`, true, false, false},
+		{`\#x`, true, false, false},
+		{"logs/", true, false, true},
+		{"!logs/", true, true, true},
+		{"x\r", true, false, false},
+	}
+
+	for _, tt := range tests {
+		rule := parsePattern(tt.pattern, "/base")
+		if (rule != nil) != tt.valid {
+			t.Errorf("parsePattern(%q) valid = %v, want %v", tt.pattern, rule != nil, tt.valid)
+			continue
+		}
+		if rule != nil && (rule.IsNegation != tt.negation || rule.IsDirectory != tt.dir) {
+			t.Errorf("parsePattern(%q) negation %v dir %v, want %v %v", tt.pattern, rule.IsNegation, rule.IsDirectory, tt.negation, tt.dir)
+		}
+	}
+}
+
+// makeTree creates files, ending with "/" for directories, under dir
+func makeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// isolateGit keeps the user's own git configuration out of a test
+func isolateGit(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	return home
+}
+
+// checkIgnored compares the matcher and the walker against want, keyed by
+// slash-separated paths relative to dir
+func checkIgnored(t *testing.T, dir string, exclude []string, want map[string]bool) {
+	t.Helper()
+	ignore := ParseGitignorePatterns(GetIgnoredPatterns(dir, exclude))
+
+	walked := make(map[string]bool)
+	for _, file := range WalkTree(dir, WalkOptions{MaxDepth: -1, Exclude: exclude}).Files() {
+		rel, _ := filepath.Rel(dir, file)
+		walked[filepath.ToSlash(rel)] = true
+	}
+
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if got := ignore(filepath.Join(dir, filepath.FromSlash(name))); got != want[name] {
+			t.Errorf("ignored(%s) = %v, want %v", name, got, want[name])
+		}
+		if walked[name] == want[name] {
+			t.Errorf("walk kept %s = %v, want %v", name, walked[name], !want[name])
+		}
+	}
+}
+
+func TestNegationUnderIgnoredDirectory(t *testing.T) {
+	isolateGit(t)
+	dir := t.TempDir()
+	makeTree(t, dir, map[string]string{
+		".gitignore":       "logs/\n!logs/keep.log\ncache/*\n!cache/keep.txt\n",
+		"logs/keep.log":    "",
+		"logs/other.log":   "",
+		"cache/keep.txt":   "",
+		"cache/other.txt":  "",
+		"cache/sub/x.txt":  "",
+		"main.go":          "",
+		".github/ci.yml":   "",
+		".env.example":     "",
+		"logs.txt":         "",
+		"nested/logs/a.go": "",
+	})
+
+	checkIgnored(t, dir, nil, map[string]bool{
+		// A file can't be re-included when its parent directory is ignored
+		"logs/keep.log":  true,
+		"logs/other.log": true,
+		// It can when only the directory's contents are
+		"cache/keep.txt":   false,
+		"cache/other.txt":  true,
+		"cache/sub/x.txt":  true,
+		"main.go":          false,
+		".github/ci.yml":   false,
+		".env.example":     false,
+		"logs.txt":         false,
+		"nested/logs/a.go": true,
+	})
+}
+
+func TestIgnoreSourcePrecedence(t *testing.T) {
+	home := isolateGit(t)
+	excludes := filepath.Join(home, "global-ignore")
+	makeTree(t, home, map[string]string{
+		"global-ignore": "*.tmp\n*.log\n",
+	})
+
+	dir := t.TempDir()
+	makeTree(t, dir, map[string]string{
+		".git/config":       "[core]\n\texcludesFile = " + excludes + "\n",
+		".git/info/exclude": "!important.log\n*.secret\n",
+		".gitignore":        "!keep.secret\n*.out\n",
+		"sub/.gitignore":    "!sub.out\n!keep.out\n*.go\n",
+		"a.tmp":             "",
+		"a.log":             "",
+		"important.log":     "",
+		"x.secret":          "",
+		"keep.secret":       "",
+		"a.out":             "",
+		"sub/sub.out":       "",
+		"sub/keep.out":      "",
+		"sub/other.out":     "",
+		"sub/main.go":       "",
+		"main.go":           "",
+	})
+
+	checkIgnored(t, dir, []string{"sub.out", "!a.log"}, map[string]bool{
+		"a.tmp": true,
+		// Configured excludes override every file
+		"a.log":       false,
+		"sub/sub.out": true,
+		// .git/info/exclude overrides core.excludesFile
+		"important.log": false,
+		"x.secret":      true,
+		// .gitignore overrides .git/info/exclude
+		"keep.secret": false,
+		"a.out":       true,
+		// A nested .gitignore overrides its parents
+		"sub/keep.out":  false,
+		"sub/other.out": true,
+		"sub/main.go":   true,
+		"main.go":       false,
+		".git/config":   true,
+	})
+}
+
+func TestDefaultExcludesFile(t *testing.T) {
+	home := isolateGit(t)
+	makeTree(t, home, map[string]string{
+		".config/git/ignore": "*.xdg\n",
+	})
+
+	dir := t.TempDir()
+	makeTree(t, dir, map[string]string{
+		".git/HEAD": "",
+		"a.xdg":     "",
+		"a.txt":     "",
+	})
+
+	checkIgnored(t, dir, nil, map[string]bool{"a.xdg": true, "a.txt": false})
+}
+
+func TestReadGitConfigValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	content := "[user]\n\texcludesfile = wrong\n[Core]\n\tExcludesFile = \"first\" ; comment\n[core] excludesfile = ~/last\\tfile # comment\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := readGitConfigValue(path, "core", "excludesFile")
+	if !ok || got != "~/last\tfile" {
+		t.Errorf("readGitConfigValue = %q, %v, want the last value", got, ok)
+	}
+}
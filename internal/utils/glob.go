@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// GlobFiles returns the files under directory whose paths, relative to it
+// and slash-separated, match any of the patterns. Files the web UI hides
+// (ignored by .gitignore or exclude, as for WalkOptions.Exclude) are never
+// returned. Patterns use gitignore syntax: one without a slash matches a
+// name at any depth, "**" spans directories, and a directory selects
+// everything inside it.
+func GlobFiles(directory string, patterns, exclude []string) ([]string, error) {
+    var globs []*regexp.Regexp
+    for _, pattern := range patterns {
+        trimmed := strings.TrimSuffix(filepath.ToSlash(strings.TrimSpace(pattern)), "/")
+        trimmed = strings.TrimPrefix(trimmed, "./")
+        if trimmed == "" || trimmed == "." {
+            trimmed = "**"
+        }
+        expr, ok := patternToRegex(trimmed)
+        if !ok {
+            return nil, fmt.Errorf("invalid pattern %q", pattern)
+        }
+        globs = append(globs, regexp.MustCompile(expr))
+    }
+
+    matches := func(rel string) bool {
+        // A match on any parent directory selects the file too
+        for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+            for _, glob := range globs {
+                if glob.MatchString(p) {
+                    return true
+                }
+            }
+        }
+        return false
+    }
+
+    root := filepath.Clean(directory)
+    tree := WalkTree(directory, WalkOptions{
+        MaxDepth: -1,
+        Exclude:  exclude,
+        Visit: func(file string, entry fs.DirEntry) bool {
+            rel, err := filepath.Rel(root, file)
+            return err == nil && matches(filepath.ToSlash(rel))
+        },
+    })
+
+    var files []string
+    for _, file := range tree.Files() {
+        if rel, err := filepath.Rel(root, file); err == nil {
+            files = append(files, filepath.ToSlash(rel))
+        }
+    }
+    sort.Strings(files)
+    return files, nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGlobFiles(t *testing.T) {
+	isolateGit(t)
+	dir := t.TempDir()
+	makeTree(t, dir, map[string]string{
+		".gitignore":             "build/\n*.log\n",
+		"main.go":                "",
+		"README.md":              "",
+		"cmd/app/main.go":        "",
+		"cmd/app/main_test.go":   "",
+		"internal/api/api.go":    "",
+		"internal/api/doc.md":    "",
+		"internal/api/gen.pb.go": "",
+		"build/out.go":           "",
+		"debug.log":              "",
+		"vendor/dep/dep.go":      "",
+		"empty/":                 "",
+	})
+
+	tests := []struct {
+		name     string
+		patterns []string
+		exclude  []string
+		want     []string
+	}{
+		{"name at any depth", []string{"main.go"}, nil, []string{"cmd/app/main.go", "main.go"}},
+		{"wildcard", []string{"*.md"}, nil, []string{"README.md", "internal/api/doc.md"}},
+		{"anchored", []string{"/main.go"}, nil, []string{"main.go"}},
+		{"double star", []string{"cmd/**/*_test.go"}, nil, []string{"cmd/app/main_test.go"}},
+		{"directory", []string{"internal/api/"}, nil, []string{"internal/api/api.go", "internal/api/doc.md", "internal/api/gen.pb.go"}},
+		{"several patterns", []string{"./README.md", "cmd/app"}, nil, []string{"README.md", "cmd/app/main.go", "cmd/app/main_test.go"}},
+		{
+			name:     "everything",
+			patterns: []string{"."},
+			want: []string{
+				".gitignore", "README.md", "cmd/app/main.go", "cmd/app/main_test.go", "internal/api/api.go",
+				"internal/api/doc.md", "internal/api/gen.pb.go", "main.go", "vendor/dep/dep.go",
+			},
+		},
+		{"ignored files", []string{"build", "*.log"}, nil, nil},
+		{"configured excludes", []string{"*.go"}, []string{"vendor", "*.pb.go", "*_test.go"}, []string{"cmd/app/main.go", "internal/api/api.go", "main.go"}},
+		{"no match", []string{"*.rs"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GlobFiles(dir, tt.patterns, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GlobFiles(%q) = %q, want %q", tt.patterns, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := GlobFiles(dir, []string{`trailing\`}, nil); err == nil {
+		t.Error("GlobFiles with an invalid pattern succeeded")
+	}
+}
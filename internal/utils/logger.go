@@ -2,7 +2,9 @@ package utils
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/gongzhen/codewhisper-go/pkg/config"
@@ -22,6 +24,7 @@ const (
 type Logger struct {
     level  LogLevel
     prefix string
+    out    io.Writer
 }
 
 // NewLogger creates a new logger instance
@@ -35,9 +38,21 @@ func NewLogger() *Logger {
     return &Logger{
         level:  level,
         prefix: "\033[35mCODEWHISPER\033[0m:     ", // Purple color for CodeWhisper
+        out:    os.Stdout,
     }
 }
 
+// SetOutput sends log messages to w instead of stdout. Call it before
+// logging starts.
+func (l *Logger) SetOutput(w io.Writer) {
+    l.out = w
+}
+
+// SetLevel changes the least severe level that is logged
+func (l *Logger) SetLevel(level string) {
+    l.level = parseLogLevel(level)
+}
+
 func parseLogLevel(level string) LogLevel {
     switch strings.ToUpper(level) {
     case "DEBUG":
@@ -84,9 +99,9 @@ func (l *Logger) output(level, format string, v ...interface{}) {
     
     // Add log level indicator for non-INFO messages
     if level != "INFO" {
-        fmt.Printf("%s[%s] %s\n", l.prefix, level, message)
+        fmt.Fprintf(l.out, "%s[%s] %s\n", l.prefix, level, message)
     } else {
-        fmt.Printf("%s%s\n", l.prefix, message)
+        fmt.Fprintf(l.out, "%s%s\n", l.prefix, message)
     }
 }
 
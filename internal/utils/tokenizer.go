@@ -2,37 +2,14 @@ package utils
 
 import (
 	"os"
-	"unicode"
+
+	"github.com/gongzhen/codewhisper-go/internal/tokenizer"
 )
 
-// CountTokens provides a simple token count approximation
-// In the Python version, they use tiktoken. For now, we'll use a simple approximation.
-// Later we can integrate a proper tokenizer.
+// CountTokens counts tokens with the BPE tokenizer selected for the current
+// model (cl100k_base by default)
 func CountTokens(text string) int {
-    // Simple approximation: split by whitespace and punctuation
-    // This gives roughly similar results to tiktoken for English text
-    
-    wordCount := 0
-    inWord := false
-    
-    for _, r := range text {
-        if unicode.IsLetter(r) || unicode.IsDigit(r) {
-            if !inWord {
-                wordCount++
-                inWord = true
-            }
-        } else {
-            inWord = false
-            // Count some punctuation as tokens
-            if r == '.' || r == ',' || r == '!' || r == '?' || r == ';' || r == ':' {
-                wordCount++
-            }
-        }
-    }
-     
-    // Approximate tokens as 0.75 * word count (rough approximation)
-    // tiktoken typically produces more tokens than word count
-    return int(float64(wordCount) * 0.75)
+    return tokenizer.Count(text)
 }
 
 // CountTokensInFile counts tokens in a file
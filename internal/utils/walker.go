@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// WalkOptions configures WalkTree
+type WalkOptions struct {
+    // MaxDepth is the deepest level whose directories are listed, the root
+    // being level 0. Deeper directories appear without children. A negative
+    // value means no limit.
+    MaxDepth int
+    // Visit, if set, is called for every file the walk keeps, from several
+    // goroutines at once. Returning false leaves the file out of the tree.
+    Visit func(path string, entry fs.DirEntry) bool
+    // Exclude holds gitignore patterns, relative to the walked directory,
+    // that override every ignore file like git's command-line excludes
+    Exclude []string
+}
+
+// TreeNode is a file or directory found by WalkTree
+type TreeNode struct {
+    Name     string
+    Path     string // the walked directory joined with the relative path
+    IsDir    bool
+    Children []*TreeNode // sorted by name
+    // Ignore holds the patterns of the directory's .gitignore
+    Ignore []PatternSource
+    // exclude is WalkOptions.Exclude, kept on the root for IgnorePatterns
+    exclude []string
+}
+
+// WalkTree walks directory in a single pass. Each directory's .gitignore is
+// read as the walk enters it, and ignored entries are skipped without being
+// entered. Hidden files are kept unless ignored, like git does; .git itself
+// is always ignored. Subtrees are walked in parallel.
+func WalkTree(directory string, opts WalkOptions) *TreeNode {
+    low, high := baseIgnorePatterns(directory, opts.Exclude)
+    w := &walker{
+        opts: opts,
+        low:  compilePatterns(low),
+        high: compilePatterns(high),
+        sem:  make(chan struct{}, runtime.GOMAXPROCS(0)*2),
+    }
+
+    root := &TreeNode{Name: filepath.Base(directory), Path: filepath.Clean(directory), IsDir: true, exclude: opts.Exclude}
+    w.walkDir(root, normalizePath(directory), nil, 0)
+    w.wg.Wait()
+    return root
+}
+
+// IgnorePatterns returns every pattern in effect for a tree from WalkTree,
+// in the order GetIgnoredPatterns returns them
+func (t *TreeNode) IgnorePatterns() []PatternSource {
+    low, high := baseIgnorePatterns(t.Path, t.exclude)
+
+    patterns := low
+    var collect func(n *TreeNode)
+    collect = func(n *TreeNode) {
+        patterns = append(patterns, n.Ignore...)
+        for _, child := range n.Children {
+            if child.IsDir {
+                collect(child)
+            }
+        }
+    }
+    collect(t)
+
+    return append(patterns, high...)
+}
+
+// Files returns the paths of every file in the tree
+func (t *TreeNode) Files() []string {
+    var files []string
+    var collect func(n *TreeNode)
+    collect = func(n *TreeNode) {
+        for _, child := range n.Children {
+            if child.IsDir {
+                collect(child)
+            } else {
+                files = append(files, child.Path)
+            }
+        }
+    }
+    collect(t)
+    return files
+}
+
+// ruleChain holds the .gitignore rules of one directory and links to those
+// of its parent, so deeper files take precedence
+type ruleChain struct {
+    parent *ruleChain
+    rules  []*IgnorePattern
+}
+
+type walker struct {
+    opts WalkOptions
+    // low rules apply below every .gitignore, high rules above them
+    low  []*IgnorePattern
+    high []*IgnorePattern
+    sem  chan struct{}
+    wg   sync.WaitGroup
+}
+
+// ignored applies the last matching rule, searching the most specific
+// sources first
+func (w *walker) ignored(chain *ruleChain, path string, isDir bool) bool {
+    dir := func() bool { return isDir }
+    if ignored, ok := lastMatch(w.high, path, dir); ok {
+        return ignored
+    }
+    for c := chain; c != nil; c = c.parent {
+        if ignored, ok := lastMatch(c.rules, path, dir); ok {
+            return ignored
+        }
+    }
+    ignored, _ := lastMatch(w.low, path, dir)
+    return ignored
+}
+
+// spawn runs fn on another goroutine when one is free, else inline, so
+// the walk can't deadlock waiting for itself
+func (w *walker) spawn(fn func()) {
+    select {
+    case w.sem <- struct{}{}:
+        w.wg.Add(1)
+        go func() {
+            defer func() {
+                <-w.sem
+                w.wg.Done()
+            }()
+            fn()
+        }()
+    default:
+        fn()
+    }
+}
+
+// walkDir lists node, whose absolute path is absDir, and walks its subtrees
+func (w *walker) walkDir(node *TreeNode, absDir string, chain *ruleChain, depth int) {
+    if w.opts.MaxDepth >= 0 && depth > w.opts.MaxDepth {
+        return
+    }
+
+    entries, err := os.ReadDir(node.Path)
+    if err != nil {
+        return
+    }
+
+    if patterns, err := ReadGitignoreFile(filepath.Join(node.Path, ".gitignore")); err == nil && len(patterns) > 0 {
+        node.Ignore = patterns
+        chain = &ruleChain{parent: chain, rules: compilePatterns(patterns)}
+    }
+
+    // Children are filled in by position so the order doesn't depend on
+    // which goroutine finishes first
+    children := make([]*TreeNode, len(entries))
+    var pending sync.WaitGroup
+    for i, entry := range entries {
+        if entry.Name() == ".git" {
+            continue
+        }
+
+        path := filepath.Join(node.Path, entry.Name())
+        absPath := filepath.Join(absDir, entry.Name())
+        if w.ignored(chain, absPath, entry.IsDir()) {
+            continue
+        }
+
+        child := &TreeNode{Name: entry.Name(), Path: path, IsDir: entry.IsDir()}
+        if child.IsDir {
+            children[i] = child
+            w.spawn(func() { w.walkDir(child, absPath, chain, depth+1) })
+            continue
+        }
+
+        if w.opts.Visit == nil {
+            children[i] = child
+            continue
+        }
+        pending.Add(1)
+        w.spawn(func() {
+            defer pending.Done()
+            if w.opts.Visit(path, entry) {
+                children[i] = child
+            }
+        })
+    }
+    pending.Wait()
+
+    node.Children = make([]*TreeNode, 0, len(entries))
+    for _, child := range children {
+        if child != nil {
+            node.Children = append(node.Children, child)
+        }
+    }
+}
@@ -0,0 +1,140 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+
+// inotify watches one descriptor per directory, since inotify isn't recursive
+type inotify struct {
+	w    *Watcher
+	file *os.File
+
+	mu    sync.Mutex
+	fd    int
+	paths map[int]string // watch descriptor -> directory
+	wds   map[string]int
+}
+
+func newBackend(w *Watcher) (backend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init: %w", err)
+	}
+
+	// A non-blocking descriptor wrapped in os.File reads through the runtime
+	// poller, so closing the file unblocks the reader
+	in := &inotify{
+		w:     w,
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		fd:    fd,
+		paths: make(map[int]string),
+		wds:   make(map[string]int),
+	}
+	go in.read()
+	return in, nil
+}
+
+func (in *inotify) add(dir string) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	wd, err := syscall.InotifyAddWatch(in.fd, dir, watchMask)
+	if err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			return fmt.Errorf("inotify watch limit reached, raise fs.inotify.max_user_watches: %w", err)
+		}
+		return err
+	}
+	in.paths[wd] = dir
+	in.wds[dir] = wd
+	return nil
+}
+
+func (in *inotify) remove(dir string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	prefix := dir + string(filepath.Separator)
+	for path, wd := range in.wds {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			// The kernel has usually dropped the watch already
+			syscall.InotifyRmWatch(in.fd, uint32(wd))
+			delete(in.wds, path)
+			delete(in.paths, wd)
+		}
+	}
+}
+
+func (in *inotify) close() error {
+	return in.file.Close()
+}
+
+// read decodes inotify_event records until the descriptor is closed
+func (in *inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := in.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				utils.Log.Error("File watcher stopped: %v", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(raw.Len)]), "\x00")
+			offset = nameStart + int(raw.Len)
+
+			in.handle(int(raw.Wd), raw.Mask, name)
+		}
+	}
+}
+
+func (in *inotify) handle(wd int, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		in.w.emit(Event{Op: Overflow})
+		return
+	}
+
+	in.mu.Lock()
+	dir, ok := in.paths[wd]
+	if ok && mask&syscall.IN_IGNORED != 0 {
+		delete(in.paths, wd)
+		delete(in.wds, dir)
+	}
+	in.mu.Unlock()
+	if !ok || name == "" {
+		// Events on the directory itself; its parent reports the removal
+		return
+	}
+
+	ev := Event{Path: filepath.Join(dir, name), IsDir: mask&syscall.IN_ISDIR != 0}
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		ev.Op = Created
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		ev.Op = Removed
+	case mask&(syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE) != 0:
+		if ev.IsDir {
+			return
+		}
+		ev.Op = Modified
+	default:
+		return
+	}
+	in.w.emit(ev)
+}
@@ -0,0 +1,303 @@
+// Package watcher reports changes under a directory tree, skipping paths the
+// ignore matcher excludes, in debounced batches.
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+// Op is the kind of change seen for a path
+type Op int
+
+const (
+	Created Op = iota
+	Modified
+	Removed
+	// Overflow means the kernel dropped events; anything may have changed
+	Overflow
+)
+
+func (op Op) String() string {
+	switch op {
+	case Created:
+		return "created"
+	case Modified:
+		return "modified"
+	case Removed:
+		return "removed"
+	case Overflow:
+		return "overflow"
+	}
+	return "unknown"
+}
+
+// gitExclude is the repository's own ignore file, relative to the root. It
+// is the one path inside .git whose changes are reported.
+var gitExclude = filepath.Join(".git", "info", "exclude")
+
+// Event is one change. Path is joined onto the watched root as given, so it
+// has the same form as paths produced by walking that root.
+type Event struct {
+	Path  string
+	Op    Op
+	IsDir bool
+}
+
+const (
+	// quietPeriod is how long the tree must be still before a batch is sent
+	quietPeriod = 250 * time.Millisecond
+	// maxDelay bounds how long a steady stream of events can hold a batch back
+	maxDelay = 2 * time.Second
+)
+
+// Watcher watches a directory tree. Batches of coalesced events arrive on
+// Events, which is closed after Close.
+type Watcher struct {
+	Events chan []Event
+
+	root    string
+	mu      sync.RWMutex
+	ignore  utils.IgnoreMatcher
+	backend backend
+	raw     chan Event
+	done    chan struct{}
+	once    sync.Once
+}
+
+// backend is the platform's notification mechanism
+type backend interface {
+	// add watches one directory
+	add(dir string) error
+	// remove forgets a directory and everything watched under it
+	remove(dir string)
+	close() error
+}
+
+// New starts watching the directories of a tree from utils.WalkTree.
+// Directories created later are checked against ignore.
+func New(tree *utils.TreeNode, ignore utils.IgnoreMatcher) (*Watcher, error) {
+	w := &Watcher{
+		Events: make(chan []Event),
+		root:   tree.Path,
+		ignore: ignore,
+		raw:    make(chan Event, 1024),
+		done:   make(chan struct{}),
+	}
+
+	b, err := newBackend(w)
+	if err != nil {
+		return nil, err
+	}
+	w.backend = b
+
+	if err := w.addNode(tree); err != nil {
+		b.close()
+		return nil, err
+	}
+	// Best effort: there may be no repository, or .git may be a file
+	w.backend.add(filepath.Dir(filepath.Join(w.root, gitExclude)))
+
+	go w.debounce()
+	return w, nil
+}
+
+// addNode watches a walked directory and the directories below it
+func (w *Watcher) addNode(node *utils.TreeNode) error {
+	if err := w.backend.add(node.Path); err != nil {
+		return err
+	}
+	for _, child := range node.Children {
+		if !child.IsDir {
+			continue
+		}
+		if err := w.addNode(child); err != nil {
+			utils.Log.Warning("Not watching %s: %v", child.Path, err)
+		}
+	}
+	return nil
+}
+
+// SetIgnore replaces the ignore matcher after a .gitignore changed, given
+// the tree walked again with the new rules. Directories the change made
+// visible are watched; those already watched stay watched and their events
+// are filtered.
+func (w *Watcher) SetIgnore(tree *utils.TreeNode, ignore utils.IgnoreMatcher) {
+	w.mu.Lock()
+	w.ignore = ignore
+	w.mu.Unlock()
+
+	// Watching a directory again keeps its existing watch
+	if err := w.addNode(tree); err != nil {
+		utils.Log.Warning("Not watching %s: %v", tree.Path, err)
+	}
+}
+
+// Close stops watching and closes Events
+func (w *Watcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.backend.close()
+	})
+	return err
+}
+
+// skip reports whether changes to path are of no interest: anything inside
+// .git but its exclude file, and whatever the ignore matcher excludes
+func (w *Watcher) skip(path string) bool {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return true
+	}
+	if rel == gitExclude {
+		return false
+	}
+	if rel == ".git" || strings.HasPrefix(rel, ".git"+string(filepath.Separator)) {
+		return true
+	}
+	w.mu.RLock()
+	ignore := w.ignore
+	w.mu.RUnlock()
+	return ignore != nil && ignore(path)
+}
+
+// addTree watches a new directory and its subdirectories. It returns
+// Created events for what is already inside, since files can appear in a
+// new directory before its watch is in place.
+func (w *Watcher) addTree(dir string) ([]Event, error) {
+	if err := w.backend.add(dir); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil
+	}
+
+	var found []Event
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if w.skip(path) {
+			continue
+		}
+		found = append(found, Event{Path: path, Op: Created, IsDir: entry.IsDir()})
+		if entry.IsDir() {
+			sub, err := w.addTree(path)
+			if err != nil {
+				utils.Log.Warning("Not watching %s: %v", path, err)
+				continue
+			}
+			found = append(found, sub...)
+		}
+	}
+	return found, nil
+}
+
+// emit hands a raw event from the backend to the debouncer
+func (w *Watcher) emit(ev Event) {
+	if ev.Op != Overflow && w.skip(ev.Path) {
+		return
+	}
+
+	if ev.IsDir {
+		switch ev.Op {
+		case Created:
+			found, err := w.addTree(ev.Path)
+			if err != nil {
+				utils.Log.Warning("Not watching %s: %v", ev.Path, err)
+			}
+			for _, f := range found {
+				w.send(f)
+			}
+		case Removed:
+			w.backend.remove(ev.Path)
+		}
+	}
+	w.send(ev)
+}
+
+func (w *Watcher) send(ev Event) {
+	select {
+	case w.raw <- ev:
+	case <-w.done:
+	}
+}
+
+// debounce collects raw events until the tree has been quiet for
+// quietPeriod, then sends them as one batch with one event per path
+func (w *Watcher) debounce() {
+	defer close(w.Events)
+
+	pending := make(map[string]Event)
+	var quiet, deadline <-chan time.Time
+
+	flush := func() {
+		quiet, deadline = nil, nil
+		if len(pending) == 0 {
+			return
+		}
+
+		batch := make([]Event, 0, len(pending))
+		for _, ev := range pending {
+			batch = append(batch, ev)
+		}
+		sort.Slice(batch, func(i, j int) bool { return batch[i].Path < batch[j].Path })
+		pending = make(map[string]Event)
+
+		select {
+		case w.Events <- batch:
+		case <-w.done:
+		}
+	}
+
+	for {
+		select {
+		case ev := <-w.raw:
+			if ev.Op == Overflow {
+				// Individual changes are meaningless once some were lost
+				pending = map[string]Event{"": ev}
+			} else if _, overflowed := pending[""]; !overflowed {
+				merge(pending, ev)
+			}
+			quiet = time.After(quietPeriod)
+			if deadline == nil {
+				deadline = time.After(maxDelay)
+			}
+		case <-quiet:
+			flush()
+		case <-deadline:
+			flush()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// merge folds ev into the pending change for its path
+func merge(pending map[string]Event, ev Event) {
+	prev, ok := pending[ev.Path]
+	if !ok {
+		pending[ev.Path] = ev
+		return
+	}
+
+	switch {
+	case prev.Op == Created && ev.Op == Removed:
+		// Never existed as far as the batch is concerned
+		delete(pending, ev.Path)
+	case prev.Op == Created && ev.Op == Modified:
+		// Still a creation
+	case prev.Op == Removed && ev.Op == Created:
+		ev.Op = Modified
+		pending[ev.Path] = ev
+	default:
+		pending[ev.Path] = ev
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package watcher
+
+import (
+	"errors"
+	"runtime"
+)
+
+func newBackend(w *Watcher) (backend, error) {
+	return nil, errors.New("file watching is not supported on " + runtime.GOOS)
+}
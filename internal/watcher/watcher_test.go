@@ -0,0 +1,138 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gongzhen/codewhisper-go/internal/utils"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherReportsDotfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".gitignore"), "ignored.txt\n.cache/\n")
+	writeFile(t, filepath.Join(dir, ".github", "workflows", "ci.yml"), "on: push\n")
+	writeFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main\n")
+	writeFile(t, filepath.Join(dir, ".git", "info", "exclude"), "")
+
+	tree := utils.WalkTree(dir, utils.WalkOptions{MaxDepth: -1})
+	w, err := New(tree, utils.ParseGitignorePatterns(tree.IgnorePatterns()))
+	if err != nil {
+		t.Skipf("watching unavailable: %v", err)
+	}
+	defer w.Close()
+
+	writeFile(t, filepath.Join(dir, ".github", "workflows", "ci.yml"), "on: [push, pull_request]\n")
+	writeFile(t, filepath.Join(dir, ".env.example"), "KEY=\n")
+	writeFile(t, filepath.Join(dir, "ignored.txt"), "x\n")
+	writeFile(t, filepath.Join(dir, ".cache", "x"), "x\n")
+	writeFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/other\n")
+	writeFile(t, filepath.Join(dir, ".git", "info", "exclude"), "*.log\n")
+
+	seen := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for len(seen) < 3 {
+		select {
+		case batch := <-w.Events:
+			for _, ev := range batch {
+				rel, _ := filepath.Rel(dir, ev.Path)
+				seen[filepath.ToSlash(rel)] = true
+			}
+		case <-timeout:
+			t.Fatalf("timed out, saw %v", seen)
+		}
+	}
+
+	for _, want := range []string{".github/workflows/ci.yml", ".env.example", ".git/info/exclude"} {
+		if !seen[want] {
+			t.Errorf("no event for %s, saw %v", want, seen)
+		}
+	}
+	for _, unwanted := range []string{"ignored.txt", ".cache", ".cache/x", ".git/HEAD"} {
+		if seen[unwanted] {
+			t.Errorf("unexpected event for %s", unwanted)
+		}
+	}
+}
+
+// waitFor reads batches until one reports path, relative to dir
+func waitFor(t *testing.T, w *Watcher, dir, path string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case batch := <-w.Events:
+			for _, ev := range batch {
+				if rel, _ := filepath.Rel(dir, ev.Path); filepath.ToSlash(rel) == path {
+					return
+				}
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", path)
+		}
+	}
+}
+
+func TestSetIgnoreWatchesUnignoredDirectories(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".gitignore"), "build/\n")
+	writeFile(t, filepath.Join(dir, "build", "gen", "a.txt"), "a\n")
+
+	tree := utils.WalkTree(dir, utils.WalkOptions{MaxDepth: -1})
+	w, err := New(tree, utils.ParseGitignorePatterns(tree.IgnorePatterns()))
+	if err != nil {
+		t.Skipf("watching unavailable: %v", err)
+	}
+	defer w.Close()
+
+	writeFile(t, filepath.Join(dir, ".gitignore"), "")
+	waitFor(t, w, dir, ".gitignore")
+	tree = utils.WalkTree(dir, utils.WalkOptions{MaxDepth: -1})
+	w.SetIgnore(tree, utils.ParseGitignorePatterns(tree.IgnorePatterns()))
+
+	// Both directories were skipped when watching started
+	writeFile(t, filepath.Join(dir, "build", "gen", "b.txt"), "b\n")
+	waitFor(t, w, dir, "build/gen/b.txt")
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		ops   []Op
+		want  Op
+		empty bool
+	}{
+		{name: "created then modified", ops: []Op{Created, Modified}, want: Created},
+		{name: "created then removed", ops: []Op{Created, Removed}, empty: true},
+		{name: "removed then created", ops: []Op{Removed, Created}, want: Modified},
+		{name: "modified then removed", ops: []Op{Modified, Removed}, want: Removed},
+	}
+
+	for _, tt := range tests {
+		pending := make(map[string]Event)
+		for _, op := range tt.ops {
+			merge(pending, Event{Path: "a", Op: op})
+		}
+		ev, ok := pending["a"]
+		if tt.empty {
+			if ok {
+				t.Errorf("%s: pending = %v, want nothing", tt.name, ev)
+			}
+			continue
+		}
+		if !ok || ev.Op != tt.want {
+			t.Errorf("%s: op = %v, want %v", tt.name, ev.Op, tt.want)
+		}
+	}
+}
@@ -18,7 +18,14 @@ const (
     EnvTemperature          = "CODEWHISPER_TEMPERATURE"
     EnvMaxOutputTokens      = "CODEWHISPER_MAX_OUTPUT_TOKENS"
     EnvTopK                 = "CODEWHISPER_TOP_K"
+    EnvTopP                 = "CODEWHISPER_TOP_P"
+    EnvStopSequences        = "CODEWHISPER_STOP_SEQUENCES"
     EnvThinkingMode         = "CODEWHISPER_THINKING_MODE"
+    EnvThinkingBudget       = "CODEWHISPER_THINKING_BUDGET"
+    EnvTokenizer            = "CODEWHISPER_TOKENIZER"
+    EnvTokenizerDir         = "CODEWHISPER_TOKENIZER_DIR"
+    EnvIndexDir             = "CODEWHISPER_INDEX_DIR"
+    EnvConversationDir      = "CODEWHISPER_CONVERSATION_DIR"
 )
 
 // GetEnv retrieves an environment variable with a default value
@@ -46,8 +53,3 @@ func GetEnvBool(key string, defaultValue bool) bool {
     }
     return defaultValue
 }
-
-// SetEnv sets an environment variable (wrapper for os.Setenv)
-func SetEnv(key, value string) error {
-    return os.Setenv(key, value)
-}
\ No newline at end of file
@@ -0,0 +1,525 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RepoFileName is the per-repository config file, at the codebase root
+const RepoFileName = ".codewhisper.yaml"
+
+const fileHeader = `# CodeWhisper configuration. Settings changed in the web UI are saved here.
+`
+
+// Config is CodeWhisper's configuration. It is layered, each source
+// overriding the ones before it: built-in defaults, ~/.codewhisper/config.yaml,
+// .codewhisper.yaml in the codebase, environment variables (including .env
+// files), then command-line flags.
+type Config struct {
+    // Target is the codebase being analyzed. It comes from --target or the
+    // environment, never from a config file.
+    Target     string
+    Endpoint   string
+    Model      string // empty for the endpoint's default
+    AWSProfile string
+    Exclude    []string
+    MaxDepth   int
+    Generation Generation
+    Providers  Providers
+
+    // Where conversations, code indexes and tokenizer vocabularies are
+    // kept. Empty uses the directory of that name under ~/.codewhisper.
+    ConversationDir string
+    IndexDir        string
+    TokenizerDir    string
+    // Tokenizer, if set, counts tokens with that encoding for every model
+    Tokenizer string
+}
+
+// Generation holds the sampling and output options sent with every
+// request. Zero TopK, TopP and ThinkingBudget leave the provider's default.
+type Generation struct {
+    Temperature     float64  `json:"temperature"`
+    TopP            float64  `json:"top_p"`
+    TopK            int      `json:"top_k"`
+    MaxOutputTokens int      `json:"max_output_tokens"`
+    StopSequences   []string `json:"stop_sequences"`
+    ThinkingMode    bool     `json:"thinking_mode"`
+    ThinkingBudget  int      `json:"thinking_budget"`
+}
+
+// Provider holds an endpoint's credentials and API location. An empty
+// APIBase uses the endpoint's public API. NumCtx is the context window
+// Ollama loads models with, zero for its default; other endpoints ignore it.
+type Provider struct {
+    APIKey  string
+    APIBase string
+    NumCtx  int
+}
+
+// Providers holds the settings of each endpoint
+type Providers struct {
+    OpenAI    Provider
+    Anthropic Provider
+    Google    Provider
+    DeepSeek  Provider
+    Ollama    Provider
+}
+
+// Defaults returns the configuration used when nothing is configured
+func Defaults() Config {
+    return Config{
+        Target:   ".",
+        Endpoint: "openai",
+        MaxDepth: 15,
+        Exclude:  []string{},
+        Generation: Generation{
+            Temperature:     0.7,
+            MaxOutputTokens: 4096,
+            StopSequences:   []string{},
+        },
+    }
+}
+
+// Provider returns the settings of an endpoint
+func (c Config) Provider(endpoint string) Provider {
+    switch endpoint {
+    case "openai":
+        return c.Providers.OpenAI
+    case "anthropic":
+        return c.Providers.Anthropic
+    case "google":
+        return c.Providers.Google
+    case "deepseek":
+        return c.Providers.DeepSeek
+    case "ollama":
+        return c.Providers.Ollama
+    }
+    return Provider{}
+}
+
+// clone returns a copy that shares no slices with c
+func (c Config) clone() Config {
+    c.Exclude = slices.Clone(c.Exclude)
+    c.Generation.StopSequences = slices.Clone(c.Generation.StopSequences)
+    return c
+}
+
+// field ties a config file key to the Config field it sets and the
+// environment variables that override it, the first one set winning
+type field struct {
+    key string
+    env []string
+    ptr func(c *Config) any
+}
+
+var fields = []field{
+    {"endpoint", []string{EnvEndpoint}, func(c *Config) any { return &c.Endpoint }},
+    {"model", []string{EnvModel}, func(c *Config) any { return &c.Model }},
+    {"aws_profile", []string{EnvAWSProfile}, func(c *Config) any { return &c.AWSProfile }},
+    {"exclude", []string{EnvAdditionalExcludeDirs}, func(c *Config) any { return &c.Exclude }},
+    {"max_depth", []string{EnvMaxDepth}, func(c *Config) any { return &c.MaxDepth }},
+    {"conversation_dir", []string{EnvConversationDir}, func(c *Config) any { return &c.ConversationDir }},
+    {"index_dir", []string{EnvIndexDir}, func(c *Config) any { return &c.IndexDir }},
+    {"tokenizer", []string{EnvTokenizer}, func(c *Config) any { return &c.Tokenizer }},
+    {"tokenizer_dir", []string{EnvTokenizerDir}, func(c *Config) any { return &c.TokenizerDir }},
+
+    {"generation.temperature", []string{EnvTemperature}, func(c *Config) any { return &c.Generation.Temperature }},
+    {"generation.top_p", []string{EnvTopP}, func(c *Config) any { return &c.Generation.TopP }},
+    {"generation.top_k", []string{EnvTopK}, func(c *Config) any { return &c.Generation.TopK }},
+    {"generation.max_output_tokens", []string{EnvMaxOutputTokens}, func(c *Config) any { return &c.Generation.MaxOutputTokens }},
+    {"generation.stop_sequences", []string{EnvStopSequences}, func(c *Config) any { return &c.Generation.StopSequences }},
+    {"generation.thinking_mode", []string{EnvThinkingMode}, func(c *Config) any { return &c.Generation.ThinkingMode }},
+    {"generation.thinking_budget", []string{EnvThinkingBudget}, func(c *Config) any { return &c.Generation.ThinkingBudget }},
+
+    {"providers.openai.api_key", []string{"OPENAI_API_KEY"}, func(c *Config) any { return &c.Providers.OpenAI.APIKey }},
+    {"providers.openai.api_base", []string{"OPENAI_API_BASE"}, func(c *Config) any { return &c.Providers.OpenAI.APIBase }},
+    {"providers.anthropic.api_key", []string{"ANTHROPIC_API_KEY"}, func(c *Config) any { return &c.Providers.Anthropic.APIKey }},
+    {"providers.anthropic.api_base", []string{"ANTHROPIC_API_BASE"}, func(c *Config) any { return &c.Providers.Anthropic.APIBase }},
+    {"providers.google.api_key", []string{"GEMINI_API_KEY", "GOOGLE_API_KEY"}, func(c *Config) any { return &c.Providers.Google.APIKey }},
+    {"providers.google.api_base", []string{"GEMINI_API_BASE"}, func(c *Config) any { return &c.Providers.Google.APIBase }},
+    {"providers.deepseek.api_key", []string{"DEEPSEEK_API_KEY"}, func(c *Config) any { return &c.Providers.DeepSeek.APIKey }},
+    {"providers.deepseek.api_base", []string{"DEEPSEEK_API_BASE"}, func(c *Config) any { return &c.Providers.DeepSeek.APIBase }},
+    {"providers.ollama.api_base", []string{"OLLAMA_HOST"}, func(c *Config) any { return &c.Providers.Ollama.APIBase }},
+    {"providers.ollama.num_ctx", []string{"OLLAMA_NUM_CTX"}, func(c *Config) any { return &c.Providers.Ollama.NumCtx }},
+}
+
+// userOnly says whether a setting is kept out of a codebase's
+// .codewhisper.yaml: the AWS profile and each endpoint's API key and base
+// URL, which decide where requests and credentials go, and the directories
+// CodeWhisper keeps its own data in. A cloned repository shouldn't be able
+// to send them elsewhere, so only the user's file, the environment and
+// flags set them.
+func userOnly(key string) bool {
+    switch key {
+    case "aws_profile", "conversation_dir", "index_dir", "tokenizer_dir":
+        return true
+    }
+    return strings.HasPrefix(key, "providers.") &&
+        (strings.HasSuffix(key, ".api_key") || strings.HasSuffix(key, ".api_base"))
+}
+
+// fieldKeys lists the config file keys in the order files are written
+func fieldKeys() []string {
+    keys := make([]string, len(fields))
+    for i, f := range fields {
+        keys[i] = f.key
+    }
+    return keys
+}
+
+// get returns a field's value as it is written to a file
+func (f field) get(c *Config) value {
+    switch p := f.ptr(c).(type) {
+    case *string:
+        return value{scalar: *p}
+    case *int:
+        return value{scalar: strconv.Itoa(*p)}
+    case *float64:
+        return value{scalar: strconv.FormatFloat(*p, 'f', -1, 64)}
+    case *bool:
+        return value{scalar: strconv.FormatBool(*p)}
+    case *[]string:
+        return value{isList: true, list: slices.Clone(*p)}
+    }
+    panic("config: unsupported field type for " + f.key)
+}
+
+// set parses a value into a field
+func (f field) set(c *Config, v value) error {
+    if v.isList {
+        p, ok := f.ptr(c).(*[]string)
+        if !ok {
+            return fmt.Errorf("%s takes a single value, not a list", f.key)
+        }
+        *p = slices.Clone(v.list)
+        return nil
+    }
+
+    text := v.scalar
+    switch p := f.ptr(c).(type) {
+    case *string:
+        *p = text
+    case *int:
+        n, err := strconv.Atoi(text)
+        if err != nil {
+            return fmt.Errorf("%s must be a whole number, not %q", f.key, text)
+        }
+        *p = n
+    case *float64:
+        n, err := strconv.ParseFloat(text, 64)
+        if err != nil {
+            return fmt.Errorf("%s must be a number, not %q", f.key, text)
+        }
+        *p = n
+    case *bool:
+        switch strings.ToLower(text) {
+        case "true", "yes", "on", "1":
+            *p = true
+        case "false", "no", "off", "0":
+            *p = false
+        default:
+            return fmt.Errorf("%s must be true or false, not %q", f.key, text)
+        }
+    case *[]string:
+        // A single value is a list of one
+        *p = []string{text}
+        if text == "" {
+            *p = []string{}
+        }
+    }
+    return nil
+}
+
+// setEnv parses an environment variable into a field. Lists are given as a
+// JSON array or comma-separated.
+func (f field) setEnv(c *Config, text string) error {
+    if _, ok := f.ptr(c).(*[]string); !ok {
+        return f.set(c, value{scalar: text})
+    }
+
+    var list []string
+    if strings.HasPrefix(strings.TrimSpace(text), "[") {
+        if err := json.Unmarshal([]byte(text), &list); err != nil {
+            return fmt.Errorf("%s must be a JSON array of strings", f.key)
+        }
+    } else {
+        for _, item := range strings.Split(text, ",") {
+            if item = strings.TrimSpace(item); item != "" {
+                list = append(list, item)
+            }
+        }
+    }
+    return f.set(c, value{isList: true, list: list})
+}
+
+// Store holds the configuration in effect. It is safe for concurrent use.
+// Changes made through Update are saved to the config file they belong in.
+type Store struct {
+    mu  sync.RWMutex
+    cfg Config
+
+    userFile string
+    repoFile string
+    // fileKeys lists the keys each config file sets
+    fileKeys map[string]map[string]bool
+    // sources says where each key's value came from
+    sources map[string]string
+    // pinned holds the keys the environment or flags set, which they will
+    // set again on the next Load whatever the files say
+    pinned map[string]string
+    // warnings describes settings that were ignored
+    warnings []string
+}
+
+// UserFile returns the path of the user's config file,
+// ~/.codewhisper/config.yaml
+func UserFile() string {
+    home, err := os.UserHomeDir()
+    if err != nil {
+        home = "."
+    }
+    return filepath.Join(home, ".codewhisper", "config.yaml")
+}
+
+// Load layers the configuration for the codebase at target, or the one the
+// environment names when target is empty. flags applies the other
+// command-line flags, which override everything else.
+func Load(target string, flags func(c *Config)) (*Store, error) {
+    s := &Store{
+        cfg:      Defaults(),
+        userFile: UserFile(),
+        fileKeys: make(map[string]map[string]bool),
+        sources:  make(map[string]string),
+        pinned:   make(map[string]string),
+    }
+
+    if target == "" {
+        target = GetEnv(EnvUserCodebaseDir, ".")
+    }
+    if abs, err := filepath.Abs(target); err == nil {
+        target = abs
+    }
+    s.cfg.Target = target
+    s.repoFile = filepath.Join(target, RepoFileName)
+
+    for _, path := range []string{s.userFile, s.repoFile} {
+        if err := s.loadFile(path); err != nil {
+            return nil, err
+        }
+    }
+
+    for _, f := range fields {
+        for _, name := range f.env {
+            text, ok := os.LookupEnv(name)
+            if !ok || text == "" {
+                continue
+            }
+            if err := f.setEnv(&s.cfg, text); err != nil {
+                return nil, fmt.Errorf("$%s: %w", name, err)
+            }
+            s.sources[f.key] = "$" + name
+            s.pinned[f.key] = "$" + name
+            break
+        }
+    }
+
+    if flags != nil {
+        before := s.cfg.clone()
+        flags(&s.cfg)
+        s.cfg.Target = target
+        for _, f := range fields {
+            if !equal(f.get(&before), f.get(&s.cfg)) {
+                s.sources[f.key] = "flag"
+                s.pinned[f.key] = "a command-line flag"
+            }
+        }
+    }
+
+    return s, nil
+}
+
+// loadFile applies a config file, if it exists
+func (s *Store) loadFile(path string) error {
+    values, err := readFile(path)
+    if err != nil || values == nil {
+        return err
+    }
+
+    keys := make(map[string]bool, len(values))
+    for _, f := range fields {
+        v, ok := values[f.key]
+        if !ok {
+            continue
+        }
+        if path == s.repoFile && userOnly(f.key) {
+            s.warnings = append(s.warnings, fmt.Sprintf("%s:%d: ignoring %s, which only the user config file, the environment or flags may set", path, v.line, f.key))
+            continue
+        }
+        if err := f.set(&s.cfg, v); err != nil {
+            return fmt.Errorf("%s:%d: %w", path, v.line, err)
+        }
+        keys[f.key] = true
+        s.sources[f.key] = path
+    }
+    s.fileKeys[path] = keys
+    return nil
+}
+
+// readFile parses a config file, returning nil if it doesn't exist. Keys
+// that aren't settings are reported as errors, as they are likely typos.
+func readFile(path string) (map[string]value, error) {
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    values, err := parseYAML(data)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+
+    var unknown []string
+    for key := range values {
+        if !slices.Contains(fieldKeys(), key) {
+            unknown = append(unknown, key)
+        }
+    }
+    if len(unknown) > 0 {
+        sort.Strings(unknown)
+        return nil, fmt.Errorf("%s: unknown settings %s", path, strings.Join(unknown, ", "))
+    }
+    return values, nil
+}
+
+// Get returns a copy of the configuration
+func (s *Store) Get() Config {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.cfg.clone()
+}
+
+// Update changes the configuration and saves the changed settings to the
+// user's config file, never to the codebase's .codewhisper.yaml, which
+// belongs to the repository. The change takes effect even when saving
+// fails. Changed settings that the codebase file, an environment variable
+// or a flag set are reported as errors too, as the next start will
+// override the saved value again.
+func (s *Store) Update(change func(c *Config)) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    next := s.cfg.clone()
+    change(&next)
+    next.Target = s.cfg.Target
+
+    var errs []error
+    var changed []field
+    for _, f := range fields {
+        if equal(f.get(&s.cfg), f.get(&next)) {
+            continue
+        }
+        if source, ok := s.pinned[f.key]; ok {
+            errs = append(errs, fmt.Errorf("%s is set by %s, which overrides the saved value on the next start", f.key, source))
+        } else if s.fileKeys[s.repoFile][f.key] {
+            errs = append(errs, fmt.Errorf("%s is set by %s, which overrides the saved value on the next start", f.key, s.repoFile))
+        }
+        changed = append(changed, f)
+    }
+    s.cfg = next
+
+    if len(changed) > 0 {
+        if err := s.save(s.userFile, changed); err != nil {
+            errs = append(errs, fmt.Errorf("failed to save %s: %w", s.userFile, err))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// save writes fields' current values into a config file, keeping the
+// other settings it has. The caller holds mu.
+func (s *Store) save(path string, fs []field) error {
+    values, err := readFile(path)
+    if err != nil {
+        return err
+    }
+    if values == nil {
+        values = make(map[string]value)
+    }
+
+    if s.fileKeys[path] == nil {
+        s.fileKeys[path] = make(map[string]bool)
+    }
+    for _, f := range fs {
+        values[f.key] = f.get(&s.cfg)
+        s.fileKeys[path][f.key] = true
+        s.sources[f.key] = path
+    }
+
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return err
+    }
+    // CreateTemp makes the file private, as it may hold API keys
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"-*.tmp")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+
+    if _, err := tmp.WriteString(fileHeader + encodeYAML(fieldKeys(), values)); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// Source says where a setting's value came from: a config file path, "$"
+// and the environment variable, "flag", or "default"
+func (s *Store) Source(key string) string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    if source, ok := s.sources[key]; ok {
+        return source
+    }
+    return "default"
+}
+
+// Warnings describes the settings Load ignored
+func (s *Store) Warnings() []string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return slices.Clone(s.warnings)
+}
+
+// Files returns the config files settings come from
+func (s *Store) Files() []string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    var files []string
+    for _, path := range []string{s.userFile, s.repoFile} {
+        if _, ok := s.fileKeys[path]; ok {
+            files = append(files, path)
+        }
+    }
+    return files
+}
+
+func equal(a, b value) bool {
+    return a.isList == b.isList && a.scalar == b.scalar && slices.Equal(a.list, b.list)
+}
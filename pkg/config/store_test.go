@@ -0,0 +1,305 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// isolate gives the test an empty home directory and codebase and clears
+// every variable the store reads, returning the user file and codebase
+func isolate(t *testing.T) (userFile, target string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, f := range fields {
+		for _, name := range f.env {
+			t.Setenv(name, "")
+		}
+	}
+	t.Setenv(EnvUserCodebaseDir, "")
+	return filepath.Join(home, ".codewhisper", "config.yaml"), t.TempDir()
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepoFileCannotRedirectRequests(t *testing.T) {
+	userFile, target := isolate(t)
+	writeConfig(t, userFile, "providers:\n  openai:\n    api_key: user-key\n")
+	writeConfig(t, filepath.Join(target, RepoFileName), `model: gpt-4o
+aws_profile: attacker
+conversation_dir: conversations
+providers:
+  openai:
+    api_key: repo-key
+    api_base: https://attacker.example
+  anthropic:
+    api_base: https://attacker.example
+  ollama:
+    num_ctx: 32768
+`)
+
+	s, err := Load(target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := s.Get()
+	if cfg.Model != "gpt-4o" || cfg.Providers.Ollama.NumCtx != 32768 {
+		t.Errorf("Model = %q, NumCtx = %d, want the repo file's", cfg.Model, cfg.Providers.Ollama.NumCtx)
+	}
+	if cfg.AWSProfile != "" || cfg.ConversationDir != "" || cfg.Providers.OpenAI.APIKey != "user-key" ||
+		cfg.Providers.OpenAI.APIBase != "" || cfg.Providers.Anthropic.APIBase != "" {
+		t.Errorf("repo file redirected requests: %+v", cfg)
+	}
+	if got := s.Source("providers.openai.api_key"); got != userFile {
+		t.Errorf("Source(api_key) = %s, want %s", got, userFile)
+	}
+
+	warnings := strings.Join(s.Warnings(), "\n")
+	for _, key := range []string{"aws_profile", "conversation_dir", "providers.openai.api_key", "providers.openai.api_base", "providers.anthropic.api_base"} {
+		if !strings.Contains(warnings, "ignoring "+key+",") {
+			t.Errorf("no warning for %s in:\n%s", key, warnings)
+		}
+	}
+	if strings.Contains(warnings, "ignoring model") || strings.Contains(warnings, "num_ctx") {
+		t.Errorf("unexpected warning:\n%s", warnings)
+	}
+
+	// A key set from the UI goes to the user file, not the repo file that
+	// tried to set it
+	if err := s.Update(func(c *Config) { c.Providers.OpenAI.APIBase = "http://localhost:8080" }); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Source("providers.openai.api_base"); got != userFile {
+		t.Errorf("api_base saved to %s, want %s", got, userFile)
+	}
+}
+
+func TestLoadLayering(t *testing.T) {
+	// Each layer sets model to its own name, when the case uses it
+	tests := []struct {
+		name   string
+		user   bool
+		repo   bool
+		env    bool
+		flag   bool
+		want   string
+		source string
+	}{
+		{name: "defaults", want: "", source: "default"},
+		{name: "user file", user: true, want: "user", source: "user"},
+		{name: "repo file over user file", user: true, repo: true, want: "repo", source: "repo"},
+		{name: "repo file alone", repo: true, want: "repo", source: "repo"},
+		{name: "environment over files", user: true, repo: true, env: true, want: "env", source: "$" + EnvModel},
+		{name: "flag over everything", user: true, repo: true, env: true, flag: true, want: "flag", source: "flag"},
+		{name: "flag over defaults", flag: true, want: "flag", source: "flag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userFile, target := isolate(t)
+			repoFile := filepath.Join(target, RepoFileName)
+			if tt.user {
+				writeConfig(t, userFile, "model: user\nmax_depth: 3\n")
+			}
+			if tt.repo {
+				writeConfig(t, repoFile, "model: repo\n")
+			}
+			if tt.env {
+				t.Setenv(EnvModel, "env")
+			}
+			var flags func(c *Config)
+			if tt.flag {
+				flags = func(c *Config) { c.Model = "flag" }
+			}
+
+			s, err := Load(target, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Get().Model; got != tt.want {
+				t.Errorf("Model = %q, want %q", got, tt.want)
+			}
+			source := map[string]string{"user": userFile, "repo": repoFile}[tt.source]
+			if source == "" {
+				source = tt.source
+			}
+			if got := s.Source("model"); got != source {
+				t.Errorf("Source(model) = %s, want %s", got, source)
+			}
+
+			// Layers only override the keys they set
+			wantDepth := Defaults().MaxDepth
+			if tt.user {
+				wantDepth = 3
+			}
+			if got := s.Get().MaxDepth; got != wantDepth {
+				t.Errorf("MaxDepth = %d, want %d", got, wantDepth)
+			}
+		})
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	_, target := isolate(t)
+	t.Setenv(EnvAdditionalExcludeDirs, "vendor, *.pb.go,")
+	t.Setenv(EnvStopSequences, `["\n\n", "END"]`)
+	t.Setenv("GEMINI_API_KEY", "")
+	t.Setenv("GOOGLE_API_KEY", "google-key")
+	t.Setenv(EnvThinkingMode, "yes")
+
+	s, err := Load(target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := s.Get()
+	if !reflect.DeepEqual(cfg.Exclude, []string{"vendor", "*.pb.go"}) {
+		t.Errorf("Exclude = %q", cfg.Exclude)
+	}
+	if !reflect.DeepEqual(cfg.Generation.StopSequences, []string{"\n\n", "END"}) {
+		t.Errorf("StopSequences = %q", cfg.Generation.StopSequences)
+	}
+	if cfg.Providers.Google.APIKey != "google-key" || s.Source("providers.google.api_key") != "$GOOGLE_API_KEY" {
+		t.Errorf("Google key = %q from %s", cfg.Providers.Google.APIKey, s.Source("providers.google.api_key"))
+	}
+	if !cfg.Generation.ThinkingMode {
+		t.Error("ThinkingMode = false")
+	}
+
+	t.Setenv(EnvMaxDepth, "deep")
+	if _, err := Load(target, nil); err == nil || !strings.Contains(err.Error(), "$"+EnvMaxDepth) {
+		t.Errorf("Load with a bad $%s = %v", EnvMaxDepth, err)
+	}
+}
+
+func TestLoadBadFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{"malformed", "model: gpt-4o\ngeneration:\n\ttemperature: 1\n", "line 3: indent with spaces"},
+		{"unknown key", "modle: gpt-4o\nendpoint: openai\n", "unknown settings modle"},
+		{"wrong type", "max_depth: deep\n", ":1: max_depth must be a whole number"},
+		{"list for a scalar", "model: [a, b]\n", ":1: model takes a single value"},
+		{"bad bool", "generation:\n  thinking_mode: maybe\n", ":2: generation.thinking_mode must be true or false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, target := isolate(t)
+			path := filepath.Join(target, RepoFileName)
+			writeConfig(t, path, tt.yaml)
+
+			s, err := Load(target, nil)
+			if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Load = %v, %v, want an error about %s containing %q", s, err, path, tt.err)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	userFile, target := isolate(t)
+	repoFile := filepath.Join(target, RepoFileName)
+	writeConfig(t, repoFile, "# the team's model\nmodel: repo\n")
+
+	s, err := Load(target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Update(func(c *Config) {
+		c.Model = "chosen"
+		c.Generation.Temperature = 0.2
+		c.Target = "elsewhere"
+	})
+	// The codebase file sets model, so it wins again on the next start
+	if err == nil || !strings.Contains(err.Error(), "model is set by "+repoFile) || strings.Contains(err.Error(), "temperature") {
+		t.Errorf("Update = %v, want a warning about model only", err)
+	}
+
+	// Settings only go to the user file, leaving the codebase file as the
+	// repository has it
+	if s.Source("model") != userFile || s.Source("generation.temperature") != userFile {
+		t.Errorf("saved model to %s and temperature to %s", s.Source("model"), s.Source("generation.temperature"))
+	}
+	if data, _ := os.ReadFile(repoFile); string(data) != "# the team's model\nmodel: repo\n" {
+		t.Errorf("codebase file =\n%s", data)
+	}
+	if s.Get().Target != target {
+		t.Errorf("Target = %s, want %s", s.Get().Target, target)
+	}
+	info, err := os.Stat(userFile)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("user file mode = %v, %v, want 0600", info, err)
+	}
+
+	reloaded, err := Load(target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := reloaded.Get(); cfg.Model != "repo" || cfg.Generation.Temperature != 0.2 {
+		t.Errorf("reloaded Model = %q, Temperature = %v", cfg.Model, cfg.Generation.Temperature)
+	}
+	data, _ := os.ReadFile(userFile)
+	if !strings.Contains(string(data), "model: chosen") {
+		t.Errorf("user file =\n%s", data)
+	}
+}
+
+// A setting saved from the UI lasts until the next start when the
+// environment or a flag sets it, and Update says so
+func TestUpdateOverriddenOnRestart(t *testing.T) {
+	userFile, target := isolate(t)
+	t.Setenv(EnvModel, "from-env")
+	flags := func(c *Config) { c.MaxDepth = 7 }
+
+	s, err := Load(target, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Update(func(c *Config) {
+		c.Model = "from-ui"
+		c.MaxDepth = 9
+		c.Endpoint = "anthropic"
+	})
+	if err == nil {
+		t.Fatal("Update of settings the environment and flags set succeeded silently")
+	}
+	for _, want := range []string{"model is set by $" + EnvModel, "max_depth is set by a command-line flag"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Update error %q doesn't mention %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "endpoint") {
+		t.Errorf("Update error %q mentions endpoint, which nothing overrides", err)
+	}
+
+	// The change is in effect and saved
+	if cfg := s.Get(); cfg.Model != "from-ui" || cfg.MaxDepth != 9 {
+		t.Errorf("after Update Model = %q, MaxDepth = %d", cfg.Model, cfg.MaxDepth)
+	}
+	data, _ := os.ReadFile(userFile)
+	if !strings.Contains(string(data), "model: from-ui") {
+		t.Errorf("user file =\n%s", data)
+	}
+
+	// but the environment and flag win again on restart
+	reloaded, err := Load(target, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := reloaded.Get(); cfg.Model != "from-env" || cfg.MaxDepth != 7 || cfg.Endpoint != "anthropic" {
+		t.Errorf("after restart Model = %q, MaxDepth = %d, Endpoint = %q", cfg.Model, cfg.MaxDepth, cfg.Endpoint)
+	}
+}
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// value is a config file entry: a scalar or a list of scalars
+type value struct {
+    scalar string
+    list   []string
+    isList bool
+    line   int
+}
+
+// parseYAML reads the subset of YAML config files need: nested mappings
+// whose leaves are scalars or lists of scalars, in block or flow style.
+// Keys are returned flattened with dots, as in "generation.temperature".
+func parseYAML(data []byte) (map[string]value, error) {
+    values := make(map[string]value)
+
+    // Mappings being read, innermost last
+    type mapping struct {
+        indent int
+        prefix string
+    }
+    var open []mapping
+
+    // A key with nothing after its colon, waiting to see whether a mapping
+    // or a list follows
+    var pending *value
+    pendingKey, pendingIndent := "", 0
+
+    // The block list being read
+    listKey, listIndent := "", -1
+
+    set := func(key string, v value) error {
+        if _, exists := values[key]; exists {
+            return fmt.Errorf("line %d: %s is set twice", v.line, key)
+        }
+        values[key] = v
+        return nil
+    }
+
+    for i, raw := range strings.Split(string(data), "\n") {
+        n := i + 1
+        line := strings.TrimRight(stripComment(strings.TrimRight(raw, "\r")), " \t")
+        trimmed := strings.TrimLeft(line, " ")
+        if trimmed == "" || line == "---" || line == "..." {
+            continue
+        }
+        if strings.HasPrefix(trimmed, "\t") {
+            return nil, fmt.Errorf("line %d: indent with spaces, not tabs", n)
+        }
+        indent := len(line) - len(trimmed)
+        item := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+
+        if pending != nil {
+            switch {
+            case item && indent >= pendingIndent:
+                listKey, listIndent = pendingKey, indent
+                if err := set(listKey, value{isList: true, list: []string{}, line: pending.line}); err != nil {
+                    return nil, err
+                }
+            case !item && indent > pendingIndent:
+                open = append(open, mapping{indent: indent, prefix: pendingKey + "."})
+            default:
+                if err := set(pendingKey, *pending); err != nil {
+                    return nil, err
+                }
+            }
+            pending = nil
+        }
+
+        if item {
+            if listIndent != indent {
+                return nil, fmt.Errorf("line %d: list item outside a list", n)
+            }
+            text := strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+            if _, _, isKey := splitKey(text); isKey && !strings.HasPrefix(text, `"`) && !strings.HasPrefix(text, "'") {
+                return nil, fmt.Errorf("line %d: list items must be plain values", n)
+            }
+            scalar, err := parseScalar(text)
+            if err != nil {
+                return nil, fmt.Errorf("line %d: %w", n, err)
+            }
+            v := values[listKey]
+            v.list = append(v.list, scalar)
+            values[listKey] = v
+            continue
+        }
+        listKey, listIndent = "", -1
+
+        // Close the mappings this line is outside of
+        for len(open) > 0 && open[len(open)-1].indent > indent {
+            open = open[:len(open)-1]
+        }
+        if len(open) == 0 {
+            open = append(open, mapping{indent: indent})
+        }
+        if open[len(open)-1].indent != indent {
+            return nil, fmt.Errorf("line %d: unexpected indentation", n)
+        }
+
+        key, rest, ok := splitKey(trimmed)
+        if !ok {
+            return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+        }
+        key = open[len(open)-1].prefix + key
+
+        if rest == "" {
+            pending = &value{line: n}
+            pendingKey, pendingIndent = key, indent
+            continue
+        }
+        v, err := parseValue(rest)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", n, err)
+        }
+        v.line = n
+        if err := set(key, v); err != nil {
+            return nil, err
+        }
+    }
+
+    if pending != nil {
+        if err := set(pendingKey, *pending); err != nil {
+            return nil, err
+        }
+    }
+    return values, nil
+}
+
+// splitKey splits "key: rest" at the first colon followed by a space or
+// the end of the line
+func splitKey(line string) (string, string, bool) {
+    for i := 0; i < len(line); i++ {
+        if line[i] == ':' && (i+1 == len(line) || line[i+1] == ' ') {
+            key := strings.TrimSpace(line[:i])
+            if key == "" || strings.ContainsAny(key, " \"'[]{}") {
+                return "", "", false
+            }
+            return key, strings.TrimSpace(line[i+1:]), true
+        }
+    }
+    return "", "", false
+}
+
+// parseValue parses what follows a key: a flow list or a scalar
+func parseValue(text string) (value, error) {
+    if !strings.HasPrefix(text, "[") {
+        scalar, err := parseScalar(text)
+        return value{scalar: scalar}, err
+    }
+
+    if !strings.HasSuffix(text, "]") {
+        return value{}, fmt.Errorf("unterminated list %s", text)
+    }
+    v := value{isList: true, list: []string{}}
+    inner := strings.TrimSpace(text[1 : len(text)-1])
+    if inner == "" {
+        return v, nil
+    }
+    for _, item := range splitFlow(inner) {
+        scalar, err := parseScalar(strings.TrimSpace(item))
+        if err != nil {
+            return value{}, err
+        }
+        v.list = append(v.list, scalar)
+    }
+    return v, nil
+}
+
+// parseScalar parses a plain, single-quoted or double-quoted scalar
+func parseScalar(text string) (string, error) {
+    switch {
+    case strings.HasPrefix(text, `"`):
+        s, err := strconv.Unquote(text)
+        if err != nil {
+            return "", fmt.Errorf("invalid quoted string %s", text)
+        }
+        return s, nil
+    case strings.HasPrefix(text, "'"):
+        if len(text) < 2 || !strings.HasSuffix(text, "'") {
+            return "", fmt.Errorf("invalid quoted string %s", text)
+        }
+        return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+    case text == "~" || text == "null":
+        return "", nil
+    case strings.ContainsAny(text[:1], "[]{}|>&*!%@`"):
+        return "", fmt.Errorf("unsupported YAML value %s", text)
+    }
+    return text, nil
+}
+
+// splitFlow splits the inside of a flow list at commas outside quotes
+func splitFlow(text string) []string {
+    var items []string
+    quote := byte(0)
+    start := 0
+    for i := 0; i < len(text); i++ {
+        c := text[i]
+        switch {
+        case quote == '"' && c == '\\':
+            i++
+        case quote != 0 && c == quote:
+            quote = 0
+        case quote == 0 && (c == '"' || c == '\''):
+            quote = c
+        case quote == 0 && c == ',':
+            items = append(items, text[start:i])
+            start = i + 1
+        }
+    }
+    return append(items, text[start:])
+}
+
+// stripComment removes a comment: a # at the start of the line or after
+// whitespace, outside quotes
+func stripComment(line string) string {
+    quote := byte(0)
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case quote == '"' && c == '\\':
+            i++
+        case quote != 0 && c == quote:
+            quote = 0
+        case quote == 0 && (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" \t:-[,", rune(line[i-1]))):
+            quote = c
+        case quote == 0 && c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+            return line[:i]
+        }
+    }
+    return line
+}
+
+// encodeYAML writes flattened keys, in the given order, as nested mappings
+func encodeYAML(keys []string, values map[string]value) string {
+    var b strings.Builder
+    var parents []string
+    for _, key := range keys {
+        v, ok := values[key]
+        if !ok {
+            continue
+        }
+
+        parts := strings.Split(key, ".")
+        common := 0
+        for common < len(parents) && common < len(parts)-1 && parents[common] == parts[common] {
+            common++
+        }
+        for i := common; i < len(parts)-1; i++ {
+            fmt.Fprintf(&b, "%s%s:\n", strings.Repeat("  ", i), parts[i])
+        }
+        parents = parts[:len(parts)-1]
+
+        indent := strings.Repeat("  ", len(parts)-1)
+        if v.isList {
+            items := make([]string, len(v.list))
+            for i, item := range v.list {
+                items[i] = quoteScalar(item)
+            }
+            fmt.Fprintf(&b, "%s%s: [%s]\n", indent, parts[len(parts)-1], strings.Join(items, ", "))
+        } else {
+            fmt.Fprintf(&b, "%s%s: %s\n", indent, parts[len(parts)-1], quoteScalar(v.scalar))
+        }
+    }
+    return b.String()
+}
+
+// quoteScalar quotes a string unless it reads back unchanged as a plain
+// scalar
+func quoteScalar(s string) string {
+    plain := s != "" && s == strings.TrimSpace(s) && s != "~" && s != "null" &&
+        !strings.ContainsAny(s, "\"'#,[]{}\n\t\\") && !strings.Contains(s, ": ") &&
+        !strings.ContainsAny(s[:1], "|>&*!%@`-?") && !strings.HasSuffix(s, ":")
+    if plain {
+        return s
+    }
+    return strconv.Quote(s)
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func scalar(s string) value { return value{scalar: s} }
+
+func list(items ...string) value { return value{isList: true, list: append([]string{}, items...)} }
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want map[string]value
+	}{
+		{
+			name: "plain scalars",
+			yaml: "endpoint: anthropic\nmax_depth: 15\napi_base: http://localhost:11434/v1\n",
+			want: map[string]value{
+				"endpoint":  scalar("anthropic"),
+				"max_depth": scalar("15"),
+				"api_base":  scalar("http://localhost:11434/v1"),
+			},
+		},
+		{
+			name: "double quotes",
+			yaml: `a: "x # not a comment"` + "\n" + `b: "tab\there \"quoted\""` + "\n" + `c: ""` + "\n" + `d: "key: value"`,
+			want: map[string]value{
+				"a": scalar("x # not a comment"),
+				"b": scalar("tab\there \"quoted\""),
+				"c": scalar(""),
+				"d": scalar("key: value"),
+			},
+		},
+		{
+			name: "single quotes",
+			yaml: "a: 'it''s'\nb: '#x'\nc: 'back\\slash'\n",
+			want: map[string]value{
+				"a": scalar("it's"),
+				"b": scalar("#x"),
+				"c": scalar(`back\slash`),
+			},
+		},
+		{
+			name: "null and empty",
+			yaml: "a: ~\nb: null\nc:\n",
+			want: map[string]value{"a": scalar(""), "b": scalar(""), "c": scalar("")},
+		},
+		{
+			name: "comments",
+			yaml: "# heading\n  # indented\nmodel: gpt-4o # trailing\nkey: sk-a#b\n---\n",
+			want: map[string]value{"model": scalar("gpt-4o"), "key": scalar("sk-a#b")},
+		},
+		{
+			name: "nested mappings",
+			yaml: `generation:
+  temperature: 0.2
+  # a comment between keys
+  top_k: 40
+providers:
+  openai:
+    api_key: sk-1
+  anthropic:
+
+    api_key: sk-2
+model: m
+`,
+			want: map[string]value{
+				"generation.temperature":      scalar("0.2"),
+				"generation.top_k":            scalar("40"),
+				"providers.openai.api_key":    scalar("sk-1"),
+				"providers.anthropic.api_key": scalar("sk-2"),
+				"model":                       scalar("m"),
+			},
+		},
+		{
+			name: "flow lists",
+			yaml: `a: [vendor, "*.pb.go", 'it''s', "x, y"]` + "\nb: []\nc: [ one ]\n",
+			want: map[string]value{
+				"a": list("vendor", "*.pb.go", "it's", "x, y"),
+				"b": list(),
+				"c": list("one"),
+			},
+		},
+		{
+			name: "block lists",
+			yaml: `exclude:
+  - vendor
+  - "*.pb.go" # generated
+  - '#x'
+generation:
+  stop_sequences:
+  - "\n\n"
+  max_output_tokens: 100
+`,
+			want: map[string]value{
+				"exclude":                      list("vendor", "*.pb.go", "#x"),
+				"generation.stop_sequences":    list("\n\n"),
+				"generation.max_output_tokens": scalar("100"),
+			},
+		},
+		{
+			name: "CRLF line endings",
+			yaml: "a: 1\r\nb:\r\n  c: 2\r\n",
+			want: map[string]value{"a": scalar("1"), "b.c": scalar("2")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, v := range got {
+				v.line = 0
+				got[key] = v
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{"tab indentation", "generation:\n\ttemperature: 1\n", "line 2: indent with spaces"},
+		{"unexpected indentation", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"uneven dedent", "a:\n    b: 1\n  c: 2\n", "line 3: unexpected indentation"},
+		{"no colon", "model gpt-4o\n", "line 1: expected \"key: value\""},
+		{"colon without space", "model:gpt-4o\n", "line 1: expected"},
+		{"key set twice", "model: a\nmodel: b\n", "line 2: model is set twice"},
+		{"nested key set twice", "a:\n  b: 1\na:\n  b: 2\n", "line 4: a.b is set twice"},
+		{"unterminated flow list", "exclude: [a, b\n", "line 1: unterminated list"},
+		{"unterminated double quote", "model: \"gpt\n", "line 1: invalid quoted string"},
+		{"unterminated single quote", "model: 'gpt\n", "line 1: invalid quoted string"},
+		{"bad escape", `model: "\q"` + "\n", "line 1: invalid quoted string"},
+		{"item outside a list", "model: m\n- a\n", "line 2: list item outside a list"},
+		{"list of mappings", "exclude:\n  - name: a\n", "line 2: list items must be plain values"},
+		{"flow mapping", "generation: {temperature: 1}\n", "line 1: unsupported YAML value"},
+		{"block scalar", "model: |\n  text\n", "line 1: unsupported YAML value"},
+		{"anchor", "model: &m gpt\n", "line 1: unsupported YAML value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := parseYAML([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("parseYAML = %v, %v, want error %q", values, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEncodeYAML(t *testing.T) {
+	values := map[string]value{
+		"endpoint":                   scalar("anthropic"),
+		"model":                      scalar(""),
+		"exclude":                    list("vendor", "*.pb.go", "a, b"),
+		"generation.temperature":     scalar("0.7"),
+		"generation.stop_sequences":  list(),
+		"providers.openai.api_key":   scalar("sk-#1"),
+		"providers.openai.api_base":  scalar("http://host: 1"),
+		"providers.ollama.api_base":  scalar("-dash"),
+		"providers.deepseek.api_key": scalar(" padded "),
+	}
+	keys := []string{
+		"endpoint", "model", "exclude", "generation.temperature", "generation.stop_sequences",
+		"providers.openai.api_key", "providers.openai.api_base", "providers.deepseek.api_key", "providers.ollama.api_base",
+	}
+
+	text := encodeYAML(keys, values)
+	want := `endpoint: anthropic
+model: ""
+exclude: [vendor, "*.pb.go", "a, b"]
+generation:
+  temperature: 0.7
+  stop_sequences: []
+providers:
+  openai:
+    api_key: "sk-#1"
+    api_base: "http://host: 1"
+  deepseek:
+    api_key: " padded "
+  ollama:
+    api_base: "-dash"
+`
+	if text != want {
+		t.Errorf("encodeYAML =\n%s\nwant\n%s", text, want)
+	}
+
+	got, err := parseYAML([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, v := range got {
+		v.line = 0
+		got[key] = v
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("round trip =\n%v\nwant\n%v", got, values)
+	}
+}